@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"twitchclipsearch/internal/config"
+	"twitchclipsearch/internal/service"
+)
+
+const backfillUsage = `usage: twitchclipsearch backfill [flags] <streamer>...
+
+Imports the clip archive of each streamer. Interrupted backfills resume from
+their last completed window when run again with the same -since. Imported
+clips are only posted to Discord with -notify; run at most one process that
+posts to Discord at a time, as rate limits are tracked per process.
+
+flags:`
+
+// twitchClipsLaunch predates the oldest clips Twitch serves
+var twitchClipsLaunch = time.Date(2016, 5, 1, 0, 0, 0, 0, time.UTC)
+
+// runBackfill implements the backfill subcommand and returns the process exit code
+func runBackfill(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, backfillUsage)
+		flags.PrintDefaults()
+	}
+	since := flags.String("since", twitchClipsLaunch.Format("2006-01-02"), "import clips created at or after this date or RFC 3339 time")
+	until := flags.String("until", "", "import clips created before this date or RFC 3339 time (default now)")
+	window := flags.Duration("window", service.DefaultBackfillWindow, "span of clips requested per query")
+	notify := flags.Bool("notify", false, "post imported clips to Discord")
+	restart := flags.Bool("restart", false, "ignore the checkpoint of a previous run")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	opts := service.BackfillOptions{
+		Window:  *window,
+		Notify:  *notify,
+		Restart: *restart,
+	}
+	var err error
+	if opts.Since, err = parseDate(*since); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -since: %v\n", err)
+		return 2
+	}
+	if *until != "" {
+		if opts.Until, err = parseDate(*until); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -until: %v\n", err)
+			return 2
+		}
+	}
+
+	clipService, db, code := openService(cfg)
+	if clipService == nil {
+		return code
+	}
+	defer db.Close()
+
+	// Stop between requests on interrupt; the checkpoint keeps the progress
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	for _, streamerName := range flags.Args() {
+		result, err := clipService.Backfill(ctx, streamerName, opts)
+		if result != nil {
+			if !result.ResumedFrom.IsZero() {
+				fmt.Printf("%s: resumed from %s\n", streamerName, result.ResumedFrom.Format(time.RFC3339))
+			}
+			fmt.Printf("%s: fetched %d clip(s) in %d window(s), saved %d new\n",
+				streamerName, result.Fetched, result.Windows, result.Saved)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Backfill of %s failed: %v\n", streamerName, err)
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// parseDate accepts a date or an RFC 3339 time, interpreting dates as UTC
+func parseDate(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
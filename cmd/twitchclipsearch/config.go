@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"twitchclipsearch/internal/config"
+)
+
+const configUsage = `usage: twitchclipsearch config <command>
+
+commands:
+  check [path]   validate a configuration file (default: the one selected by
+                 --config, --env or APP_ENV)`
+
+// runConfig implements the config subcommand and returns the process exit code
+func runConfig(path string, args []string) int {
+	if len(args) == 0 || args[0] != "check" || len(args) > 2 {
+		fmt.Fprintln(os.Stderr, configUsage)
+		return 2
+	}
+
+	if len(args) == 2 {
+		path = args[1]
+	}
+
+	_, err := config.LoadFile(path)
+	var invalid *config.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		for _, problem := range invalid.Problems {
+			if problem.Line > 0 {
+				fmt.Fprintf(os.Stderr, "%s:%d: %s: %s\n", path, problem.Line, problem.Path, problem.Message)
+			} else {
+				fmt.Fprintf(os.Stderr, "%s: %s: %s\n", path, problem.Path, problem.Message)
+			}
+		}
+		fmt.Fprintf(os.Stderr, "%d problem(s) found\n", len(invalid.Problems))
+		return 1
+	case err != nil:
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Printf("%s: OK\n", path)
+	return 0
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"twitchclipsearch/internal/config"
+	"twitchclipsearch/internal/database"
+)
+
+const exportUsage = `usage: twitchclipsearch export [flags]
+
+Writes archived clips as JSON lines, newest first, for import into another
+database.
+
+flags:`
+
+const importUsage = `usage: twitchclipsearch import [file]
+
+Reads clips written by export from file, or standard input without one.
+Clips that are already stored are skipped.`
+
+// exportPageSize is how many clips are read from the database at a time
+const exportPageSize = 500
+
+// clipRecord is a clip as written by export and read by import
+type clipRecord struct {
+	ID            string    `json:"id"`
+	StreamerName  string    `json:"streamer_name"`
+	BroadcasterID string    `json:"broadcaster_id"`
+	Title         string    `json:"title"`
+	URL           string    `json:"url"`
+	EmbedURL      string    `json:"embed_url"`
+	ThumbnailURL  string    `json:"thumbnail_url"`
+	CreatorID     string    `json:"creator_id"`
+	CreatorName   string    `json:"creator_name"`
+	GameID        string    `json:"game_id"`
+	VideoID       string    `json:"video_id"`
+	Language      string    `json:"language"`
+	ViewCount     int       `json:"view_count"`
+	Duration      float64   `json:"duration"`
+	VodOffset     int       `json:"vod_offset"`
+	StreamID      string    `json:"stream_id"`
+	CreatedAt     time.Time `json:"created_at"`
+	PostedAt      time.Time `json:"posted_at"`
+}
+
+// runExport implements the export subcommand and returns the process exit code
+func runExport(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, exportUsage)
+		flags.PrintDefaults()
+	}
+	streamer := flags.String("streamer", "", "only export clips of this streamer")
+	since := flags.String("since", "", "only export clips created at or after this date or RFC 3339 time")
+	until := flags.String("until", "", "only export clips created before this date or RFC 3339 time")
+	output := flags.String("o", "", "write to this file instead of standard output")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	query := database.ClipQuery{StreamerName: *streamer, Sort: database.SortCreated, Limit: exportPageSize}
+	var err error
+	if *since != "" {
+		if query.Since, err = parseDate(*since); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -since: %v\n", err)
+			return 2
+		}
+	}
+	if *until != "" {
+		if query.Until, err = parseDate(*until); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -until: %v\n", err)
+			return 2
+		}
+	}
+
+	db, err := database.Connect(cfg.Database)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	out := os.Stdout
+	if *output != "" {
+		if out, err = os.Create(*output); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create %s: %v\n", *output, err)
+			return 1
+		}
+		defer out.Close()
+	}
+
+	w := bufio.NewWriter(out)
+	encoder := json.NewEncoder(w)
+	exported := 0
+	for {
+		page, err := db.GetClips(query)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Export failed after %d clip(s): %v\n", exported, err)
+			return 1
+		}
+		for _, clip := range page.Clips {
+			if err := encoder.Encode(clipRecord(*clip)); err != nil {
+				fmt.Fprintf(os.Stderr, "Export failed after %d clip(s): %v\n", exported, err)
+				return 1
+			}
+			exported++
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "Export failed: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %d clip(s)\n", exported)
+	return 0
+}
+
+// runImport implements the import subcommand and returns the process exit code
+func runImport(cfg *config.Config, args []string) int {
+	if len(args) > 1 || (len(args) == 1 && (args[0] == "-h" || args[0] == "-help")) {
+		fmt.Fprintln(os.Stderr, importUsage)
+		return 2
+	}
+
+	var in io.Reader = os.Stdin
+	if len(args) == 1 {
+		f, err := os.Open(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open %s: %v\n", args[0], err)
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+
+	db, err := database.Connect(cfg.Database)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	imported, skipped, err := importClips(db, in)
+	fmt.Fprintf(os.Stderr, "Imported %d clip(s), skipped %d already stored\n", imported, skipped)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Import failed: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// importClips saves the clips read from r that are not stored yet and
+// returns how many were saved and skipped
+func importClips(db database.ClipStore, r io.Reader) (imported, skipped int, err error) {
+	decoder := json.NewDecoder(r)
+	for n := 1; ; n++ {
+		var record clipRecord
+		if err := decoder.Decode(&record); err == io.EOF {
+			return imported, skipped, nil
+		} else if err != nil {
+			return imported, skipped, fmt.Errorf("clip %d: %w", n, err)
+		}
+		if record.ID == "" || record.StreamerName == "" {
+			return imported, skipped, fmt.Errorf("clip %d: id and streamer_name are required", n)
+		}
+
+		exists, err := db.ClipExists(record.ID)
+		if err != nil {
+			return imported, skipped, err
+		}
+		if exists {
+			skipped++
+			continue
+		}
+
+		clip := database.Clip(record)
+		if err := db.SaveClip(&clip); err != nil {
+			return imported, skipped, fmt.Errorf("clip %s: %w", record.ID, err)
+		}
+		imported++
+	}
+}
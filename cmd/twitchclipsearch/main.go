@@ -1,67 +1,107 @@
 package main
 
 import (
-	"context"
 	"flag"
-	"log"
+	"fmt"
 	"os"
-	"os/signal"
-	"syscall"
 
 	"twitchclipsearch/internal/config"
-	"twitchclipsearch/internal/database"
 	"twitchclipsearch/internal/logger"
-	"twitchclipsearch/internal/metrics"
-	"twitchclipsearch/internal/service"
 )
 
+const usage = `usage: twitchclipsearch [flags] [command] [arguments]
+
+commands:
+  serve                    monitor streamers and serve the HTTP API (default)
+  poll-once <streamer>     check a streamer for new clips once
+  backfill <streamer>...   import the clip archive of streamers
+  search <query>           search the clip archive
+  export                   write archived clips as JSON lines
+  import [file]            read clips written by export
+  migrate <command>        manage the database schema
+  config check [path]      validate a configuration file
+  webhook test <streamer>  post a clip to a streamer's webhook
+  outbox <command>         list, retry or discard undelivered notifications
+
+Run a command with -h for its flags.
+
+flags:`
+
 func main() {
-	cfg, err := config.LoadConfig()
-	flag.Parse()
+	os.Exit(run())
+}
 
-	// Initialize logger
-	logger := logger.NewLogger()
-	defer logger.Sync()
+// run parses the global flags, loads the configuration and runs the command,
+// returning the process exit code
+func run() int {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	configFlag := flag.String("config", "", "configuration file (default config/<env>.yaml)")
+	envFlag := flag.String("env", "", "environment whose configuration file is used, overriding APP_ENV")
+	logLevel := flag.String("log-level", "", "debug, info, warn or error, overriding logging.level")
+	flag.Parse()
 
-	// Load configuration
-	cfg, err = config.LoadConfig()
-	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+	configPath := config.DefaultPath()
+	switch {
+	case *configFlag != "":
+		configPath = *configFlag
+	case *envFlag != "":
+		configPath = config.EnvPath(*envFlag)
 	}
 
-	// Initialize metrics
-	metrics.InitMetrics()
+	command, args := "serve", []string(nil)
+	if flag.NArg() > 0 {
+		command, args = flag.Arg(0), flag.Args()[1:]
+	}
 
-	// Initialize database
-	db, err := database.New(cfg.DatabasePath)
-	if err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+	// config check reports an invalid configuration instead of failing to load it
+	if command == "config" {
+		return runConfig(configPath, args)
 	}
-	defer db.Close()
 
-	// Create clip service
-	clipService, err := service.NewClipService(cfg, db)
+	// Load configuration
+	cfg, err := config.LoadFile(configPath)
 	if err != nil {
-		log.Fatalf("Failed to create clip service: %v", err)
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		return 1
 	}
 
-	// Setup context with cancellation
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	// Start service
-	if err := clipService.Start(ctx); err != nil {
-		log.Fatalf("Failed to start service: %v", err)
+	// Initialize logger
+	level := cfg.Logging.Level
+	if *logLevel != "" {
+		level = *logLevel
 	}
+	logger, err := logger.NewLogger(level)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	defer logger.Sync()
 
-	// Handle graceful shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
-
-	// Cleanup
-	cancel()
-	if err := clipService.Stop(); err != nil {
-		log.Printf("Error during shutdown: %v", err)
+	switch command {
+	case "serve":
+		return runServe(cfg, configPath, args)
+	case "poll-once":
+		return runPollOnce(cfg, args)
+	case "backfill":
+		return runBackfill(cfg, args)
+	case "search":
+		return runSearch(cfg, args)
+	case "export":
+		return runExport(cfg, args)
+	case "import":
+		return runImport(cfg, args)
+	case "migrate":
+		return runMigrate(cfg, args)
+	case "webhook":
+		return runWebhook(cfg, args)
+	case "outbox":
+		return runOutbox(cfg, args)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", command)
+		flag.Usage()
+		return 2
 	}
 }
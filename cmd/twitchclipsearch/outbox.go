@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"twitchclipsearch/internal/config"
+	"twitchclipsearch/internal/database"
+)
+
+const outboxUsage = `usage: twitchclipsearch outbox <command>
+
+commands:
+  list [-status dead|pending] [-limit n]   list queued Discord notifications,
+                                           dead letters by default
+  retry <id>...                            deliver dead letters again
+  discard <id>...                          drop dead letters
+
+A running server picks up retried notifications within a few seconds.`
+
+// runOutbox implements the outbox subcommand and returns the process exit code
+func runOutbox(cfg *config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, outboxUsage)
+		return 2
+	}
+
+	switch args[0] {
+	case "list":
+		return runOutboxList(cfg, args[1:])
+	case "retry":
+		return runOutboxAction(cfg, args[1:], "retried", func(db database.ClipStore, id int64) error {
+			return db.RetryNotification(id, time.Now())
+		})
+	case "discard":
+		return runOutboxAction(cfg, args[1:], "discarded", func(db database.ClipStore, id int64) error {
+			return db.DiscardNotification(id)
+		})
+	default:
+		fmt.Fprintln(os.Stderr, outboxUsage)
+		return 2
+	}
+}
+
+// runOutboxList prints the notifications with one status
+func runOutboxList(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("outbox list", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, outboxUsage)
+		flags.PrintDefaults()
+	}
+	status := flags.String("status", string(database.NotificationDead), "dead or pending")
+	limit := flags.Int("limit", 50, "maximum number of notifications to list")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 0 || *limit <= 0 ||
+		(*status != string(database.NotificationDead) && *status != string(database.NotificationPending)) {
+		flags.Usage()
+		return 2
+	}
+
+	db, err := database.Connect(cfg.Database)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	notifications, err := db.ListNotifications(database.NotificationStatus(*status), *limit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to list notifications: %v\n", err)
+		return 1
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTREAMER\tCLIP\tATTEMPTS\tNEXT ATTEMPT\tLAST ERROR")
+	for _, notification := range notifications {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\t%s\n", notification.ID, notification.Clip.StreamerName,
+			notification.ClipID, notification.Attempts, notification.NextAttemptAt.UTC().Format(time.RFC3339), notification.LastError)
+	}
+	w.Flush()
+
+	if len(notifications) == 0 {
+		fmt.Fprintf(os.Stderr, "No %s notifications\n", *status)
+	}
+	return 0
+}
+
+// runOutboxAction applies action to the dead letters whose IDs are given,
+// carrying on past the ones that fail
+func runOutboxAction(cfg *config.Config, args []string, done string, action func(db database.ClipStore, id int64) error) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, outboxUsage)
+		return 2
+	}
+	ids := make([]int64, len(args))
+	for i, arg := range args {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || id <= 0 {
+			fmt.Fprintf(os.Stderr, "invalid notification id %q\n", arg)
+			return 2
+		}
+		ids[i] = id
+	}
+
+	db, err := database.Connect(cfg.Database)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	code := 0
+	for _, id := range ids {
+		err := action(db, id)
+		switch {
+		case errors.Is(err, database.ErrNotificationNotFound):
+			fmt.Fprintf(os.Stderr, "%d: not a dead letter\n", id)
+			code = 1
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "%d: %v\n", id, err)
+			code = 1
+		default:
+			fmt.Printf("%d: %s\n", id, done)
+		}
+	}
+	return code
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"twitchclipsearch/internal/config"
+	"twitchclipsearch/internal/database"
+	"twitchclipsearch/internal/service"
+)
+
+const pollOnceUsage = `usage: twitchclipsearch poll-once [flags] <streamer>
+
+Checks a streamer for clips created since the newest stored one, saves them
+and posts them to the streamer's webhook.
+
+flags:`
+
+// runPollOnce implements the poll-once subcommand and returns the process exit code
+func runPollOnce(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("poll-once", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, pollOnceUsage)
+		flags.PrintDefaults()
+	}
+	noNotify := flags.Bool("no-notify", false, "do not post new clips to Discord")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	streamerName := flags.Arg(0)
+
+	clipService, db, code := openService(cfg)
+	if clipService == nil {
+		return code
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	result, err := clipService.PollOnce(ctx, streamerName, !*noNotify)
+	if result != nil {
+		fmt.Printf("%s: fetched %d clip(s), saved %d new\n", streamerName, result.Fetched, result.Saved)
+		if result.Truncated {
+			fmt.Fprintf(os.Stderr, "%s: stopped at the page limit, run backfill for older clips\n", streamerName)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Poll of %s failed: %v\n", streamerName, err)
+		return 1
+	}
+
+	return 0
+}
+
+// openService connects to the database and creates a clip service that
+// knows the streamers added through the API. On failure it reports the error
+// and returns a nil service with the process exit code.
+func openService(cfg *config.Config) (*service.ClipService, database.ClipStore, int) {
+	db, err := database.Connect(cfg.Database)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize database: %v\n", err)
+		return nil, nil, 1
+	}
+
+	clipService, err := service.NewClipService(cfg, db)
+	if err != nil {
+		db.Close()
+		fmt.Fprintf(os.Stderr, "Failed to create clip service: %v\n", err)
+		return nil, nil, 1
+	}
+	if err := clipService.LoadStreamers(); err != nil {
+		db.Close()
+		fmt.Fprintf(os.Stderr, "Failed to load monitored streamers: %v\n", err)
+		return nil, nil, 1
+	}
+
+	return clipService, db, 0
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"twitchclipsearch/internal/config"
+	"twitchclipsearch/internal/database"
+)
+
+const searchUsage = `usage: twitchclipsearch search [flags] <query>
+
+Searches clip titles, best matches first. Words must all match, "quoted
+words" match as a phrase and a trailing * matches a prefix.
+
+flags:`
+
+// runSearch implements the search subcommand and returns the process exit code
+func runSearch(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("search", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, searchUsage)
+		flags.PrintDefaults()
+	}
+	limit := flags.Int("limit", 20, "maximum number of clips to list")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	query := strings.Join(flags.Args(), " ")
+	if strings.TrimSpace(query) == "" || *limit <= 0 {
+		flags.Usage()
+		return 2
+	}
+
+	db, err := database.Connect(cfg.Database)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	results, err := db.SearchClips(query, *limit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Search failed: %v\n", err)
+		return 1
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CREATED\tSTREAMER\tVIEWS\tTITLE\tURL")
+	for _, result := range results {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", result.CreatedAt.UTC().Format(time.DateOnly),
+			result.StreamerName, result.ViewCount, result.Title, result.URL)
+	}
+	w.Flush()
+
+	if len(results) == 0 {
+		fmt.Fprintln(os.Stderr, "No clips found")
+	}
+	return 0
+}
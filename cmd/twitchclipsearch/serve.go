@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"twitchclipsearch/internal/api/server"
+	"twitchclipsearch/internal/config"
+	"twitchclipsearch/internal/database"
+	"twitchclipsearch/internal/metrics"
+	"twitchclipsearch/internal/service"
+)
+
+// shutdownTimeout bounds how long in-flight HTTP requests may take to finish
+const shutdownTimeout = 15 * time.Second
+
+const serveUsage = `usage: twitchclipsearch serve
+
+Monitors the configured streamers and serves the HTTP API until interrupted.
+SIGHUP reloads the configuration.`
+
+// runServe implements the serve subcommand and returns the process exit code
+func runServe(cfg *config.Config, configPath string, args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, serveUsage)
+		return 2
+	}
+
+	// Initialize metrics
+	metrics.InitMetrics()
+
+	// Initialize database
+	db, err := database.Connect(cfg.Database)
+	if err != nil {
+		log.Printf("Failed to initialize database: %v", err)
+		return 1
+	}
+	defer db.Close()
+
+	// Create clip service
+	clipService, err := service.NewClipService(cfg, db)
+	if err != nil {
+		log.Printf("Failed to create clip service: %v", err)
+		return 1
+	}
+
+	// Setup context with cancellation
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Start service
+	if err := clipService.Start(ctx); err != nil {
+		log.Printf("Failed to start service: %v", err)
+		return 1
+	}
+
+	// Start HTTP API server
+	apiServer := server.New(cfg, db, clipService)
+	if err := apiServer.Start(); err != nil {
+		log.Printf("Failed to start HTTP server: %v", err)
+		clipService.Stop()
+		return 1
+	}
+
+	// Reload the configuration on SIGHUP and, if enabled, when the file changes
+	reload := func() {
+		next, err := config.LoadFile(configPath)
+		if err == nil {
+			err = clipService.Reload(next)
+		}
+		if err != nil {
+			log.Printf("Rejected configuration reload, keeping the current configuration: %v", err)
+		}
+	}
+	if cfg.Reload.Watch {
+		interval := time.Duration(cfg.Reload.WatchIntervalSecs) * time.Second
+		go config.Watch(ctx, configPath, interval, reload)
+	}
+
+	// Handle graceful shutdown
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range sigChan {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		log.Printf("Received SIGHUP, reloading %s", configPath)
+		reload()
+	}
+
+	// Cleanup: stop taking requests first, then drain the clip service
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer shutdownCancel()
+	if err := apiServer.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error shutting down HTTP server: %v", err)
+	}
+
+	cancel()
+	if err := clipService.Stop(); err != nil {
+		log.Printf("Error during shutdown: %v", err)
+	}
+
+	return 0
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"twitchclipsearch/internal/config"
+)
+
+const webhookUsage = `usage: twitchclipsearch webhook <command>
+
+commands:
+  test <streamer> [destination]      post the newest stored clip of a streamer,
+                                     or a sample clip, to each of their
+                                     webhooks or only to the one named
+  preview <streamer> [destination]   print the JSON that test would post to
+                                     the destination, the first by default,
+                                     without sending it
+
+Destinations are named by their name setting or by their number, e.g. 2.`
+
+// runWebhook implements the webhook subcommand and returns the process exit code
+func runWebhook(cfg *config.Config, args []string) int {
+	if len(args) < 2 || len(args) > 3 || (args[0] != "test" && args[0] != "preview") {
+		fmt.Fprintln(os.Stderr, webhookUsage)
+		return 2
+	}
+	command, streamerName, destination := args[0], args[1], ""
+	if len(args) == 3 {
+		destination = args[2]
+	}
+
+	clipService, db, code := openService(cfg)
+	if clipService == nil {
+		return code
+	}
+	defer db.Close()
+
+	if command == "preview" {
+		msg, err := clipService.PreviewMessage(streamerName, destination)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Preview for %s failed: %v\n", streamerName, err)
+			return 1
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(msg); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to encode message: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	if err := clipService.TestWebhook(streamerName, destination); err != nil {
+		fmt.Fprintf(os.Stderr, "Webhook test for %s failed: %v\n", streamerName, err)
+		return 1
+	}
+
+	fmt.Printf("%s: webhook delivered\n", streamerName)
+	return 0
+}
@@ -3,13 +3,16 @@ module twitchclipsearch
 go 1.21
 
 require (
+	github.com/go-chi/chi/v5 v5.0.12
 	github.com/go-yaml/yaml v2.1.0+incompatible
 	github.com/google/uuid v1.6.0
+	github.com/lib/pq v1.10.9
 	github.com/mattn/go-sqlite3 v1.14.18
 	github.com/nicklaw5/helix/v2 v2.25.1
 	github.com/prometheus/client_golang v1.17.0
 	go.uber.org/zap v1.26.0
 	golang.org/x/time v0.5.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
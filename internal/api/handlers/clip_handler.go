@@ -2,9 +2,11 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"time"
-	"strings"
 
 	"twitchclipsearch/internal/database"
 	"twitchclipsearch/internal/logger"
@@ -12,21 +14,71 @@ import (
 
 // ClipHandler handles HTTP requests related to clips
 type ClipHandler struct {
-	db *database.DB
+	db database.ClipStore
 }
 
 // NewClipHandler creates a new instance of ClipHandler
-func NewClipHandler(db *database.DB) *ClipHandler {
+func NewClipHandler(db database.ClipStore) *ClipHandler {
 	return &ClipHandler{db: db}
 }
 
 // ClipResponse represents the JSON response for clip endpoints
 type ClipResponse struct {
-	ID           string    `json:"id"`
-	StreamerName string    `json:"streamer_name"`
-	Title        string    `json:"title"`
-	URL          string    `json:"url"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID            string    `json:"id"`
+	StreamerName  string    `json:"streamer_name"`
+	BroadcasterID string    `json:"broadcaster_id,omitempty"`
+	Title         string    `json:"title"`
+	URL           string    `json:"url"`
+	EmbedURL      string    `json:"embed_url,omitempty"`
+	ThumbnailURL  string    `json:"thumbnail_url,omitempty"`
+	CreatorID     string    `json:"creator_id,omitempty"`
+	CreatorName   string    `json:"creator_name,omitempty"`
+	GameID        string    `json:"game_id,omitempty"`
+	VideoID       string    `json:"video_id,omitempty"`
+	Language      string    `json:"language,omitempty"`
+	ViewCount     int       `json:"view_count"`
+	Duration      float64   `json:"duration"`
+	VodOffset     int       `json:"vod_offset,omitempty"`
+	StreamID      string    `json:"stream_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	PostedAt      time.Time `json:"posted_at"`
+	Snippet       string    `json:"snippet,omitempty"`
+	Score         float64   `json:"score,omitempty"`
+}
+
+// newClipResponse converts a stored clip to its JSON representation
+func newClipResponse(clip *database.Clip) ClipResponse {
+	return ClipResponse{
+		ID:            clip.ID,
+		StreamerName:  clip.StreamerName,
+		BroadcasterID: clip.BroadcasterID,
+		Title:         clip.Title,
+		URL:           clip.URL,
+		EmbedURL:      clip.EmbedURL,
+		ThumbnailURL:  clip.ThumbnailURL,
+		CreatorID:     clip.CreatorID,
+		CreatorName:   clip.CreatorName,
+		GameID:        clip.GameID,
+		VideoID:       clip.VideoID,
+		Language:      clip.Language,
+		ViewCount:     clip.ViewCount,
+		Duration:      clip.Duration,
+		VodOffset:     clip.VodOffset,
+		StreamID:      clip.StreamID,
+		CreatedAt:     clip.CreatedAt,
+		PostedAt:      clip.PostedAt,
+	}
+}
+
+const (
+	defaultLimit = 50
+	maxLimit     = 100
+)
+
+// ClipListResponse represents a page of clips
+type ClipListResponse struct {
+	Clips      []ClipResponse `json:"clips"`
+	NextCursor string         `json:"next_cursor,omitempty"`
 }
 
 // ErrorResponse represents an error response
@@ -34,33 +86,108 @@ type ErrorResponse struct {
 	Error string `json:"error"`
 }
 
-// GetClips handles requests to retrieve clips
+// writeError writes a JSON error response with the given status code
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: message})
+}
+
+// parseLimit reads the limit query parameter, capping it at maxLimit
+func parseLimit(r *http.Request) (int, error) {
+	raw := r.URL.Query().Get("limit")
+	if raw == "" {
+		return defaultLimit, nil
+	}
+
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid limit %q", raw)
+	}
+	if n > maxLimit {
+		n = maxLimit
+	}
+	return n, nil
+}
+
+// parseClipQuery reads the filter, sort and paging parameters of GET /clips
+func parseClipQuery(r *http.Request) (database.ClipQuery, error) {
+	params := r.URL.Query()
+
+	query := database.ClipQuery{
+		StreamerName: params.Get("streamer"),
+		GameID:       params.Get("game"),
+		StreamID:     params.Get("stream"),
+		CreatorName:  params.Get("creator"),
+		Cursor:       params.Get("cursor"),
+		Sort:         database.SortCreated,
+	}
+
+	limit, err := parseLimit(r)
+	if err != nil {
+		return query, err
+	}
+	query.Limit = limit
+
+	for name, dest := range map[string]*time.Time{"since": &query.Since, "until": &query.Until} {
+		if raw := params.Get(name); raw != "" {
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return query, fmt.Errorf("invalid %s %q, expected RFC 3339 time", name, raw)
+			}
+			*dest = t
+		}
+	}
+
+	if raw := params.Get("min_views"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return query, fmt.Errorf("invalid min_views %q", raw)
+		}
+		query.MinViews = n
+	}
+
+	if raw := params.Get("sort"); raw != "" {
+		switch sort := database.ClipSort(raw); sort {
+		case database.SortCreated, database.SortViews, database.SortPosted:
+			query.Sort = sort
+		default:
+			return query, fmt.Errorf("invalid sort %q, expected created, views or posted", raw)
+		}
+	}
+
+	return query, nil
+}
+
+// GetClips handles requests to retrieve a filtered page of clips
 func (h *ClipHandler) GetClips(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// Get query parameters
-	streamer := r.URL.Query().Get("streamer")
-	limit := 50 // Default limit
+	query, err := parseClipQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	// Get clips from database
-	clips, err := h.db.GetClips(streamer, limit)
+	page, err := h.db.GetClips(query)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		writeError(w, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
 	if err != nil {
 		logger.Error("Failed to get clips", "error", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Failed to retrieve clips"})
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve clips")
 		return
 	}
 
 	// Convert to response format
-	response := make([]ClipResponse, len(clips))
-	for i, clip := range clips {
-		response[i] = ClipResponse{
-			ID:           clip.ID,
-			StreamerName: clip.StreamerName,
-			Title:        clip.Title,
-			URL:          clip.URL,
-			CreatedAt:    clip.CreatedAt,
-		}
+	response := ClipListResponse{
+		Clips:      make([]ClipResponse, len(page.Clips)),
+		NextCursor: page.NextCursor,
+	}
+	for i, clip := range page.Clips {
+		response.Clips[i] = newClipResponse(clip)
 	}
 
 	json.NewEncoder(w).Encode(response)
@@ -73,30 +200,30 @@ func (h *ClipHandler) SearchClips(w http.ResponseWriter, r *http.Request) {
 	// Get query parameters
 	query := r.URL.Query().Get("q")
 	if query == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Search query is required"})
+		writeError(w, http.StatusBadRequest, "Search query is required")
 		return
 	}
 
-	// Search clips in database
-	clips, err := h.db.SearchClips(strings.ToLower(query))
+	limit, err := parseLimit(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Search clips in database, best matches first
+	results, err := h.db.SearchClips(query, limit)
 	if err != nil {
 		logger.Error("Failed to search clips", "error", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Failed to search clips"})
+		writeError(w, http.StatusInternalServerError, "Failed to search clips")
 		return
 	}
 
 	// Convert to response format
-	response := make([]ClipResponse, len(clips))
-	for i, clip := range clips {
-		response[i] = ClipResponse{
-			ID:           clip.ID,
-			StreamerName: clip.StreamerName,
-			Title:        clip.Title,
-			URL:          clip.URL,
-			CreatedAt:    clip.CreatedAt,
-		}
+	response := make([]ClipResponse, len(results))
+	for i, result := range results {
+		response[i] = newClipResponse(&result.Clip)
+		response[i].Snippet = result.Snippet
+		response[i].Score = result.Score
 	}
 
 	json.NewEncoder(w).Encode(response)
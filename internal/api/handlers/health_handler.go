@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"twitchclipsearch/internal/database"
+	"twitchclipsearch/internal/logger"
+)
+
+// HealthHandler reports whether the service and its dependencies are usable
+type HealthHandler struct {
+	db database.ClipStore
+}
+
+// NewHealthHandler creates a new instance of HealthHandler
+func NewHealthHandler(db database.ClipStore) *HealthHandler {
+	return &HealthHandler{db: db}
+}
+
+// HealthResponse represents the JSON response for the health endpoint
+type HealthResponse struct {
+	Status   string `json:"status"`
+	Database string `json:"database"`
+}
+
+// Health handles health check requests
+func (h *HealthHandler) Health(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	response := HealthResponse{Status: "ok", Database: "ok"}
+	if err := h.db.Ping(); err != nil {
+		logger.Error("Health check failed", "error", err)
+		response = HealthResponse{Status: "unavailable", Database: "unreachable"}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
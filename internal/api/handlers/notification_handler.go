@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"twitchclipsearch/internal/database"
+	"twitchclipsearch/internal/logger"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// NotificationManager inspects the Discord notification outbox and handles
+// its dead letters
+type NotificationManager interface {
+	Notifications(status database.NotificationStatus, limit int) ([]*database.Notification, error)
+	RetryNotification(id int64) error
+	DiscardNotification(id int64) error
+}
+
+// NotificationHandler handles HTTP requests for queued Discord notifications
+type NotificationHandler struct {
+	notifications NotificationManager
+}
+
+// NewNotificationHandler creates a new instance of NotificationHandler
+func NewNotificationHandler(notifications NotificationManager) *NotificationHandler {
+	return &NotificationHandler{notifications: notifications}
+}
+
+// NotificationResponse represents a queued notification
+type NotificationResponse struct {
+	ID            int64        `json:"id"`
+	Status        string       `json:"status"`
+	Attempts      int          `json:"attempts"`
+	LastError     string       `json:"last_error,omitempty"`
+	NextAttemptAt time.Time    `json:"next_attempt_at"`
+	CreatedAt     time.Time    `json:"created_at"`
+	UpdatedAt     time.Time    `json:"updated_at"`
+	Clip          ClipResponse `json:"clip"`
+}
+
+// NotificationListResponse represents the notifications with one status
+type NotificationListResponse struct {
+	Notifications []NotificationResponse `json:"notifications"`
+}
+
+// newNotificationResponse converts a notification to its JSON
+// representation. The webhook URL is left out, as it holds the webhook's
+// token.
+func newNotificationResponse(notification *database.Notification) NotificationResponse {
+	return NotificationResponse{
+		ID:            notification.ID,
+		Status:        string(notification.Status),
+		Attempts:      notification.Attempts,
+		LastError:     notification.LastError,
+		NextAttemptAt: notification.NextAttemptAt,
+		CreatedAt:     notification.CreatedAt,
+		UpdatedAt:     notification.UpdatedAt,
+		Clip:          newClipResponse(notification.Clip),
+	}
+}
+
+// parseNotificationID reads the id path parameter
+func parseNotificationID(r *http.Request) (int64, error) {
+	raw := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid notification id %q", raw)
+	}
+	return id, nil
+}
+
+// writeNotificationError maps outbox errors to status codes
+func writeNotificationError(w http.ResponseWriter, err error, action string) {
+	if errors.Is(err, database.ErrNotificationNotFound) {
+		writeError(w, http.StatusNotFound, "Notification is not a dead letter")
+		return
+	}
+	logger.Error("Failed to "+action+" notification", "error", err)
+	writeError(w, http.StatusInternalServerError, "Failed to "+action+" notification")
+}
+
+// ListNotifications handles requests for the dead letters, or with
+// ?status=pending the notifications waiting for delivery
+func (h *NotificationHandler) ListNotifications(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	status := database.NotificationStatus(r.URL.Query().Get("status"))
+	switch status {
+	case "":
+		status = database.NotificationDead
+	case database.NotificationDead, database.NotificationPending:
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid status %q, expected dead or pending", status))
+		return
+	}
+	limit, err := parseLimit(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	notifications, err := h.notifications.Notifications(status, limit)
+	if err != nil {
+		writeNotificationError(w, err, "list")
+		return
+	}
+
+	response := NotificationListResponse{Notifications: make([]NotificationResponse, len(notifications))}
+	for i, notification := range notifications {
+		response.Notifications[i] = newNotificationResponse(notification)
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// RetryNotification handles requests to deliver a dead letter again
+func (h *NotificationHandler) RetryNotification(w http.ResponseWriter, r *http.Request) {
+	h.apply(w, r, h.notifications.RetryNotification, "retry")
+}
+
+// DiscardNotification handles requests to drop a dead letter
+func (h *NotificationHandler) DiscardNotification(w http.ResponseWriter, r *http.Request) {
+	h.apply(w, r, h.notifications.DiscardNotification, "discard")
+}
+
+// apply runs an action on the notification named by the request
+func (h *NotificationHandler) apply(w http.ResponseWriter, r *http.Request, action func(id int64) error, name string) {
+	id, err := parseNotificationID(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := action(id); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		writeNotificationError(w, err, name)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
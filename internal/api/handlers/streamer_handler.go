@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"twitchclipsearch/internal/logger"
+	"twitchclipsearch/internal/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxRequestBody bounds the JSON bodies the API accepts
+const maxRequestBody = 1 << 16
+
+// StreamerManager adds, changes and removes monitored streamers at runtime
+type StreamerManager interface {
+	Streamers() []service.MonitoredStreamer
+	AddStreamer(ctx context.Context, login, webhookURL string) (*service.MonitoredStreamer, error)
+	UpdateStreamer(login string, update service.StreamerUpdate) (*service.MonitoredStreamer, error)
+	RemoveStreamer(login string) error
+}
+
+// StreamerHandler handles HTTP requests that manage monitored streamers
+type StreamerHandler struct {
+	streamers StreamerManager
+}
+
+// NewStreamerHandler creates a new instance of StreamerHandler
+func NewStreamerHandler(streamers StreamerManager) *StreamerHandler {
+	return &StreamerHandler{streamers: streamers}
+}
+
+// StreamerResponse represents a monitored streamer
+type StreamerResponse struct {
+	Login string `json:"login"`
+	// WebhookURL is the first of WebhookURLs
+	WebhookURL string `json:"webhook_url"`
+	// WebhookURLs lists every destination of the streamer
+	WebhookURLs []string `json:"webhook_urls"`
+	Paused      bool     `json:"paused"`
+	// Source is "config" for streamers from the configuration file, which
+	// cannot be changed through the API, and "api" for the rest
+	Source string `json:"source"`
+}
+
+// StreamerListResponse represents every monitored streamer
+type StreamerListResponse struct {
+	Streamers []StreamerResponse `json:"streamers"`
+}
+
+// CreateStreamerRequest is the body of POST /streamers
+type CreateStreamerRequest struct {
+	Login      string `json:"login"`
+	WebhookURL string `json:"webhook_url"`
+}
+
+// UpdateStreamerRequest is the body of PATCH /streamers/{login}; omitted
+// fields are left alone
+type UpdateStreamerRequest struct {
+	WebhookURL *string `json:"webhook_url"`
+	Paused     *bool   `json:"paused"`
+}
+
+// newStreamerResponse converts a monitored streamer to its JSON representation
+func newStreamerResponse(streamer service.MonitoredStreamer) StreamerResponse {
+	return StreamerResponse{
+		Login:       streamer.Login,
+		WebhookURL:  streamer.WebhookURL,
+		WebhookURLs: streamer.WebhookURLs,
+		Paused:      streamer.Paused,
+		Source:      streamer.Source,
+	}
+}
+
+// decodeBody reads a JSON request body into v, rejecting unknown fields
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// writeStreamerError maps service errors to status codes
+func writeStreamerError(w http.ResponseWriter, err error, action string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidWebhookURL):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrStreamerNotMonitored):
+		writeError(w, http.StatusNotFound, "Streamer is not monitored")
+	case errors.Is(err, service.ErrStreamerExists), errors.Is(err, service.ErrConfigStreamer):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, service.ErrStreamerNotFound):
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+	default:
+		logger.Error("Failed to "+action+" streamer", "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to "+action+" streamer")
+	}
+}
+
+// ListStreamers handles requests for every monitored streamer
+func (h *StreamerHandler) ListStreamers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	streamers := h.streamers.Streamers()
+	response := StreamerListResponse{Streamers: make([]StreamerResponse, len(streamers))}
+	for i, streamer := range streamers {
+		response.Streamers[i] = newStreamerResponse(streamer)
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetStreamer handles requests for one monitored streamer
+func (h *StreamerHandler) GetStreamer(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	login := strings.ToLower(chi.URLParam(r, "login"))
+	for _, streamer := range h.streamers.Streamers() {
+		if streamer.Login == login {
+			json.NewEncoder(w).Encode(newStreamerResponse(streamer))
+			return
+		}
+	}
+
+	writeError(w, http.StatusNotFound, "Streamer is not monitored")
+}
+
+// CreateStreamer handles requests to start monitoring a streamer
+func (h *StreamerHandler) CreateStreamer(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var request CreateStreamerRequest
+	if err := decodeBody(w, r, &request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if strings.TrimSpace(request.Login) == "" {
+		writeError(w, http.StatusBadRequest, "Streamer login is required")
+		return
+	}
+
+	streamer, err := h.streamers.AddStreamer(r.Context(), request.Login, request.WebhookURL)
+	if err != nil {
+		writeStreamerError(w, err, "add")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newStreamerResponse(*streamer))
+}
+
+// UpdateStreamer handles requests to change a streamer's webhook or to pause
+// or resume monitoring them
+func (h *StreamerHandler) UpdateStreamer(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var request UpdateStreamerRequest
+	if err := decodeBody(w, r, &request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	streamer, err := h.streamers.UpdateStreamer(chi.URLParam(r, "login"), service.StreamerUpdate{
+		WebhookURL: request.WebhookURL,
+		Paused:     request.Paused,
+	})
+	if err != nil {
+		writeStreamerError(w, err, "update")
+		return
+	}
+
+	json.NewEncoder(w).Encode(newStreamerResponse(*streamer))
+}
+
+// DeleteStreamer handles requests to stop monitoring a streamer
+func (h *StreamerHandler) DeleteStreamer(w http.ResponseWriter, r *http.Request) {
+	if err := h.streamers.RemoveStreamer(chi.URLParam(r, "login")); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		writeStreamerError(w, err, "remove")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,139 @@
+// Package server wires the HTTP handlers and middleware into the API server
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"twitchclipsearch/internal/api/handlers"
+	"twitchclipsearch/internal/api/middleware"
+	"twitchclipsearch/internal/config"
+	"twitchclipsearch/internal/database"
+	"twitchclipsearch/internal/eventsub"
+	"twitchclipsearch/internal/logger"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// APIPrefix is the path under which all API routes are mounted
+const APIPrefix = "/api/v1"
+
+// Monitor is the part of the clip service driven through the API
+type Monitor interface {
+	handlers.StreamerManager
+	handlers.NotificationManager
+	// HandleEvent reacts to a verified EventSub notification
+	HandleEvent(event eventsub.Event)
+}
+
+// Server is the HTTP API server
+type Server struct {
+	httpServer *http.Server
+	listener   net.Listener
+}
+
+// New creates a server for the given configuration, store and clip monitor
+func New(cfg *config.Config, db database.ClipStore, monitor Monitor) *Server {
+	return &Server{
+		httpServer: &http.Server{
+			Addr:         fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port),
+			Handler:      NewRouter(cfg, db, monitor),
+			ReadTimeout:  cfg.Server.ReadTimeout,
+			WriteTimeout: cfg.Server.WriteTimeout,
+		},
+	}
+}
+
+// NewRouter builds the HTTP routes with the standard middleware chain
+func NewRouter(cfg *config.Config, db database.ClipStore, monitor Monitor) http.Handler {
+	clipHandler := handlers.NewClipHandler(db)
+	healthHandler := handlers.NewHealthHandler(db)
+
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID, middleware.Logger, middleware.Recover)
+
+	// Unversioned alias for load balancer and Kubernetes probes
+	r.Get("/health", healthHandler.Health)
+
+	r.Route(APIPrefix, func(r chi.Router) {
+		r.Get("/health", healthHandler.Health)
+		r.Get("/clips", clipHandler.GetClips)
+		r.Get("/clips/search", clipHandler.SearchClips)
+
+		if cfg.Metrics.Enabled {
+			endpoint := cfg.Metrics.Endpoint
+			if endpoint == "" {
+				endpoint = "/metrics"
+			}
+			r.Handle("/"+strings.TrimPrefix(endpoint, "/"), promhttp.Handler())
+		}
+
+		// Changing the service requires the admin token
+		if cfg.Server.AdminToken == "" {
+			logger.Warn("No admin token is set, not mounting the streamer and notification management routes")
+		} else {
+			streamerHandler := handlers.NewStreamerHandler(monitor)
+			r.Route("/streamers", func(r chi.Router) {
+				r.Use(middleware.BearerToken(cfg.Server.AdminToken))
+				r.Get("/", streamerHandler.ListStreamers)
+				r.Post("/", streamerHandler.CreateStreamer)
+				r.Get("/{login}", streamerHandler.GetStreamer)
+				r.Patch("/{login}", streamerHandler.UpdateStreamer)
+				r.Delete("/{login}", streamerHandler.DeleteStreamer)
+			})
+
+			notificationHandler := handlers.NewNotificationHandler(monitor)
+			r.Route("/notifications", func(r chi.Router) {
+				r.Use(middleware.BearerToken(cfg.Server.AdminToken))
+				r.Get("/", notificationHandler.ListNotifications)
+				r.Post("/{id}/retry", notificationHandler.RetryNotification)
+				r.Delete("/{id}", notificationHandler.DiscardNotification)
+			})
+		}
+
+		if cfg.Twitch.EventSub.Enabled {
+			if cfg.Twitch.EventSub.Secret == "" {
+				logger.Warn("EventSub is enabled without a secret, not mounting the callback")
+			} else {
+				r.Method(http.MethodPost, "/eventsub", eventsub.NewHandler(cfg.Twitch.EventSub.Secret, monitor.HandleEvent))
+			}
+		}
+	})
+
+	return r
+}
+
+// Start binds the listen address and serves requests in the background
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.httpServer.Addr, err)
+	}
+	s.listener = listener
+
+	go func() {
+		if err := s.httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logger.Error("HTTP server stopped unexpectedly", "error", err)
+		}
+	}()
+
+	logger.Info("HTTP server listening", "addr", listener.Addr().String())
+	return nil
+}
+
+// Addr returns the address the server is listening on
+func (s *Server) Addr() string {
+	if s.listener == nil {
+		return s.httpServer.Addr
+	}
+	return s.listener.Addr().String()
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.httpServer.Shutdown(ctx)
+}
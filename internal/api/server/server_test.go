@@ -0,0 +1,253 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"twitchclipsearch/internal/config"
+	"twitchclipsearch/internal/database"
+	"twitchclipsearch/internal/service"
+)
+
+// fakeStore implements the parts of database.ClipStore the routes use
+type fakeStore struct {
+	database.ClipStore
+	pingErr error
+}
+
+func (f *fakeStore) Ping() error {
+	return f.pingErr
+}
+
+func (f *fakeStore) GetClips(query database.ClipQuery) (*database.ClipPage, error) {
+	return &database.ClipPage{Clips: []*database.Clip{{ID: "a", StreamerName: query.StreamerName, CreatedAt: time.Now()}}}, nil
+}
+
+func (f *fakeStore) SearchClips(query string, limit int) ([]*database.SearchResult, error) {
+	return nil, nil
+}
+
+func TestRouter(t *testing.T) {
+	cfg := &config.Config{Metrics: config.MetricsConfig{Enabled: true, Endpoint: "/metrics"}}
+	store := &fakeStore{}
+	router := NewRouter(cfg, store, nil)
+
+	tests := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{http.MethodGet, "/health", http.StatusOK},
+		{http.MethodGet, "/api/v1/health", http.StatusOK},
+		{http.MethodGet, "/api/v1/clips?streamer=shroud", http.StatusOK},
+		{http.MethodGet, "/api/v1/clips/search?q=ace", http.StatusOK},
+		{http.MethodGet, "/api/v1/clips/search", http.StatusBadRequest},
+		{http.MethodGet, "/api/v1/metrics", http.StatusOK},
+		{http.MethodPost, "/api/v1/clips", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/clips", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.path, tt.want, rec.Code)
+		}
+		if rec.Header().Get("X-Request-ID") == "" {
+			t.Errorf("%s %s: missing X-Request-ID header", tt.method, tt.path)
+		}
+	}
+
+	store.pingErr = errors.New("connection refused")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected unhealthy status %d, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+}
+
+// fakeMonitor manages streamers in memory
+type fakeMonitor struct {
+	Monitor
+	streamers map[string]service.MonitoredStreamer
+}
+
+func (f *fakeMonitor) Streamers() []service.MonitoredStreamer {
+	var streamers []service.MonitoredStreamer
+	for _, streamer := range f.streamers {
+		streamers = append(streamers, streamer)
+	}
+	return streamers
+}
+
+func (f *fakeMonitor) AddStreamer(ctx context.Context, login, webhookURL string) (*service.MonitoredStreamer, error) {
+	if login == "nobody" {
+		return nil, service.ErrStreamerNotFound
+	}
+	if _, ok := f.streamers[login]; ok {
+		return nil, service.ErrStreamerExists
+	}
+	streamer := service.MonitoredStreamer{Login: login, WebhookURL: webhookURL, Source: service.SourceAPI}
+	f.streamers[login] = streamer
+	return &streamer, nil
+}
+
+func (f *fakeMonitor) UpdateStreamer(login string, update service.StreamerUpdate) (*service.MonitoredStreamer, error) {
+	streamer, ok := f.streamers[login]
+	if !ok {
+		return nil, service.ErrStreamerNotMonitored
+	}
+	if update.Paused != nil {
+		streamer.Paused = *update.Paused
+	}
+	f.streamers[login] = streamer
+	return &streamer, nil
+}
+
+func (f *fakeMonitor) RemoveStreamer(login string) error {
+	if _, ok := f.streamers[login]; !ok {
+		return service.ErrStreamerNotMonitored
+	}
+	delete(f.streamers, login)
+	return nil
+}
+
+// fakeOutbox keeps dead letters in memory
+type fakeOutbox struct {
+	fakeMonitor
+	dead map[int64]*database.Notification
+}
+
+func (f *fakeOutbox) Notifications(status database.NotificationStatus, limit int) ([]*database.Notification, error) {
+	var notifications []*database.Notification
+	for _, notification := range f.dead {
+		if notification.Status == status {
+			notifications = append(notifications, notification)
+		}
+	}
+	return notifications, nil
+}
+
+func (f *fakeOutbox) RetryNotification(id int64) error {
+	notification, ok := f.dead[id]
+	if !ok || notification.Status != database.NotificationDead {
+		return database.ErrNotificationNotFound
+	}
+	notification.Status = database.NotificationPending
+	return nil
+}
+
+func (f *fakeOutbox) DiscardNotification(id int64) error {
+	if _, ok := f.dead[id]; !ok {
+		return database.ErrNotificationNotFound
+	}
+	delete(f.dead, id)
+	return nil
+}
+
+func TestNotificationRoutes(t *testing.T) {
+	cfg := &config.Config{Server: config.ServerConfig{AdminToken: "secret"}}
+	clip := &database.Clip{ID: "a", StreamerName: "shroud"}
+	monitor := &fakeOutbox{dead: map[int64]*database.Notification{
+		1: {ID: 1, Status: database.NotificationDead, WebhookURL: "https://discord.com/api/webhooks/1/token", Clip: clip},
+		2: {ID: 2, Status: database.NotificationDead, WebhookURL: "https://discord.com/api/webhooks/1/token", Clip: clip},
+	}}
+	router := NewRouter(cfg, &fakeStore{}, monitor)
+
+	tests := []struct {
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{http.MethodGet, "/api/v1/notifications", "", http.StatusUnauthorized},
+		{http.MethodGet, "/api/v1/notifications", "secret", http.StatusOK},
+		{http.MethodGet, "/api/v1/notifications?status=pending&limit=10", "secret", http.StatusOK},
+		{http.MethodGet, "/api/v1/notifications?status=delivered", "secret", http.StatusBadRequest},
+		{http.MethodPost, "/api/v1/notifications/1/retry", "secret", http.StatusNoContent},
+		{http.MethodPost, "/api/v1/notifications/1/retry", "secret", http.StatusNotFound},
+		{http.MethodPost, "/api/v1/notifications/one/retry", "secret", http.StatusBadRequest},
+		{http.MethodDelete, "/api/v1/notifications/2", "secret", http.StatusNoContent},
+		{http.MethodDelete, "/api/v1/notifications/2", "secret", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s %s: expected status %d, got %d: %s", tt.method, tt.path, tt.want, rec.Code, rec.Body)
+		}
+	}
+
+	// Webhook URLs hold their token and are not exposed
+	monitor.dead[3] = &database.Notification{ID: 3, Status: database.NotificationDead, WebhookURL: "https://discord.com/api/webhooks/1/token", Clip: clip}
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/notifications", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if body := rec.Body.String(); !strings.Contains(body, `"id":3`) || strings.Contains(body, "token") {
+		t.Errorf("Expected the dead letter without its webhook URL, got %s", body)
+	}
+}
+
+func TestStreamerRoutes(t *testing.T) {
+	cfg := &config.Config{Server: config.ServerConfig{AdminToken: "secret"}}
+	monitor := &fakeMonitor{streamers: make(map[string]service.MonitoredStreamer)}
+	router := NewRouter(cfg, &fakeStore{}, monitor)
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		token  string
+		want   int
+	}{
+		{http.MethodGet, "/api/v1/streamers", "", "", http.StatusUnauthorized},
+		{http.MethodGet, "/api/v1/streamers", "", "wrong", http.StatusUnauthorized},
+		{http.MethodPost, "/api/v1/streamers", `{"login": "shroud", "webhook_url": "https://discord.com/api/webhooks/1/a"}`, "secret", http.StatusCreated},
+		{http.MethodPost, "/api/v1/streamers", `{"login": "shroud", "webhook_url": "https://discord.com/api/webhooks/1/a"}`, "secret", http.StatusConflict},
+		{http.MethodPost, "/api/v1/streamers", `{"login": "nobody", "webhook_url": "https://discord.com/api/webhooks/1/a"}`, "secret", http.StatusUnprocessableEntity},
+		{http.MethodPost, "/api/v1/streamers", `{"webhook_url": "https://discord.com/api/webhooks/1/a"}`, "secret", http.StatusBadRequest},
+		{http.MethodPost, "/api/v1/streamers", `{"login": "shroud", "paused": true}`, "secret", http.StatusBadRequest},
+		{http.MethodGet, "/api/v1/streamers", "", "secret", http.StatusOK},
+		{http.MethodGet, "/api/v1/streamers/shroud", "", "secret", http.StatusOK},
+		{http.MethodGet, "/api/v1/streamers/pokimane", "", "secret", http.StatusNotFound},
+		{http.MethodPatch, "/api/v1/streamers/shroud", `{"paused": true}`, "secret", http.StatusOK},
+		{http.MethodPatch, "/api/v1/streamers/pokimane", `{"paused": true}`, "secret", http.StatusNotFound},
+		{http.MethodDelete, "/api/v1/streamers/shroud", "", "secret", http.StatusNoContent},
+		{http.MethodDelete, "/api/v1/streamers/shroud", "", "secret", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s %s: expected status %d, got %d: %s", tt.method, tt.path, tt.want, rec.Code, rec.Body)
+		}
+	}
+
+	if len(monitor.streamers) != 0 {
+		t.Errorf("Expected the streamer to be removed, got %+v", monitor.streamers)
+	}
+
+	// Without an admin token the routes are not mounted
+	router = NewRouter(&config.Config{}, &fakeStore{}, monitor)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/streamers", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected the routes to be missing without an admin token, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,308 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+	}
+
+	write("twitch:\n  check_interval_secs: 60\nserver:\n  read_timeout_seconds: 30\n")
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if cfg.Twitch.CheckIntervalSecs != 60 || cfg.Server.ReadTimeout != 30*time.Second {
+		t.Errorf("Unexpected config %+v", cfg)
+	}
+
+	// Every call reads the file again
+	write("twitch:\n  check_interval_secs: 120\n")
+	if cfg, err := LoadFile(path); err != nil || cfg.Twitch.CheckIntervalSecs != 120 {
+		t.Errorf("Expected the changed file to be read, got %+v (err: %v)", cfg, err)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"syntax", "twitch: [", "failed to parse"},
+		{"negative interval", "twitch:\n  check_interval_secs: -1\n", "twitch.check_interval_secs"},
+		{"missing webhook", "discord:\n  streamers:\n    shroud: \"\"\n", "discord.streamers.shroud"},
+		{"port", "server:\n  port: 70000\n", "server.port"},
+		{"unknown setting", "twitch:\n  check_interval: 60\n", "line 2: twitch.check_interval: unknown setting"},
+	}
+	for _, tt := range tests {
+		write(tt.content)
+		if _, err := LoadFile(path); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected an error mentioning %q, got %v", tt.name, tt.want, err)
+		}
+	}
+
+	write(`discord:
+  streamers:
+    shroud:
+      - webhook_url: "https://discord.com/api/webhooks/1/a"
+      - name: best-clips
+        webhook_url: "https://discord.com/api/webhooks/2/b"
+        min_views: 100
+        keywords: [clutch, ace]
+        template:
+          content: "Top clip!"
+`)
+	cfg, err = LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	destinations := cfg.Discord.Streamers["shroud"]
+	if len(destinations) != 2 || destinations[1].MinViews != 100 || len(destinations[1].Keywords) != 2 ||
+		destinations[0].Label(0) != "#1" || destinations[1].Label(1) != "best-clips" {
+		t.Errorf("Unexpected destinations %+v", destinations)
+	}
+	if spec := cfg.Discord.MessageTemplate("shroud", destinations[1]); spec.Content != "Top clip!" || spec.Title != "{{.Title}}" {
+		t.Errorf("Expected the destination's template over the default, got %+v", spec)
+	}
+
+	if _, err := LoadFile(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	_, err := Parse([]byte(`twitch:
+  check_interval_secs: -5
+  eventsub:
+    enabled: true
+    secret: short
+discord:
+  streamers:
+    shroud: "https://example.com/hook"
+    Bad-Login: "https://discord.com/api/webhooks/1/a"
+    local: "http://localhost:8080/webhook"
+  rate_limt: 1
+  template:
+    color: purple
+  templates:
+    shroud:
+      fields:
+        - name: Views
+          value: "{{.Views}}"
+server:
+  port: 70000
+logging:
+  level: verbose
+`))
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+
+	want := []Problem{
+		{Path: "twitch.check_interval_secs", Line: 2},
+		{Path: "twitch.eventsub.secret", Line: 5},
+		{Path: "discord.streamers.Bad-Login", Line: 9},
+		{Path: "discord.streamers.shroud", Line: 8},
+		{Path: "discord.rate_limt", Line: 11},
+		{Path: "discord.template.color", Line: 13},
+		{Path: "discord.templates.shroud.fields[0].value", Line: 18},
+		{Path: "server.port", Line: 20},
+		{Path: "logging.level", Line: 22},
+	}
+	got := make(map[string]int, len(invalid.Problems))
+	for _, p := range invalid.Problems {
+		got[p.Path] = p.Line
+	}
+	if len(invalid.Problems) != len(want) {
+		t.Errorf("Expected %d problems, got %v", len(want), invalid)
+	}
+	for _, p := range want {
+		if line, ok := got[p.Path]; !ok || line != p.Line {
+			t.Errorf("Expected a problem with %s on line %d, got %v", p.Path, p.Line, invalid)
+		}
+	}
+	for i := 1; i < len(invalid.Problems); i++ {
+		if invalid.Problems[i].Line < invalid.Problems[i-1].Line {
+			t.Errorf("Expected problems ordered by line, got %v", invalid)
+		}
+	}
+
+	// Settings missing from the file are reported at their section
+	_, err = Parse([]byte("twitch:\n  eventsub:\n    enabled: true\n"))
+	if !errors.As(err, &invalid) || invalid.Problems[0].Line != 2 {
+		t.Errorf("Expected the missing secret reported on line 2, got %v", err)
+	}
+
+	// Listed destinations are reported by position
+	_, err = Parse([]byte(`discord:
+  streamers:
+    shroud:
+      - name: all-clips
+        webhook_url: "https://discord.com/api/webhooks/1/a"
+      - webhook_url: "https://discord.com/api/webhooks/1/a"
+        min_views: -1
+        game: "33214"
+    pokimane: []
+`))
+	if !errors.As(err, &invalid) {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+	got = make(map[string]int, len(invalid.Problems))
+	for _, p := range invalid.Problems {
+		got[p.Path] = p.Line
+	}
+	for _, p := range []Problem{
+		{Path: "discord.streamers.shroud[1].webhook_url", Line: 6},
+		{Path: "discord.streamers.shroud[1].min_views", Line: 7},
+		{Path: "discord.streamers.shroud[1].game", Line: 8},
+		{Path: "discord.streamers.pokimane", Line: 9},
+	} {
+		if line, ok := got[p.Path]; !ok || line != p.Line {
+			t.Errorf("Expected a problem with %s on line %d, got %v", p.Path, p.Line, invalid)
+		}
+	}
+
+	for _, webhookURL := range []string{
+		"https://discord.com/api/webhooks/123/abc-DEF_1",
+		"https://canary.discord.com/api/v10/webhooks/123/abc",
+		"http://127.0.0.1:9000/hook",
+	} {
+		if err := CheckWebhookURL(webhookURL); err != nil {
+			t.Errorf("Expected %s to be accepted, got %v", webhookURL, err)
+		}
+	}
+	for _, webhookURL := range []string{"", "http://discord.com/api/webhooks/1/a", "https://discord.com/api/webhooks/x/a", "https://evil.com/api/webhooks/1/a"} {
+		if err := CheckWebhookURL(webhookURL); err == nil {
+			t.Errorf("Expected %q to be rejected", webhookURL)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("a: 1\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan struct{}, 10)
+	go Watch(ctx, path, 10*time.Millisecond, func() { changes <- struct{}{} })
+
+	// Give the watcher time to read the original content
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-changes:
+		t.Fatal("Expected no change before the file is written")
+	default:
+	}
+
+	if err := os.WriteFile(path, []byte("a: 2\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	select {
+	case <-changes:
+	case <-time.After(time.Second):
+		t.Fatal("Expected a change after the file was written")
+	}
+
+	// Rewriting the same content is not a change
+	if err := os.WriteFile(path, []byte("a: 2\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-changes:
+		t.Error("Expected no change for identical content")
+	default:
+	}
+}
+
+func TestEnvironment(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "client_secret")
+	if err := os.WriteFile(secret, []byte("s3cr3t: #1\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write secret: %v", err)
+	}
+
+	t.Setenv("TEST_CLIENT_ID", "abc123")
+	t.Setenv("TEST_SECRET_DIR", dir)
+	t.Setenv("TEST_PORT", "9090")
+	t.Setenv("APP_DISCORD__STREAMERS__POKIMANE", "https://discord.com/api/webhooks/2/b")
+	t.Setenv("APP_TWITCH__CHECK_INTERVAL_SECS", "30")
+	t.Setenv("APP_ENV", "test")
+
+	cfg, err := Parse([]byte(`
+twitch:
+  client_id: "${TEST_CLIENT_ID}"
+  client_secret_file: "${TEST_SECRET_DIR}/client_secret"
+  check_interval_secs: 300
+discord:
+  streamers:
+    shroud: "${TEST_WEBHOOK:-https://discord.com/api/webhooks/1/a}"
+  username: "cost: $$5"
+server:
+  host: "${TEST_HOST}"
+  port: ${TEST_PORT}
+`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	webhookURL := func(login string) string {
+		if destinations := cfg.Discord.Streamers[login]; len(destinations) > 0 {
+			return destinations[0].WebhookURL
+		}
+		return ""
+	}
+
+	if cfg.Twitch.ClientID != "abc123" {
+		t.Errorf("Expected ${VAR} to expand, got %q", cfg.Twitch.ClientID)
+	}
+	if cfg.Twitch.ClientSecret != "s3cr3t: #1" {
+		t.Errorf("Expected the secret read from its file, got %q", cfg.Twitch.ClientSecret)
+	}
+	if webhookURL("shroud") != "https://discord.com/api/webhooks/1/a" {
+		t.Errorf("Expected the default for an unset variable, got %q", webhookURL("shroud"))
+	}
+	if cfg.Discord.Username != "cost: $5" || cfg.Server.Host != "" {
+		t.Errorf("Unexpected escaping or unset variable: %q, %q", cfg.Discord.Username, cfg.Server.Host)
+	}
+	if cfg.Server.Port != 9090 {
+		t.Errorf("Expected an expanded unquoted number, got %d", cfg.Server.Port)
+	}
+	if cfg.Twitch.CheckIntervalSecs != 30 || webhookURL("pokimane") != "https://discord.com/api/webhooks/2/b" {
+		t.Errorf("Expected APP_ overrides to apply, got %d and %q", cfg.Twitch.CheckIntervalSecs, webhookURL("pokimane"))
+	}
+
+	// Logins ending in _file are streamers, not secret files
+	cfg, err = Parse([]byte("discord:\n  streamers:\n    cool_file: \"https://discord.com/api/webhooks/3/c\"\n"))
+	if err != nil || webhookURL("cool_file") == "" {
+		t.Errorf("Expected the cool_file streamer, got %+v (err: %v)", cfg, err)
+	}
+
+	// Webhook URLs carry tokens and can be read from files per destination
+	webhook := filepath.Join(dir, "webhook")
+	if err := os.WriteFile(webhook, []byte("https://discord.com/api/webhooks/4/d\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write webhook: %v", err)
+	}
+	cfg, err = Parse([]byte("discord:\n  streamers:\n    shroud:\n      - name: all-clips\n        webhook_url_file: " + webhook + "\n"))
+	if err != nil || webhookURL("shroud") != "https://discord.com/api/webhooks/4/d" {
+		t.Errorf("Expected the webhook URL read from its file, got %+v (err: %v)", cfg, err)
+	}
+
+	if _, err := Parse([]byte("twitch:\n  client_secret_file: /does/not/exist\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected an error for a missing secret file with its line, got %v", err)
+	}
+}
@@ -0,0 +1,210 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// envPrefix starts the environment variables that override config keys
+	envPrefix = "APP_"
+	// envSeparator separates the keys of a nested setting in an override,
+	// e.g. APP_TWITCH__CLIENT_ID for twitch.client_id
+	envSeparator = "__"
+	// fileSuffix marks keys whose value is read from the named file
+	fileSuffix = "_file"
+)
+
+// placeholder matches $$, ${VAR} and ${VAR:-default}
+var placeholder = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv replaces ${VAR} with the value of the environment variable VAR
+// and ${VAR:-default} with default when VAR is unset or empty. $$ is a
+// literal $. Unset variables without a default expand to nothing.
+func expandEnv(s string) string {
+	return placeholder.ReplaceAllStringFunc(s, func(match string) string {
+		if match == "$$" {
+			return "$"
+		}
+
+		parts := placeholder.FindStringSubmatch(match)
+		value := os.Getenv(parts[1])
+		if value == "" && parts[2] != "" {
+			return parts[3]
+		}
+		return value
+	})
+}
+
+// expandNode expands environment variables in every scalar of a document
+func expandNode(node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode {
+		expanded := expandEnv(node.Value)
+		if expanded != node.Value {
+			node.Value = expanded
+			retag(node)
+		}
+		return
+	}
+
+	for _, child := range node.Content {
+		expandNode(child)
+	}
+}
+
+// retag lets an unquoted scalar whose value changed be resolved again, so
+// that port: ${PORT} still decodes as a number
+func retag(node *yaml.Node) {
+	if node.Style == 0 {
+		node.Tag = ""
+	}
+}
+
+// applyEnvOverrides sets the config keys named by APP_-prefixed environment
+// variables, creating missing sections. Nested keys are separated by a double
+// underscore, so APP_DISCORD__STREAMERS__SHROUD sets discord.streamers.shroud.
+// Variables without a separator, such as APP_ENV, are not overrides.
+func applyEnvOverrides(doc *yaml.Node, environ []string) {
+	// Sorted so that overrides of the same key apply in a stable order
+	sort.Strings(environ)
+
+	for _, entry := range environ {
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok || !strings.HasPrefix(name, envPrefix) {
+			continue
+		}
+		path := strings.Split(strings.ToLower(strings.TrimPrefix(name, envPrefix)), envSeparator)
+		if len(path) < 2 {
+			continue
+		}
+
+		node := mappingRoot(doc)
+		for _, key := range path[:len(path)-1] {
+			node = childMapping(node, key)
+		}
+		setScalar(node, path[len(path)-1], value, "")
+	}
+}
+
+// resolveSecretFiles replaces each key ending in _file that stands for a
+// string setting of t, such as client_secret_file, with that setting read
+// from the named file, so that secrets can be mounted from Docker or
+// Kubernetes secrets. Settings inside maps and lists are resolved too, such
+// as the webhook_url_file of a streamer's destination, but the keys of maps
+// such as discord.streamers are logins and are left alone.
+func resolveSecretFiles(node *yaml.Node, t reflect.Type) error {
+	switch {
+	case node.Kind == yaml.DocumentNode:
+		return resolveEach(node.Content, t)
+	case node.Kind == yaml.SequenceNode && t.Kind() == reflect.Slice:
+		return resolveEach(node.Content, t.Elem())
+	case node.Kind == yaml.MappingNode && t.Kind() == reflect.Map:
+		for i := 1; i < len(node.Content); i += 2 {
+			if err := resolveSecretFiles(node.Content[i], t.Elem()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case node.Kind != yaml.MappingNode || t.Kind() != reflect.Struct:
+		return nil
+	}
+
+	fields := yamlFields(t)
+	for i := 0; i+1 < len(node.Content); {
+		key, value := node.Content[i], node.Content[i+1]
+		if field, ok := fields[key.Value]; ok {
+			if err := resolveSecretFiles(value, field); err != nil {
+				return err
+			}
+			i += 2
+			continue
+		}
+
+		setting := strings.TrimSuffix(key.Value, fileSuffix)
+		field, ok := fields[setting]
+		if setting == key.Value || !ok || field.Kind() != reflect.String || value.Kind != yaml.ScalarNode {
+			i += 2
+			continue
+		}
+
+		data, err := os.ReadFile(value.Value)
+		if err != nil {
+			return fmt.Errorf("%s (line %d): failed to read secret file: %w", key.Value, key.Line, err)
+		}
+		node.Content = append(node.Content[:i], node.Content[i+2:]...)
+		setScalar(node, setting, strings.TrimSpace(string(data)), "!!str")
+	}
+
+	return nil
+}
+
+// resolveEach resolves the secret files of nodes that all stand for t
+func resolveEach(nodes []*yaml.Node, t reflect.Type) error {
+	for _, node := range nodes {
+		if err := resolveSecretFiles(node, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// yamlFields maps the YAML keys of a struct to the types of their fields
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name != "" && name != "-" {
+			fields[name] = field.Type
+		}
+	}
+	return fields
+}
+
+// mappingRoot returns the top-level mapping of a document, creating it for an
+// empty document
+func mappingRoot(doc *yaml.Node) *yaml.Node {
+	if doc.Kind != yaml.DocumentNode {
+		*doc = yaml.Node{Kind: yaml.DocumentNode}
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		doc.Content = []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}
+	}
+	return doc.Content[0]
+}
+
+// childMapping returns the mapping under key, creating or replacing it
+func childMapping(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			if node.Content[i+1].Kind != yaml.MappingNode {
+				node.Content[i+1] = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			}
+			return node.Content[i+1]
+		}
+	}
+
+	child := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, child)
+	return child
+}
+
+// setScalar sets key in a mapping to a scalar. Without a tag the value is
+// resolved like an unquoted YAML value.
+func setScalar(node *yaml.Node, key, value, tag string) {
+	scalar := &yaml.Node{Kind: yaml.ScalarNode, Value: value, Tag: tag}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			scalar.Line, scalar.Column = node.Content[i+1].Line, node.Content[i+1].Column
+			node.Content[i+1] = scalar
+			return
+		}
+	}
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, scalar)
+}
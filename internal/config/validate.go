@@ -0,0 +1,333 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"twitchclipsearch/internal/discord/msgtemplate"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+var (
+	// loginPattern matches Twitch logins
+	loginPattern = regexp.MustCompile(`^[a-z0-9_]{1,25}$`)
+	// webhookPath matches the path of Discord webhook URLs
+	webhookPath = regexp.MustCompile(`^/api/(v\d+/)?webhooks/\d+/[\w-]+$`)
+)
+
+// webhookHosts are the hosts Discord serves webhooks from
+var webhookHosts = map[string]bool{
+	"discord.com":        true,
+	"discordapp.com":     true,
+	"ptb.discord.com":    true,
+	"canary.discord.com": true,
+}
+
+// Problem is a setting the service cannot run with
+type Problem struct {
+	// Path is the YAML path of the setting, e.g. discord.streamers.shroud
+	Path string
+	// Line is where the setting, or its closest enclosing section, is in the
+	// file; 0 if neither is
+	Line    int
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.Line > 0 {
+		return fmt.Sprintf("line %d: %s: %s", p.Line, p.Path, p.Message)
+	}
+	return fmt.Sprintf("%s: %s", p.Path, p.Message)
+}
+
+// ValidationError lists every problem of a configuration
+type ValidationError struct {
+	// File is the configuration file, if the configuration was read from one
+	File     string
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	if e.File != "" {
+		fmt.Fprintf(&b, "%s: ", e.File)
+	}
+	fmt.Fprintf(&b, "invalid configuration (%d problem(s))", len(e.Problems))
+	for _, p := range e.Problems {
+		b.WriteString("\n  ")
+		b.WriteString(p.String())
+	}
+	return b.String()
+}
+
+// Validate reports every setting the service cannot run with as a
+// *ValidationError. Zero values stand for defaults and are accepted.
+func (c *Config) Validate() error {
+	v := &validator{lines: c.lines}
+	v.problems = append(v.problems, c.unknown...)
+
+	twitch := c.Twitch
+	v.nonNegative("twitch.check_interval_secs", twitch.CheckIntervalSecs)
+	v.nonNegative("twitch.offline_interval_secs", twitch.OfflineIntervalSecs)
+	if twitch.OfflineIntervalSecs > 0 && twitch.OfflineIntervalSecs < twitch.CheckIntervalSecs {
+		v.add("twitch.offline_interval_secs", "must not be shorter than check_interval_secs (%d)", twitch.CheckIntervalSecs)
+	}
+	v.nonNegative("twitch.max_clip_pages", twitch.MaxClipPages)
+	v.nonNegative("twitch.streamer_ttl_secs", twitch.StreamerTTLSecs)
+	if twitch.EventSub.Enabled {
+		if n := len(twitch.EventSub.Secret); n < 10 || n > 100 {
+			v.add("twitch.eventsub.secret", "must be 10 to 100 characters, got %d", n)
+		}
+		if raw := twitch.EventSub.CallbackURL; raw != "" {
+			u, err := url.Parse(raw)
+			if err != nil || u.Scheme != "https" || u.Host == "" || (u.Port() != "" && u.Port() != "443") {
+				v.add("twitch.eventsub.callback_url", "must be an https URL on port 443, got %q", raw)
+			}
+		}
+	}
+
+	logins := make([]string, 0, len(c.Discord.Streamers))
+	for login := range c.Discord.Streamers {
+		logins = append(logins, login)
+	}
+	sort.Strings(logins)
+	for _, login := range logins {
+		path := "discord.streamers." + login
+		if !loginPattern.MatchString(login) {
+			v.add(path, "%q is not a lowercase Twitch login", login)
+		}
+		v.destinations(path, c.Discord.Streamers[login])
+	}
+	v.nonNegative("discord.rate_limit", c.Discord.RateLimit)
+	v.nonNegative("discord.max_delivery_attempts", c.Discord.MaxDeliveryAttempts)
+	v.template("discord.template", c.Discord.Template)
+	templated := make([]string, 0, len(c.Discord.Templates))
+	for login := range c.Discord.Templates {
+		templated = append(templated, login)
+	}
+	sort.Strings(templated)
+	for _, login := range templated {
+		path := "discord.templates." + login
+		if !loginPattern.MatchString(login) {
+			v.add(path, "%q is not a lowercase Twitch login", login)
+		}
+		v.template(path, c.Discord.Templates[login])
+	}
+
+	if c.Server.Port < 0 || c.Server.Port > 65535 {
+		v.add("server.port", "must be between 0 and 65535, got %d", c.Server.Port)
+	}
+	v.nonNegative("server.read_timeout_seconds", int(c.Server.ReadTimeout))
+	v.nonNegative("server.write_timeout_seconds", int(c.Server.WriteTimeout))
+
+	v.nonNegative("database.max_connections", c.Database.MaxConnections)
+	v.nonNegative("database.timeout_seconds", int(c.Database.Timeout))
+
+	switch c.Logging.Level {
+	case "", "debug", "info", "warn", "error":
+	default:
+		v.add("logging.level", "must be debug, info, warn or error, got %q", c.Logging.Level)
+	}
+	switch c.Logging.Format {
+	case "", "json", "text":
+	default:
+		v.add("logging.format", "must be json or text, got %q", c.Logging.Format)
+	}
+
+	v.nonNegative("reload.watch_interval_secs", c.Reload.WatchIntervalSecs)
+
+	if len(v.problems) == 0 {
+		return nil
+	}
+	sort.SliceStable(v.problems, func(i, j int) bool {
+		a, b := v.problems[i], v.problems[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Path < b.Path
+	})
+	return &ValidationError{Problems: v.problems}
+}
+
+// CheckWebhookURL rejects anything but Discord webhook URLs. Webhooks on
+// localhost are accepted too, for testing against a local server.
+func CheckWebhookURL(raw string) error {
+	if raw == "" {
+		return fmt.Errorf("webhook URL is required")
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("%q is not an absolute URL", raw)
+	}
+	if isLoopback(u.Hostname()) && (u.Scheme == "http" || u.Scheme == "https") {
+		return nil
+	}
+	if u.Scheme != "https" || !webhookHosts[u.Host] || !webhookPath.MatchString(u.Path) {
+		return fmt.Errorf("%q is not a Discord webhook URL (https://discord.com/api/webhooks/<id>/<token>)", raw)
+	}
+	return nil
+}
+
+// isLoopback reports whether host is localhost or a loopback address
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// validator collects the problems of a configuration
+type validator struct {
+	lines    map[string]int
+	problems []Problem
+}
+
+func (v *validator) add(path, format string, args ...interface{}) {
+	v.problems = append(v.problems, Problem{Path: path, Line: v.line(path), Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) nonNegative(path string, value int) {
+	if value < 0 {
+		v.add(path, "must not be negative, got %d", value)
+	}
+}
+
+// destinations reports the problems of a streamer's destinations. A single
+// webhook URL is reported at the streamer, listed destinations by position.
+func (v *validator) destinations(path string, destinations Destinations) {
+	if len(destinations) == 0 {
+		v.add(path, "at least one webhook is required")
+		return
+	}
+	_, listed := v.lines[path+"[0]"]
+	listed = listed || len(destinations) > 1
+
+	seen := make(map[string]bool, len(destinations))
+	for i, destination := range destinations {
+		destinationPath := path
+		if listed {
+			destinationPath = fmt.Sprintf("%s[%d]", path, i)
+		}
+		urlPath := destinationPath
+		if listed {
+			urlPath += ".webhook_url"
+		}
+
+		if err := CheckWebhookURL(destination.WebhookURL); err != nil {
+			v.add(urlPath, "%v", err)
+		} else if seen[destination.WebhookURL] {
+			v.add(urlPath, "webhook is already a destination of this streamer")
+		}
+		seen[destination.WebhookURL] = true
+		v.nonNegative(destinationPath+".min_views", destination.MinViews)
+		v.template(destinationPath+".template", destination.Template)
+	}
+}
+
+// template reports the parts of a message template that do not parse or
+// fail to render a sample clip
+func (v *validator) template(path string, spec msgtemplate.Spec) {
+	for _, problem := range spec.Validate() {
+		v.add(path+"."+problem.Part, "%v", problem.Err)
+	}
+}
+
+// line returns the line of a setting, or of the closest enclosing section
+// for settings missing from the file
+func (v *validator) line(path string) int {
+	for {
+		if line, ok := v.lines[path]; ok {
+			return line
+		}
+		i := strings.LastIndex(path, ".")
+		if i < 0 {
+			return 0
+		}
+		path = path[:i]
+	}
+}
+
+// settingLines maps the path of every key in a document to its line
+func settingLines(node *yamlv3.Node, prefix string, lines map[string]int) {
+	if node.Kind == yamlv3.DocumentNode {
+		for _, child := range node.Content {
+			settingLines(child, prefix, lines)
+		}
+		return
+	}
+	if node.Kind == yamlv3.SequenceNode {
+		for i, item := range node.Content {
+			path := fmt.Sprintf("%s[%d]", prefix, i)
+			lines[path] = item.Line
+			settingLines(item, path, lines)
+		}
+		return
+	}
+	if node.Kind != yamlv3.MappingNode {
+		return
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+		path := joinPath(prefix, key.Value)
+		if key.Line > 0 {
+			lines[path] = key.Line
+		}
+		settingLines(node.Content[i+1], path, lines)
+	}
+}
+
+// unknownSettings reports the keys of a document that are not settings of t,
+// which are most likely misspelled
+func unknownSettings(node *yamlv3.Node, t reflect.Type, prefix string) []Problem {
+	if node.Kind == yamlv3.DocumentNode {
+		var problems []Problem
+		for _, child := range node.Content {
+			problems = append(problems, unknownSettings(child, t, prefix)...)
+		}
+		return problems
+	}
+	// Check the items of lists and the values of maps such as discord.templates
+	var problems []Problem
+	switch {
+	case node.Kind == yamlv3.SequenceNode && t.Kind() == reflect.Slice:
+		for i, item := range node.Content {
+			problems = append(problems, unknownSettings(item, t.Elem(), fmt.Sprintf("%s[%d]", prefix, i))...)
+		}
+		return problems
+	case node.Kind == yamlv3.MappingNode && t.Kind() == reflect.Map:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			problems = append(problems, unknownSettings(node.Content[i+1], t.Elem(), joinPath(prefix, node.Content[i].Value))...)
+		}
+		return problems
+	case node.Kind != yamlv3.MappingNode || t.Kind() != reflect.Struct:
+		return nil
+	}
+
+	fields := yamlFields(t)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+		path := joinPath(prefix, key.Value)
+		field, ok := fields[key.Value]
+		if !ok {
+			problems = append(problems, Problem{Path: path, Line: key.Line, Message: "unknown setting"})
+			continue
+		}
+		problems = append(problems, unknownSettings(node.Content[i+1], field, path)...)
+	}
+	return problems
+}
+
+func joinPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
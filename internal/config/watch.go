@@ -0,0 +1,52 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"os"
+	"time"
+)
+
+// DefaultWatchInterval is how often Watch checks the file by default
+const DefaultWatchInterval = 5 * time.Second
+
+// Watch calls onChange whenever the content of the file at path changes,
+// checking every interval until ctx is done. Comparing content rather than
+// modification times also catches editors and Kubernetes ConfigMaps that
+// replace the file instead of writing to it. A missing or unreadable file
+// counts as unchanged.
+func Watch(ctx context.Context, path string, interval time.Duration, onChange func()) {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+
+	last := fileHash(path)
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+			current := fileHash(path)
+			if current == nil || bytes.Equal(current, last) {
+				continue
+			}
+			last = current
+			onChange()
+		}
+	}
+}
+
+// fileHash returns the SHA-256 of a file's content, nil if it cannot be read
+func fileHash(path string) []byte {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
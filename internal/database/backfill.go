@@ -0,0 +1,50 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// BackfillCheckpoint records how far a backfill of a streamer's clip archive
+// has progressed. Backfills are identified by streamer and start time, so a
+// rerun with the same start resumes where the previous run stopped.
+type BackfillCheckpoint struct {
+	StreamerName string
+	Since        time.Time
+	// CompletedUntil is the end of the last fully imported window
+	CompletedUntil time.Time
+	UpdatedAt      time.Time
+}
+
+// getBackfillCheckpoint loads a checkpoint, returning nil if there is none
+func getBackfillCheckpoint(db *sql.DB, streamerName string, since time.Time, numbered bool) (*BackfillCheckpoint, error) {
+	var checkpoint BackfillCheckpoint
+	err := db.QueryRow(
+		rebind("SELECT streamer_name, since, completed_until, updated_at FROM backfill_checkpoints WHERE streamer_name = ? AND since = ?", numbered),
+		streamerName, since.UTC(),
+	).Scan(
+		&checkpoint.StreamerName, &checkpoint.Since, &checkpoint.CompletedUntil, &checkpoint.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load backfill checkpoint: %w", err)
+	}
+
+	return &checkpoint, nil
+}
+
+// saveBackfillCheckpoint inserts or advances a checkpoint
+func saveBackfillCheckpoint(db *sql.DB, checkpoint *BackfillCheckpoint, numbered bool) error {
+	_, err := db.Exec(
+		"INSERT INTO backfill_checkpoints (streamer_name, since, completed_until, updated_at) VALUES ("+placeholders(4, numbered)+")"+
+			" ON CONFLICT (streamer_name, since) DO UPDATE SET completed_until = excluded.completed_until, updated_at = excluded.updated_at",
+		checkpoint.StreamerName, checkpoint.Since.UTC(), checkpoint.CompletedUntil.UTC(), checkpoint.UpdatedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save backfill checkpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,7 @@
+//go:build sqlite_fts5
+
+package database
+
+// fts5Available reports whether go-sqlite3 was compiled with FTS5, which the
+// SQLite schema needs for clip search
+const fts5Available = true
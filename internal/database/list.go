@@ -0,0 +1,199 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ClipSort is the order in which clips are listed, always descending
+type ClipSort string
+
+const (
+	// SortCreated lists the most recently created clips first
+	SortCreated ClipSort = "created"
+	// SortViews lists the most viewed clips first
+	SortViews ClipSort = "views"
+	// SortPosted lists the most recently posted clips first
+	SortPosted ClipSort = "posted"
+)
+
+// ErrInvalidCursor is returned for cursors that are malformed or were issued
+// for a different sort order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ClipQuery filters and pages a clip listing. Zero values disable a filter.
+type ClipQuery struct {
+	StreamerName string
+	GameID       string
+	StreamID     string
+	// CreatorName is matched case-insensitively
+	CreatorName string
+	// Since and Until bound the clip creation time, inclusive and exclusive
+	Since    time.Time
+	Until    time.Time
+	MinViews int
+	Sort     ClipSort
+	Limit    int
+	// Cursor continues a previous listing from its NextCursor
+	Cursor string
+}
+
+// ClipPage is one page of a clip listing
+type ClipPage struct {
+	Clips []*Clip
+	// NextCursor fetches the following page, empty on the last page
+	NextCursor string
+}
+
+// clipCursor is the position of the last clip on a page. It is keyed on the
+// sort column with the clip ID as a tie-breaker.
+type clipCursor struct {
+	Sort  ClipSort  `json:"s"`
+	Time  time.Time `json:"t,omitempty"`
+	Views int       `json:"v,omitempty"`
+	ID    string    `json:"id"`
+}
+
+// encodeCursor returns the opaque cursor positioned after clip
+func encodeCursor(sort ClipSort, clip *Clip) string {
+	cursor := clipCursor{Sort: sort, ID: clip.ID}
+	switch sort {
+	case SortViews:
+		cursor.Views = clip.ViewCount
+	case SortPosted:
+		cursor.Time = clip.PostedAt.UTC()
+	default:
+		cursor.Time = clip.CreatedAt.UTC()
+	}
+
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor parses an opaque cursor, which must match the requested sort
+func decodeCursor(raw string, sort ClipSort) (*clipCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor clipCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == "" || cursor.Sort != sort {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
+
+// buildListQuery renders a ClipQuery, whose Sort must be set, as SQL using
+// numbered ($1) bind parameters for PostgreSQL or positional (?) ones for
+// SQLite. One row more than the limit is selected to detect a following page.
+func buildListQuery(q ClipQuery, numbered bool) (string, []interface{}, error) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	param := func(value interface{}) string {
+		args = append(args, value)
+		if numbered {
+			return fmt.Sprintf("$%d", len(args))
+		}
+		return "?"
+	}
+
+	if q.StreamerName != "" {
+		conditions = append(conditions, "streamer_name = "+param(q.StreamerName))
+	}
+	if q.GameID != "" {
+		conditions = append(conditions, "game_id = "+param(q.GameID))
+	}
+	if q.StreamID != "" {
+		conditions = append(conditions, "stream_id = "+param(q.StreamID))
+	}
+	if q.CreatorName != "" {
+		conditions = append(conditions, "LOWER(creator_name) = LOWER("+param(q.CreatorName)+")")
+	}
+	if !q.Since.IsZero() {
+		conditions = append(conditions, "created_at >= "+param(q.Since.UTC()))
+	}
+	if !q.Until.IsZero() {
+		conditions = append(conditions, "created_at < "+param(q.Until.UTC()))
+	}
+	if q.MinViews > 0 {
+		conditions = append(conditions, "view_count >= "+param(q.MinViews))
+	}
+
+	var column string
+	switch q.Sort {
+	case SortCreated:
+		column = "created_at"
+	case SortViews:
+		column = "view_count"
+	case SortPosted:
+		column = "posted_at"
+	default:
+		return "", nil, fmt.Errorf("unknown sort order %q", q.Sort)
+	}
+
+	if q.Cursor != "" {
+		cursor, err := decodeCursor(q.Cursor, q.Sort)
+		if err != nil {
+			return "", nil, err
+		}
+
+		var value interface{} = cursor.Time.UTC()
+		if q.Sort == SortViews {
+			value = cursor.Views
+		}
+		conditions = append(conditions, fmt.Sprintf(
+			"(%s < %s OR (%s = %s AND id < %s))",
+			column, param(value), column, param(value), param(cursor.ID),
+		))
+	}
+
+	query := "SELECT " + clipColumns + " FROM clips"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY %s DESC, id DESC LIMIT %s", column, param(q.Limit+1))
+
+	return query, args, nil
+}
+
+// listClips runs a ClipQuery built by buildListQuery
+func listClips(db *sql.DB, q ClipQuery, numbered bool) (*ClipPage, error) {
+	if q.Limit <= 0 {
+		return nil, fmt.Errorf("limit must be positive")
+	}
+	if q.Sort == "" {
+		q.Sort = SortCreated
+	}
+
+	query, args, err := buildListQuery(q, numbered)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	clips, err := scanClips(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &ClipPage{Clips: clips}
+	if len(clips) > q.Limit {
+		page.Clips = clips[:q.Limit]
+		page.NextCursor = encodeCursor(q.Sort, page.Clips[q.Limit-1])
+	}
+
+	return page, nil
+}
@@ -0,0 +1,312 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrSchemaTooNew is returned when the database has migrations applied that
+// this binary does not know about, i.e. it was written by a newer release
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary")
+
+// Migration is a single versioned schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus describes whether a known migration has been applied
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrator applies and reverts schema migrations, each in its own transaction
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+	// lockStmt, when set, is run at the start of every migration transaction to
+	// serialize migrations across processes sharing the database
+	lockStmt string
+}
+
+// NewMigrator creates a migrator for the given migration files. Files are named
+// <version>_<name>.up.sql and <version>_<name>.down.sql.
+func NewMigrator(db *sql.DB, files fs.FS, dir string) (*Migrator, error) {
+	migrations, err := loadMigrations(files, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL
+		)
+	`); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// loadMigrations reads and orders the migrations found in dir
+func loadMigrations(files fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		filename := entry.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(filename, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(filename, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(filename, "."+direction+".sql")
+		versionPart, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration filename %q", filename)
+		}
+		version, err := strconv.Atoi(versionPart)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %q", filename)
+		}
+
+		body, err := fs.ReadFile(files, path.Join(dir, filename))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %q: %w", filename, err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("conflicting names for migration %d: %q and %q", version, m.Name, name)
+		}
+
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration versions must be sequential, expected %d but found %d", i+1, m.Version)
+		}
+	}
+
+	return migrations, nil
+}
+
+// Latest returns the highest migration version known to this binary
+func (m *Migrator) Latest() int {
+	return len(m.migrations)
+}
+
+// Version returns the highest migration version applied to the database
+func (m *Migrator) Version() (int, error) {
+	var version sql.NullInt64
+	if err := m.db.QueryRow("SELECT MAX(version) FROM schema_migrations").Scan(&version); err != nil {
+		return 0, err
+	}
+	return int(version.Int64), nil
+}
+
+// CheckVersion returns ErrSchemaTooNew if the database is ahead of this binary
+func (m *Migrator) CheckVersion() error {
+	version, err := m.Version()
+	if err != nil {
+		return err
+	}
+	if version > m.Latest() {
+		return fmt.Errorf("%w: database is at version %d, binary supports up to %d", ErrSchemaTooNew, version, m.Latest())
+	}
+	return nil
+}
+
+// Up applies all pending migrations in order and returns how many were applied
+func (m *Migrator) Up() (int, error) {
+	if err := m.CheckVersion(); err != nil {
+		return 0, err
+	}
+
+	version, err := m.Version()
+	if err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	for _, migration := range m.migrations[version:] {
+		if err := m.apply(migration); err != nil {
+			return applied, err
+		}
+		applied++
+	}
+
+	return applied, nil
+}
+
+// Down reverts the given number of most recently applied migrations
+func (m *Migrator) Down(steps int) (int, error) {
+	if err := m.CheckVersion(); err != nil {
+		return 0, err
+	}
+
+	version, err := m.Version()
+	if err != nil {
+		return 0, err
+	}
+
+	reverted := 0
+	for ; reverted < steps && version > 0; version-- {
+		if err := m.revert(m.migrations[version-1]); err != nil {
+			return reverted, err
+		}
+		reverted++
+	}
+
+	return reverted, nil
+}
+
+// Status reports every known migration and whether it has been applied
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	rows, err := m.db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	appliedAt := make(map[int]time.Time)
+	for rows.Next() {
+		var (
+			version int
+			at      time.Time
+		)
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		appliedAt[version] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(m.migrations))
+	for i, migration := range m.migrations {
+		at, ok := appliedAt[migration.Version]
+		statuses[i] = MigrationStatus{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			Applied:   ok,
+			AppliedAt: at,
+		}
+	}
+
+	return statuses, nil
+}
+
+// apply runs a single up migration and records it
+func (m *Migrator) apply(migration Migration) error {
+	tx, err := m.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Another process may have applied it while we waited for the lock
+	var applied bool
+	if err := tx.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM schema_migrations WHERE version = $1)", migration.Version,
+	).Scan(&applied); err != nil {
+		return err
+	}
+	if applied {
+		return nil
+	}
+
+	if _, err := tx.Exec(migration.Up); err != nil {
+		return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+	}
+	if _, err := tx.Exec(
+		"INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)",
+		migration.Version, migration.Name, time.Now().UTC(),
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// revert runs a single down migration and removes its record
+func (m *Migrator) revert(migration Migration) error {
+	if migration.Down == "" {
+		return fmt.Errorf("migration %d_%s cannot be reverted", migration.Version, migration.Name)
+	}
+
+	tx, err := m.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(migration.Down); err != nil {
+		return fmt.Errorf("reverting migration %d_%s failed: %w", migration.Version, migration.Name, err)
+	}
+	if _, err := tx.Exec("DELETE FROM schema_migrations WHERE version = $1", migration.Version); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// begin starts a migration transaction, taking the migration lock if any
+func (m *Migrator) begin() (*sql.Tx, error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	if m.lockStmt != "" {
+		if _, err := tx.Exec(m.lockStmt); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+	}
+
+	return tx, nil
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMigrator(t *testing.T) {
+	db := newTestDB(t)
+
+	migrator, err := db.Migrator()
+	if err != nil {
+		t.Fatalf("Failed to create migrator: %v", err)
+	}
+
+	t.Run("new applies all migrations", func(t *testing.T) {
+		statuses, err := migrator.Status()
+		if err != nil {
+			t.Fatalf("Status failed: %v", err)
+		}
+		for _, status := range statuses {
+			if !status.Applied {
+				t.Errorf("Migration %d_%s not applied", status.Version, status.Name)
+			}
+		}
+		if n, err := migrator.Up(); err != nil || n != 0 {
+			t.Errorf("Expected no pending migrations, got %d (err: %v)", n, err)
+		}
+	})
+
+	t.Run("down and up again", func(t *testing.T) {
+		latest := migrator.Latest()
+		if n, err := migrator.Down(latest); err != nil || n != latest {
+			t.Fatalf("Expected %d reverted migrations, got %d (err: %v)", latest, n, err)
+		}
+		if version, _ := migrator.Version(); version != 0 {
+			t.Fatalf("Expected version 0, got %d", version)
+		}
+		if n, err := migrator.Up(); err != nil || n != latest {
+			t.Fatalf("Expected %d applied migrations, got %d (err: %v)", latest, n, err)
+		}
+	})
+
+	t.Run("refuses newer schema", func(t *testing.T) {
+		if _, err := db.db.Exec(
+			"INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, 'from_the_future', CURRENT_TIMESTAMP)",
+			migrator.Latest()+1,
+		); err != nil {
+			t.Fatalf("Failed to insert future migration: %v", err)
+		}
+		if _, err := migrator.Up(); !errors.Is(err, ErrSchemaTooNew) {
+			t.Errorf("Expected ErrSchemaTooNew, got %v", err)
+		}
+	})
+}
+
+func TestLoadMigrations(t *testing.T) {
+	files := fstest.MapFS{
+		"m/0002_second.up.sql":  {Data: []byte("SELECT 2;")},
+		"m/0001_first.up.sql":   {Data: []byte("SELECT 1;")},
+		"m/0001_first.down.sql": {Data: []byte("SELECT -1;")},
+		"m/README.md":           {Data: []byte("ignored")},
+	}
+
+	migrations, err := loadMigrations(files, "m")
+	if err != nil {
+		t.Fatalf("loadMigrations failed: %v", err)
+	}
+	if len(migrations) != 2 || migrations[0].Name != "first" || migrations[1].Name != "second" {
+		t.Fatalf("Unexpected migrations: %+v", migrations)
+	}
+	if migrations[0].Down != "SELECT -1;" || migrations[1].Down != "" {
+		t.Errorf("Unexpected down scripts: %+v", migrations)
+	}
+
+	files["m/0004_gap.up.sql"] = &fstest.MapFile{Data: []byte("SELECT 4;")}
+	if _, err := loadMigrations(files, "m"); err == nil {
+		t.Error("Expected an error for a gap in migration versions")
+	}
+}
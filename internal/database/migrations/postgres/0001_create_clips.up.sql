@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS clips (
+	id TEXT PRIMARY KEY,
+	streamer_name TEXT NOT NULL,
+	title TEXT NOT NULL,
+	url TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	posted_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS clips_streamer_created_idx ON clips (streamer_name, created_at DESC);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS clips_search_idx;
+ALTER TABLE clips DROP COLUMN search_vector;
+ALTER TABLE clips DROP COLUMN creator_name;
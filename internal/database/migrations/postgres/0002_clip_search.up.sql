@@ -0,0 +1,9 @@
+ALTER TABLE clips ADD COLUMN creator_name TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE clips ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+	setweight(to_tsvector('simple', title), 'A') ||
+	setweight(to_tsvector('simple', streamer_name), 'B') ||
+	setweight(to_tsvector('simple', creator_name), 'C')
+) STORED;
+
+CREATE INDEX clips_search_idx ON clips USING GIN (search_vector);
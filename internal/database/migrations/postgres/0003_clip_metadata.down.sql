@@ -0,0 +1,10 @@
+ALTER TABLE clips DROP COLUMN embed_url;
+ALTER TABLE clips DROP COLUMN thumbnail_url;
+ALTER TABLE clips DROP COLUMN vod_offset;
+ALTER TABLE clips DROP COLUMN duration;
+ALTER TABLE clips DROP COLUMN view_count;
+ALTER TABLE clips DROP COLUMN language;
+ALTER TABLE clips DROP COLUMN video_id;
+ALTER TABLE clips DROP COLUMN game_id;
+ALTER TABLE clips DROP COLUMN creator_id;
+ALTER TABLE clips DROP COLUMN broadcaster_id;
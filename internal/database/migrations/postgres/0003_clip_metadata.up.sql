@@ -0,0 +1,10 @@
+ALTER TABLE clips ADD COLUMN broadcaster_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE clips ADD COLUMN creator_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE clips ADD COLUMN game_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE clips ADD COLUMN video_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE clips ADD COLUMN language TEXT NOT NULL DEFAULT '';
+ALTER TABLE clips ADD COLUMN view_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE clips ADD COLUMN duration DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE clips ADD COLUMN vod_offset INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE clips ADD COLUMN thumbnail_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE clips ADD COLUMN embed_url TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS clips_game_created_idx;
+DROP INDEX IF EXISTS clips_views_idx;
+DROP INDEX IF EXISTS clips_posted_idx;
+DROP INDEX IF EXISTS clips_created_idx;
+DROP INDEX IF EXISTS clips_streamer_created_idx;
+CREATE INDEX clips_streamer_created_idx ON clips (streamer_name, created_at DESC);
@@ -0,0 +1,7 @@
+CREATE TABLE backfill_checkpoints (
+	streamer_name TEXT NOT NULL,
+	since TIMESTAMPTZ NOT NULL,
+	completed_until TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (streamer_name, since)
+);
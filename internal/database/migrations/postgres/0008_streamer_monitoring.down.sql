@@ -0,0 +1,3 @@
+ALTER TABLE streamers DROP COLUMN paused;
+ALTER TABLE streamers DROP COLUMN monitored;
+ALTER TABLE streamers DROP COLUMN webhook_url;
@@ -0,0 +1,3 @@
+ALTER TABLE streamers ADD COLUMN webhook_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE streamers ADD COLUMN monitored BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE streamers ADD COLUMN paused BOOLEAN NOT NULL DEFAULT FALSE;
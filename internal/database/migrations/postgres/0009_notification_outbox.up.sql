@@ -0,0 +1,13 @@
+CREATE TABLE notification_outbox (
+	id BIGSERIAL PRIMARY KEY,
+	clip_id TEXT NOT NULL,
+	webhook_url TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	next_attempt_at TIMESTAMPTZ NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX notification_outbox_status_next_idx ON notification_outbox (status, next_attempt_at);
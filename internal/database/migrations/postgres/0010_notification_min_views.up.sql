@@ -0,0 +1 @@
+ALTER TABLE notification_outbox ADD COLUMN min_views INTEGER NOT NULL DEFAULT 0;
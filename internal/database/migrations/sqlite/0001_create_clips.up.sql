@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS clips (
+	id TEXT PRIMARY KEY,
+	streamer_name TEXT NOT NULL,
+	title TEXT NOT NULL,
+	url TEXT NOT NULL,
+	created_at DATETIME NOT NULL,
+	posted_at DATETIME NOT NULL
+);
@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS clips_fts_update;
+DROP TRIGGER IF EXISTS clips_fts_delete;
+DROP TRIGGER IF EXISTS clips_fts_insert;
+DROP TABLE IF EXISTS clips_fts;
+ALTER TABLE clips DROP COLUMN creator_name;
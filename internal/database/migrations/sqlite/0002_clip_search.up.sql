@@ -0,0 +1,27 @@
+ALTER TABLE clips ADD COLUMN creator_name TEXT NOT NULL DEFAULT '';
+
+CREATE VIRTUAL TABLE clips_fts USING fts5(
+	clip_id UNINDEXED,
+	title,
+	streamer_name,
+	creator_name,
+	tokenize = 'unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER clips_fts_insert AFTER INSERT ON clips BEGIN
+	INSERT INTO clips_fts (clip_id, title, streamer_name, creator_name)
+	VALUES (new.id, new.title, new.streamer_name, new.creator_name);
+END;
+
+CREATE TRIGGER clips_fts_delete AFTER DELETE ON clips BEGIN
+	DELETE FROM clips_fts WHERE clip_id = old.id;
+END;
+
+CREATE TRIGGER clips_fts_update AFTER UPDATE OF id, title, streamer_name, creator_name ON clips BEGIN
+	DELETE FROM clips_fts WHERE clip_id = old.id;
+	INSERT INTO clips_fts (clip_id, title, streamer_name, creator_name)
+	VALUES (new.id, new.title, new.streamer_name, new.creator_name);
+END;
+
+INSERT INTO clips_fts (clip_id, title, streamer_name, creator_name)
+SELECT id, title, streamer_name, creator_name FROM clips;
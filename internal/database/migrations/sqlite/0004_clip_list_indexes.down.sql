@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS clips_game_created_idx;
+DROP INDEX IF EXISTS clips_views_idx;
+DROP INDEX IF EXISTS clips_posted_idx;
+DROP INDEX IF EXISTS clips_created_idx;
+DROP INDEX IF EXISTS clips_streamer_created_idx;
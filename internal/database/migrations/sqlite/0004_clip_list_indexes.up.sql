@@ -0,0 +1,5 @@
+CREATE INDEX clips_streamer_created_idx ON clips (streamer_name, created_at DESC, id DESC);
+CREATE INDEX clips_created_idx ON clips (created_at DESC, id DESC);
+CREATE INDEX clips_posted_idx ON clips (posted_at DESC, id DESC);
+CREATE INDEX clips_views_idx ON clips (view_count DESC, id DESC);
+CREATE INDEX clips_game_created_idx ON clips (game_id, created_at DESC);
@@ -0,0 +1,7 @@
+CREATE TABLE backfill_checkpoints (
+	streamer_name TEXT NOT NULL,
+	since DATETIME NOT NULL,
+	completed_until DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL,
+	PRIMARY KEY (streamer_name, since)
+);
@@ -0,0 +1,7 @@
+CREATE TABLE streamers (
+	broadcaster_id TEXT PRIMARY KEY,
+	login TEXT NOT NULL UNIQUE,
+	display_name TEXT NOT NULL,
+	profile_image_url TEXT NOT NULL DEFAULT '',
+	refreshed_at DATETIME NOT NULL
+);
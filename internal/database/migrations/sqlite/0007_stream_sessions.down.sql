@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS clips_stream_created_idx;
+ALTER TABLE clips DROP COLUMN stream_id;
+DROP TABLE IF EXISTS stream_sessions;
@@ -0,0 +1,16 @@
+CREATE TABLE stream_sessions (
+	id TEXT PRIMARY KEY,
+	streamer_name TEXT NOT NULL,
+	broadcaster_id TEXT NOT NULL,
+	title TEXT NOT NULL DEFAULT '',
+	game_id TEXT NOT NULL DEFAULT '',
+	game_name TEXT NOT NULL DEFAULT '',
+	started_at DATETIME NOT NULL,
+	ended_at DATETIME
+);
+
+CREATE INDEX stream_sessions_streamer_started_idx ON stream_sessions (streamer_name, started_at DESC);
+
+ALTER TABLE clips ADD COLUMN stream_id TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX clips_stream_created_idx ON clips (stream_id, created_at DESC, id DESC);
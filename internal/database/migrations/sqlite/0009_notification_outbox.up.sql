@@ -0,0 +1,13 @@
+CREATE TABLE notification_outbox (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	clip_id TEXT NOT NULL,
+	webhook_url TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	next_attempt_at DATETIME NOT NULL,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL
+);
+
+CREATE INDEX notification_outbox_status_next_idx ON notification_outbox (status, next_attempt_at);
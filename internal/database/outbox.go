@@ -0,0 +1,232 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// NotificationStatus is the delivery state of a queued notification
+type NotificationStatus string
+
+const (
+	// NotificationPending notifications are delivered once NextAttemptAt passes
+	NotificationPending NotificationStatus = "pending"
+	// NotificationDead notifications ran out of attempts and wait to be retried
+	// or discarded by hand
+	NotificationDead NotificationStatus = "dead"
+)
+
+// ErrNotificationNotFound is returned when retrying or discarding a
+// notification that is not a dead letter
+var ErrNotificationNotFound = errors.New("notification not found")
+
+// Notification is a clip post queued for a Discord webhook. Delivered
+// notifications are removed from the outbox.
+type Notification struct {
+	ID         int64
+	ClipID     string
+	WebhookURL string
+	Status     NotificationStatus
+	Attempts   int
+	// LastError is why the last attempt failed, empty before the first one
+	LastError string
+	// MinViews holds the notification back until the clip has this many
+	// views; zero posts it right away
+	MinViews      int
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	// Clip is the clip to post, loaded with the notification
+	Clip *Clip
+}
+
+const notificationColumns = "id, clip_id, webhook_url, status, attempts, last_error, min_views, next_attempt_at, created_at, updated_at"
+
+// saveClipAndNotify saves a clip and queues its notifications in one
+// transaction, so that a stored clip is never left without them
+func saveClipAndNotify(db *sql.DB, clip *Clip, notifications []*Notification, numbered bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	values := clipValues(clip)
+	if _, err := tx.Exec("INSERT INTO clips ("+clipColumns+") VALUES ("+placeholders(len(values), numbered)+")", values...); err != nil {
+		return err
+	}
+
+	for _, notification := range notifications {
+		if _, err := tx.Exec(
+			rebind("INSERT INTO notification_outbox (clip_id, webhook_url, status, attempts, last_error, min_views, next_attempt_at, created_at, updated_at)"+
+				" VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)", numbered),
+			clip.ID, notification.WebhookURL, NotificationPending, 0, "", notification.MinViews,
+			notification.NextAttemptAt.UTC(), notification.CreatedAt.UTC(), notification.CreatedAt.UTC(),
+		); err != nil {
+			return fmt.Errorf("failed to queue notification: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// queryer runs queries on the database or inside a transaction
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// claimNotifications returns up to limit pending notifications due at now
+// with their clips, soonest first, only those of one streamer's clips if
+// streamerName is set, and moves their next attempt to until in
+// the same transaction, so that other processes delivering the outbox skip
+// them until then. PostgreSQL skips the rows another transaction is
+// claiming; SQLite transactions take the write lock up front and so run one
+// after another.
+func claimNotifications(db *sql.DB, streamerName string, now, until time.Time, limit int, numbered bool) ([]*Notification, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	notifications, err := listNotifications(tx, NotificationPending, streamerName, now, limit, numbered)
+	if err != nil {
+		return nil, err
+	}
+	for _, notification := range notifications {
+		if _, err := tx.Exec(
+			rebind("UPDATE notification_outbox SET next_attempt_at = ? WHERE id = ?", numbered),
+			until.UTC(), notification.ID,
+		); err != nil {
+			return nil, fmt.Errorf("failed to claim notification: %w", err)
+		}
+		notification.NextAttemptAt = until
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+// listNotifications loads notifications with their clips, restricted to one
+// streamer's clips if streamerName is set. With due set only pending
+// notifications whose next attempt is at or before it are returned, soonest
+// first and locked on PostgreSQL; otherwise those with the given status,
+// oldest first.
+func listNotifications(db queryer, status NotificationStatus, streamerName string, due time.Time, limit int, numbered bool) ([]*Notification, error) {
+	query := "SELECT " + prefixColumns("c", clipColumns) + ", " + prefixColumns("n", notificationColumns) +
+		" FROM notification_outbox n JOIN clips c ON c.id = n.clip_id WHERE n.status = ?"
+	args := []interface{}{status}
+	if streamerName != "" {
+		query += " AND c.streamer_name = ?"
+		args = append(args, streamerName)
+	}
+	if !due.IsZero() {
+		query += " AND n.next_attempt_at <= ? ORDER BY n.next_attempt_at, n.id"
+		args = append(args, due.UTC())
+	} else {
+		query += " ORDER BY n.id"
+	}
+	query += " LIMIT ?"
+	args = append(args, limit)
+	if !due.IsZero() && numbered {
+		query += " FOR UPDATE OF n SKIP LOCKED"
+	}
+
+	rows, err := db.Query(rebind(query, numbered), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notifications: %w", err)
+	}
+	defer rows.Close()
+
+	var notifications []*Notification
+	for rows.Next() {
+		notification := &Notification{Clip: &Clip{}}
+		if err := scanClip(rows, notification.Clip,
+			&notification.ID, &notification.ClipID, &notification.WebhookURL, &notification.Status, &notification.Attempts,
+			&notification.LastError, &notification.MinViews, &notification.NextAttemptAt, &notification.CreatedAt, &notification.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan notification: %w", err)
+		}
+		notifications = append(notifications, notification)
+	}
+
+	return notifications, rows.Err()
+}
+
+// updateNotification stores the status, attempts, last error and next
+// attempt of a notification
+func updateNotification(db *sql.DB, notification *Notification, numbered bool) error {
+	_, err := db.Exec(
+		rebind("UPDATE notification_outbox SET status = ?, attempts = ?, last_error = ?, next_attempt_at = ?, updated_at = ? WHERE id = ?", numbered),
+		notification.Status, notification.Attempts, notification.LastError,
+		notification.NextAttemptAt.UTC(), notification.UpdatedAt.UTC(), notification.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update notification: %w", err)
+	}
+	return nil
+}
+
+// deleteNotification removes a notification, restricted to one status if
+// status is set, and returns ErrNotificationNotFound if none matched
+func deleteNotification(db *sql.DB, id int64, status NotificationStatus, numbered bool) error {
+	query, args := "DELETE FROM notification_outbox WHERE id = ?", []interface{}{id}
+	if status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+
+	result, err := db.Exec(rebind(query, numbered), args...)
+	if err != nil {
+		return fmt.Errorf("failed to delete notification: %w", err)
+	}
+	return expectAffected(result)
+}
+
+// retryNotification makes a dead letter pending again with a fresh set of
+// attempts, due at the given time
+func retryNotification(db *sql.DB, id int64, at time.Time, numbered bool) error {
+	result, err := db.Exec(
+		rebind("UPDATE notification_outbox SET status = ?, attempts = 0, next_attempt_at = ?, updated_at = ? WHERE id = ? AND status = ?", numbered),
+		NotificationPending, at.UTC(), at.UTC(), id, NotificationDead,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to retry notification: %w", err)
+	}
+	return expectAffected(result)
+}
+
+// updateClipViewCounts stores the view counts of clips, keyed by clip ID, in
+// one transaction
+func updateClipViewCounts(db *sql.DB, viewCounts map[string]int, numbered bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := rebind("UPDATE clips SET view_count = ? WHERE id = ?", numbered)
+	for id, viewCount := range viewCounts {
+		if _, err := tx.Exec(query, viewCount, id); err != nil {
+			return fmt.Errorf("failed to update view count: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// expectAffected returns ErrNotificationNotFound if a statement changed no rows
+func expectAffected(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotificationNotFound
+	}
+	return nil
+}
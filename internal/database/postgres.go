@@ -0,0 +1,234 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+//go:embed migrations/postgres/*.sql
+var postgresMigrations embed.FS
+
+// postgresMigrationLock is an arbitrary advisory lock key shared by every
+// replica, so only one of them migrates the schema at a time
+const postgresMigrationLock = 7468312905
+
+// PostgresStore is a ClipStore backed by PostgreSQL, suitable for several
+// replicas sharing one database
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgres connects to the database at dsn, refusing to continue if its
+// schema is newer than this binary, and applies any pending migrations
+func NewPostgres(dsn string) (*PostgresStore, error) {
+	s, err := OpenPostgres(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrate(s); err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// OpenPostgres connects to the database at dsn without touching its schema
+func OpenPostgres(dsn string) (*PostgresStore, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &PostgresStore{db: db}, nil
+}
+
+// Migrator returns a migrator for the embedded schema migrations
+func (s *PostgresStore) Migrator() (*Migrator, error) {
+	m, err := NewMigrator(s.db, postgresMigrations, "migrations/postgres")
+	if err != nil {
+		return nil, err
+	}
+	m.lockStmt = fmt.Sprintf("SELECT pg_advisory_xact_lock(%d)", postgresMigrationLock)
+	return m, nil
+}
+
+// Ping checks that the database is reachable
+func (s *PostgresStore) Ping() error {
+	return s.db.Ping()
+}
+
+// Close closes the database connections
+func (s *PostgresStore) Close() error {
+	return s.db.Close()
+}
+
+// SaveClip saves a new clip to the database
+func (s *PostgresStore) SaveClip(clip *Clip) error {
+	values := clipValues(clip)
+	_, err := s.db.Exec(
+		"INSERT INTO clips ("+clipColumns+") VALUES ("+placeholders(len(values), true)+")",
+		values...,
+	)
+	return err
+}
+
+// GetLatestClipTime returns the creation time of the most recent clip for a streamer
+func (s *PostgresStore) GetLatestClipTime(streamerName string) (time.Time, error) {
+	var createdAt time.Time
+	err := s.db.QueryRow(
+		"SELECT created_at FROM clips WHERE streamer_name = $1 ORDER BY created_at DESC LIMIT 1",
+		streamerName,
+	).Scan(&createdAt)
+
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return createdAt, err
+}
+
+// ClipExists checks if a clip with the given ID already exists
+func (s *PostgresStore) ClipExists(clipID string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM clips WHERE id = $1)", clipID).Scan(&exists)
+	return exists, err
+}
+
+// GetClips returns one page of clips matching the query
+func (s *PostgresStore) GetClips(query ClipQuery) (*ClipPage, error) {
+	return listClips(s.db, query, true)
+}
+
+// SearchClips performs a full-text search over clip titles, streamer names and
+// creator names using the weighted search_vector column, best matches first
+func (s *PostgresStore) SearchClips(query string, limit int) ([]*SearchResult, error) {
+	tsQuery := buildTSQuery(parseSearchQuery(query))
+	if tsQuery == "" {
+		return nil, nil
+	}
+
+	rows, err := s.db.Query(
+		`SELECT `+clipColumns+`,
+			ts_headline('simple', title, q, $2),
+			ts_rank_cd(search_vector, q) AS rank
+		FROM clips, to_tsquery('simple', $1) q
+		WHERE search_vector @@ q
+		ORDER BY rank DESC, created_at DESC
+		LIMIT $3`,
+		tsQuery,
+		`StartSel="`+highlightStart+`", StopSel="`+highlightEnd+`", HighlightAll=true`,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*SearchResult
+	for rows.Next() {
+		result := &SearchResult{}
+		if err := scanClip(rows, &result.Clip, &result.Snippet, &result.Score); err != nil {
+			return nil, err
+		}
+		result.Snippet = formatSnippet(result.Snippet)
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// GetBackfillCheckpoint returns the checkpoint of a streamer's backfill
+func (s *PostgresStore) GetBackfillCheckpoint(streamerName string, since time.Time) (*BackfillCheckpoint, error) {
+	return getBackfillCheckpoint(s.db, streamerName, since, true)
+}
+
+// SaveBackfillCheckpoint creates or advances a backfill checkpoint
+func (s *PostgresStore) SaveBackfillCheckpoint(checkpoint *BackfillCheckpoint) error {
+	return saveBackfillCheckpoint(s.db, checkpoint, true)
+}
+
+// GetStreamer returns the stored streamer with the given login
+func (s *PostgresStore) GetStreamer(login string) (*Streamer, error) {
+	return getStreamer(s.db, login, true)
+}
+
+// SaveStreamer creates or updates a streamer, following renames
+func (s *PostgresStore) SaveStreamer(streamer *Streamer) (string, error) {
+	return saveStreamer(s.db, streamer, true)
+}
+
+// ListMonitoredStreamers returns the streamers added through the API
+func (s *PostgresStore) ListMonitoredStreamers() ([]*Streamer, error) {
+	return listMonitoredStreamers(s.db, true)
+}
+
+// SetStreamerMonitoring stores whether and where a streamer is monitored
+func (s *PostgresStore) SetStreamerMonitoring(streamer *Streamer) error {
+	return setStreamerMonitoring(s.db, streamer, true)
+}
+
+// SaveStreamSession creates or updates a live stream session
+func (s *PostgresStore) SaveStreamSession(session *StreamSession) error {
+	return saveStreamSession(s.db, session, true)
+}
+
+// EndStreamSessions ends the open stream sessions of a streamer
+func (s *PostgresStore) EndStreamSessions(streamerName string, endedAt time.Time) error {
+	return endStreamSessions(s.db, streamerName, endedAt, true)
+}
+
+// FindStreamSession returns the streamer's session live at the given time
+func (s *PostgresStore) FindStreamSession(streamerName string, at time.Time) (*StreamSession, error) {
+	return findStreamSession(s.db, streamerName, at, true)
+}
+
+// SaveClipAndNotify saves a new clip and queues its notifications
+func (s *PostgresStore) SaveClipAndNotify(clip *Clip, notifications []*Notification) error {
+	return saveClipAndNotify(s.db, clip, notifications, true)
+}
+
+// ClaimNotifications claims the pending notifications due at now until
+// the given time
+func (s *PostgresStore) ClaimNotifications(streamerName string, now, until time.Time, limit int) ([]*Notification, error) {
+	return claimNotifications(s.db, streamerName, now, until, limit, true)
+}
+
+// ListNotifications returns the notifications with the given status
+func (s *PostgresStore) ListNotifications(status NotificationStatus, limit int) ([]*Notification, error) {
+	return listNotifications(s.db, status, "", time.Time{}, limit, true)
+}
+
+// UpdateNotification stores the delivery state of a notification
+func (s *PostgresStore) UpdateNotification(notification *Notification) error {
+	return updateNotification(s.db, notification, true)
+}
+
+// DeleteNotification removes a delivered notification
+func (s *PostgresStore) DeleteNotification(id int64) error {
+	return deleteNotification(s.db, id, "", true)
+}
+
+// UpdateClipViewCounts stores refreshed view counts of clips
+func (s *PostgresStore) UpdateClipViewCounts(viewCounts map[string]int) error {
+	return updateClipViewCounts(s.db, viewCounts, true)
+}
+
+// RetryNotification makes a dead letter pending again
+func (s *PostgresStore) RetryNotification(id int64, at time.Time) error {
+	return retryNotification(s.db, id, at, true)
+}
+
+// DiscardNotification removes a dead letter
+func (s *PostgresStore) DiscardNotification(id int64) error {
+	return deleteNotification(s.db, id, NotificationDead, true)
+}
@@ -0,0 +1,126 @@
+package database
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// Highlight markers are control characters that cannot appear in user-facing
+// text; they are swapped for <mark> tags once the snippet has been escaped.
+const (
+	highlightStart = "\x02"
+	highlightEnd   = "\x03"
+)
+
+// SearchResult is a clip matched by a full-text search
+type SearchResult struct {
+	Clip
+	// Snippet is the HTML-escaped title with matches wrapped in <mark> tags
+	Snippet string
+	// Score is the backend's relevance score, higher is better
+	Score float64
+}
+
+// searchTerm is a single word or phrase of a search query
+type searchTerm struct {
+	text   string
+	prefix bool
+}
+
+// parseSearchQuery splits a user supplied search string into terms.
+//
+// The query is a list of words, which must all match. Words wrapped in double
+// quotes are matched as a phrase and a trailing * turns a word or phrase into a
+// prefix match, e.g. `"nice shot" clutch*`. Anything else, including backend
+// specific operators, is treated as plain text.
+func parseSearchQuery(query string) []searchTerm {
+	var terms []searchTerm
+
+	runes := []rune(strings.TrimSpace(query))
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+
+		var text string
+		if runes[i] == '"' {
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			text = string(runes[i+1 : end])
+			i = end + 1
+		} else {
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && runes[end] != '"' {
+				end++
+			}
+			text = string(runes[i:end])
+			i = end
+		}
+
+		prefix := false
+		if i < len(runes) && runes[i] == '*' {
+			prefix = true
+			i++
+		}
+		if strings.HasSuffix(text, "*") {
+			prefix = true
+			text = strings.TrimRight(text, "*")
+		}
+
+		if len(searchWords(text)) == 0 {
+			continue
+		}
+
+		terms = append(terms, searchTerm{text: text, prefix: prefix})
+	}
+
+	return terms
+}
+
+// searchWords splits text into the words a tokenizer would index
+func searchWords(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// buildMatchQuery converts search terms into an FTS5 MATCH expression. Every
+// term is quoted so FTS5 operators and column filters are never interpreted.
+func buildMatchQuery(terms []searchTerm) string {
+	parts := make([]string, len(terms))
+	for i, term := range terms {
+		parts[i] = `"` + strings.ReplaceAll(term.text, `"`, `""`) + `"`
+		if term.prefix {
+			parts[i] += "*"
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// buildTSQuery converts search terms into a PostgreSQL tsquery expression.
+// Only letters and digits survive, so the result is always well-formed.
+func buildTSQuery(terms []searchTerm) string {
+	parts := make([]string, len(terms))
+	for i, term := range terms {
+		words := searchWords(term.text)
+		if term.prefix {
+			words[len(words)-1] += ":*"
+		}
+		parts[i] = strings.Join(words, " <-> ")
+		if len(words) > 1 {
+			parts[i] = "(" + parts[i] + ")"
+		}
+	}
+	return strings.Join(parts, " & ")
+}
+
+// formatSnippet HTML-escapes a snippet and wraps matched terms in <mark> tags
+func formatSnippet(snippet string) string {
+	escaped := html.EscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, highlightStart, "<mark>")
+	return strings.ReplaceAll(escaped, highlightEnd, "</mark>")
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestDB opens a fresh database in a temporary directory. FTS5 is only
+// compiled into go-sqlite3 with the sqlite_fts5 build tag, so the test is
+// skipped when the module is unavailable.
+func newTestDB(t *testing.T) *SQLiteStore {
+	t.Helper()
+
+	db, err := NewSQLite(filepath.Join(t.TempDir(), "clips.db"))
+	if err != nil {
+		if errors.Is(err, ErrNoFTS5) {
+			t.Skip("sqlite3 built without FTS5; run with -tags sqlite_fts5")
+		}
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func TestBuildMatchQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"ace", `"ace"`},
+		{"nice shot", `"nice" "shot"`},
+		{`"nice shot" clutch*`, `"nice shot" "clutch"*`},
+		{`"nice sh"*`, `"nice sh"*`},
+		{`title:foo OR bar`, `"title:foo" "OR" "bar"`},
+		{`"unterminated phrase`, `"unterminated phrase"`},
+		{`*** !!!`, ``},
+	}
+
+	for _, tt := range tests {
+		if got := buildMatchQuery(parseSearchQuery(tt.query)); got != tt.want {
+			t.Errorf("buildMatchQuery(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestBuildTSQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"ace", `ace`},
+		{"nice shot", `nice & shot`},
+		{`"nice shot" clutch*`, `(nice <-> shot) & clutch:*`},
+		{`"nice sh"*`, `(nice <-> sh:*)`},
+		{`it's 1v5!`, `(it <-> s) & 1v5`},
+		{`a|b & !c`, `(a <-> b) & c`},
+		{`*** !!!`, ``},
+	}
+
+	for _, tt := range tests {
+		if got := buildTSQuery(parseSearchQuery(tt.query)); got != tt.want {
+			t.Errorf("buildTSQuery(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestSearchIndexFollowsDeletes(t *testing.T) {
+	db := newTestDB(t)
+
+	now := time.Now().UTC()
+	if err := db.SaveClip(&Clip{ID: "c", StreamerName: "pokimane", Title: "Shot of espresso", URL: "https://clips.twitch.tv/c", CreatedAt: now, PostedAt: now}); err != nil {
+		t.Fatalf("Failed to save clip: %v", err)
+	}
+	if _, err := db.db.Exec("DELETE FROM clips WHERE id = ?", "c"); err != nil {
+		t.Fatalf("Failed to delete clip: %v", err)
+	}
+
+	results, err := db.SearchClips("espresso", 10)
+	if err != nil {
+		t.Fatalf("SearchClips failed: %v", err)
+	}
+	if len(results) != 0 {
+		t.Fatalf("Expected no results, got %+v", results)
+	}
+}
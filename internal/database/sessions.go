@@ -0,0 +1,97 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// StreamSession is one live broadcast of a streamer
+type StreamSession struct {
+	// ID is the Twitch stream ID
+	ID            string
+	StreamerName  string
+	BroadcasterID string
+	Title         string
+	GameID        string
+	GameName      string
+	StartedAt     time.Time
+	// EndedAt is when the stream was noticed to be offline, zero while live
+	EndedAt time.Time
+}
+
+const sessionColumns = "id, streamer_name, broadcaster_id, title, game_id, game_name, started_at, ended_at"
+
+// saveStreamSession upserts a session in one transaction, ending the
+// streamer's other open sessions when the new one started
+func saveStreamSession(db *sql.DB, session *StreamSession, numbered bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		rebind("UPDATE stream_sessions SET ended_at = ? WHERE streamer_name = ? AND ended_at IS NULL AND id <> ?", numbered),
+		session.StartedAt.UTC(), session.StreamerName, session.ID,
+	); err != nil {
+		return fmt.Errorf("failed to end previous stream sessions: %w", err)
+	}
+
+	var endedAt interface{}
+	if !session.EndedAt.IsZero() {
+		endedAt = session.EndedAt.UTC()
+	}
+	if _, err := tx.Exec(
+		"INSERT INTO stream_sessions ("+sessionColumns+") VALUES ("+placeholders(8, numbered)+")"+
+			" ON CONFLICT (id) DO UPDATE SET title = excluded.title, game_id = excluded.game_id,"+
+			" game_name = excluded.game_name, ended_at = excluded.ended_at",
+		session.ID, session.StreamerName, session.BroadcasterID, session.Title, session.GameID, session.GameName,
+		session.StartedAt.UTC(), endedAt,
+	); err != nil {
+		return fmt.Errorf("failed to save stream session: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// endStreamSessions sets the end time of a streamer's open sessions
+func endStreamSessions(db *sql.DB, streamerName string, endedAt time.Time, numbered bool) error {
+	_, err := db.Exec(
+		rebind("UPDATE stream_sessions SET ended_at = ? WHERE streamer_name = ? AND ended_at IS NULL", numbered),
+		endedAt.UTC(), streamerName,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to end stream sessions: %w", err)
+	}
+	return nil
+}
+
+// findStreamSession returns the latest session of a streamer that started at
+// or before at and had not ended by then
+func findStreamSession(db *sql.DB, streamerName string, at time.Time, numbered bool) (*StreamSession, error) {
+	var (
+		session StreamSession
+		endedAt sql.NullTime
+	)
+	err := db.QueryRow(
+		rebind("SELECT "+sessionColumns+" FROM stream_sessions"+
+			" WHERE streamer_name = ? AND started_at <= ? AND (ended_at IS NULL OR ended_at >= ?)"+
+			" ORDER BY started_at DESC LIMIT 1", numbered),
+		streamerName, at.UTC(), at.UTC(),
+	).Scan(
+		&session.ID, &session.StreamerName, &session.BroadcasterID, &session.Title,
+		&session.GameID, &session.GameName, &session.StartedAt, &endedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find stream session: %w", err)
+	}
+
+	if endedAt.Valid {
+		session.EndedAt = endedAt.Time
+	}
+	return &session, nil
+}
@@ -0,0 +1,251 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+//go:embed migrations/sqlite/*.sql
+var sqliteMigrations embed.FS
+
+// ErrNoFTS5 is returned when opening a SQLite database from a binary built
+// without the sqlite_fts5 tag
+var ErrNoFTS5 = errors.New("SQLite support needs FTS5 for clip search, build with -tags sqlite_fts5")
+
+// SQLiteStore is a ClipStore backed by a local SQLite database
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLite opens the database at path, refusing to continue if its schema is
+// newer than this binary, and applies any pending migrations
+func NewSQLite(path string) (*SQLiteStore, error) {
+	s, err := OpenSQLite(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrate(s); err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// OpenSQLite opens the database at path without touching its schema
+func OpenSQLite(path string) (*SQLiteStore, error) {
+	if !fts5Available {
+		return nil, ErrNoFTS5
+	}
+
+	db, err := sql.Open("sqlite3", sqliteDSN(path))
+	if err != nil {
+		return nil, err
+	}
+
+	// Every connection to :memory: gets its own empty database
+	if path == ":memory:" {
+		db.SetMaxOpenConns(1)
+	}
+
+	return &SQLiteStore{db: db}, nil
+}
+
+// sqliteDSN adds the connection settings for concurrent use to a database
+// path: the scheduler workers, the outbox and the API write at the same time,
+// so writers wait for the lock instead of failing with "database is locked",
+// transactions take the write lock up front, and WAL lets reads continue
+// during writes
+func sqliteDSN(path string) string {
+	if path == ":memory:" {
+		return path
+	}
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return path + sep + "_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate"
+}
+
+// Migrator returns a migrator for the embedded schema migrations
+func (s *SQLiteStore) Migrator() (*Migrator, error) {
+	return NewMigrator(s.db, sqliteMigrations, "migrations/sqlite")
+}
+
+// Ping checks that the database is reachable
+func (s *SQLiteStore) Ping() error {
+	return s.db.Ping()
+}
+
+// Close closes the database connection
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// SaveClip saves a new clip to the database
+func (s *SQLiteStore) SaveClip(clip *Clip) error {
+	values := clipValues(clip)
+	_, err := s.db.Exec(
+		"INSERT INTO clips ("+clipColumns+") VALUES ("+placeholders(len(values), false)+")",
+		values...,
+	)
+	return err
+}
+
+// GetLatestClipTime returns the creation time of the most recent clip for a streamer
+func (s *SQLiteStore) GetLatestClipTime(streamerName string) (time.Time, error) {
+	var createdAt time.Time
+	err := s.db.QueryRow(
+		"SELECT created_at FROM clips WHERE streamer_name = ? ORDER BY created_at DESC LIMIT 1",
+		streamerName,
+	).Scan(&createdAt)
+
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return createdAt, err
+}
+
+// ClipExists checks if a clip with the given ID already exists
+func (s *SQLiteStore) ClipExists(clipID string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM clips WHERE id = ?)", clipID).Scan(&exists)
+	return exists, err
+}
+
+// GetClips returns one page of clips matching the query
+func (s *SQLiteStore) GetClips(query ClipQuery) (*ClipPage, error) {
+	return listClips(s.db, query, false)
+}
+
+// SearchClips performs a full-text search over clip titles, streamer names and
+// creator names using the FTS5 index, returning the best matches first
+func (s *SQLiteStore) SearchClips(query string, limit int) ([]*SearchResult, error) {
+	match := buildMatchQuery(parseSearchQuery(query))
+	if match == "" {
+		return nil, nil
+	}
+
+	rows, err := s.db.Query(
+		`SELECT `+prefixColumns("c", clipColumns)+`,
+			snippet(clips_fts, 1, ?, ?, '…', 16),
+			bm25(clips_fts, 0.0, 10.0, 5.0, 2.0) AS rank
+		FROM clips_fts
+		JOIN clips c ON c.id = clips_fts.clip_id
+		WHERE clips_fts MATCH ?
+		ORDER BY rank, c.created_at DESC
+		LIMIT ?`,
+		highlightStart, highlightEnd, match, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*SearchResult
+	for rows.Next() {
+		result := &SearchResult{}
+		var rank float64
+		if err := scanClip(rows, &result.Clip, &result.Snippet, &rank); err != nil {
+			return nil, err
+		}
+		// BM25 ranks are negative with lower being better
+		result.Score = -rank
+		result.Snippet = formatSnippet(result.Snippet)
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// GetBackfillCheckpoint returns the checkpoint of a streamer's backfill
+func (s *SQLiteStore) GetBackfillCheckpoint(streamerName string, since time.Time) (*BackfillCheckpoint, error) {
+	return getBackfillCheckpoint(s.db, streamerName, since, false)
+}
+
+// SaveBackfillCheckpoint creates or advances a backfill checkpoint
+func (s *SQLiteStore) SaveBackfillCheckpoint(checkpoint *BackfillCheckpoint) error {
+	return saveBackfillCheckpoint(s.db, checkpoint, false)
+}
+
+// GetStreamer returns the stored streamer with the given login
+func (s *SQLiteStore) GetStreamer(login string) (*Streamer, error) {
+	return getStreamer(s.db, login, false)
+}
+
+// SaveStreamer creates or updates a streamer, following renames
+func (s *SQLiteStore) SaveStreamer(streamer *Streamer) (string, error) {
+	return saveStreamer(s.db, streamer, false)
+}
+
+// ListMonitoredStreamers returns the streamers added through the API
+func (s *SQLiteStore) ListMonitoredStreamers() ([]*Streamer, error) {
+	return listMonitoredStreamers(s.db, false)
+}
+
+// SetStreamerMonitoring stores whether and where a streamer is monitored
+func (s *SQLiteStore) SetStreamerMonitoring(streamer *Streamer) error {
+	return setStreamerMonitoring(s.db, streamer, false)
+}
+
+// SaveStreamSession creates or updates a live stream session
+func (s *SQLiteStore) SaveStreamSession(session *StreamSession) error {
+	return saveStreamSession(s.db, session, false)
+}
+
+// EndStreamSessions ends the open stream sessions of a streamer
+func (s *SQLiteStore) EndStreamSessions(streamerName string, endedAt time.Time) error {
+	return endStreamSessions(s.db, streamerName, endedAt, false)
+}
+
+// FindStreamSession returns the streamer's session live at the given time
+func (s *SQLiteStore) FindStreamSession(streamerName string, at time.Time) (*StreamSession, error) {
+	return findStreamSession(s.db, streamerName, at, false)
+}
+
+// SaveClipAndNotify saves a new clip and queues its notifications
+func (s *SQLiteStore) SaveClipAndNotify(clip *Clip, notifications []*Notification) error {
+	return saveClipAndNotify(s.db, clip, notifications, false)
+}
+
+// ClaimNotifications claims the pending notifications due at now until
+// the given time
+func (s *SQLiteStore) ClaimNotifications(streamerName string, now, until time.Time, limit int) ([]*Notification, error) {
+	return claimNotifications(s.db, streamerName, now, until, limit, false)
+}
+
+// ListNotifications returns the notifications with the given status
+func (s *SQLiteStore) ListNotifications(status NotificationStatus, limit int) ([]*Notification, error) {
+	return listNotifications(s.db, status, "", time.Time{}, limit, false)
+}
+
+// UpdateNotification stores the delivery state of a notification
+func (s *SQLiteStore) UpdateNotification(notification *Notification) error {
+	return updateNotification(s.db, notification, false)
+}
+
+// DeleteNotification removes a delivered notification
+func (s *SQLiteStore) DeleteNotification(id int64) error {
+	return deleteNotification(s.db, id, "", false)
+}
+
+// UpdateClipViewCounts stores refreshed view counts of clips
+func (s *SQLiteStore) UpdateClipViewCounts(viewCounts map[string]int) error {
+	return updateClipViewCounts(s.db, viewCounts, false)
+}
+
+// RetryNotification makes a dead letter pending again
+func (s *SQLiteStore) RetryNotification(id int64, at time.Time) error {
+	return retryNotification(s.db, id, at, false)
+}
+
+// DiscardNotification removes a dead letter
+func (s *SQLiteStore) DiscardNotification(id int64) error {
+	return deleteNotification(s.db, id, NotificationDead, false)
+}
@@ -0,0 +1,273 @@
+// Package database provides clip persistence on SQLite or PostgreSQL
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"twitchclipsearch/internal/config"
+)
+
+// Clip represents a Twitch clip in the database
+type Clip struct {
+	ID            string
+	StreamerName  string
+	BroadcasterID string
+	Title         string
+	URL           string
+	EmbedURL      string
+	ThumbnailURL  string
+	CreatorID     string
+	CreatorName   string
+	GameID        string
+	VideoID       string
+	Language      string
+	ViewCount     int
+	// Duration is the clip length in seconds
+	Duration float64
+	// VodOffset is the clip's start offset into the VOD in seconds, zero if unknown
+	VodOffset int
+	// StreamID is the stream session the clip was created in, empty if unknown
+	StreamID  string
+	CreatedAt time.Time
+	PostedAt  time.Time
+}
+
+// ClipStore is implemented by every storage backend
+type ClipStore interface {
+	// SaveClip saves a new clip
+	SaveClip(clip *Clip) error
+	// ClipExists checks if a clip with the given ID already exists
+	ClipExists(clipID string) (bool, error)
+	// GetLatestClipTime returns the creation time of the most recent clip for a
+	// streamer, or the zero time if there are none
+	GetLatestClipTime(streamerName string) (time.Time, error)
+	// GetClips returns one page of clips matching the query
+	GetClips(query ClipQuery) (*ClipPage, error)
+	// SearchClips performs a ranked full-text search, best matches first
+	SearchClips(query string, limit int) ([]*SearchResult, error)
+	// GetBackfillCheckpoint returns the checkpoint of the backfill started at
+	// since for a streamer, or nil if there is none
+	GetBackfillCheckpoint(streamerName string, since time.Time) (*BackfillCheckpoint, error)
+	// SaveBackfillCheckpoint creates or advances a backfill checkpoint
+	SaveBackfillCheckpoint(checkpoint *BackfillCheckpoint) error
+	// GetStreamer returns the stored streamer with the given login, or nil if
+	// there is none
+	GetStreamer(login string) (*Streamer, error)
+	// SaveStreamer creates or updates a streamer by broadcaster ID. If the ID
+	// was stored under another login, the streamer's clips are moved to the
+	// new login and the previous login is returned.
+	SaveStreamer(streamer *Streamer) (string, error)
+	// ListMonitoredStreamers returns the streamers added through the API
+	ListMonitoredStreamers() ([]*Streamer, error)
+	// SetStreamerMonitoring stores the Monitored, Paused and WebhookURL
+	// fields of a stored streamer
+	SetStreamerMonitoring(streamer *Streamer) error
+	// SaveStreamSession creates or updates a live stream session, ending any
+	// other open session of the streamer
+	SaveStreamSession(session *StreamSession) error
+	// EndStreamSessions ends the open stream sessions of a streamer
+	EndStreamSessions(streamerName string, endedAt time.Time) error
+	// FindStreamSession returns the streamer's session that was live at the
+	// given time, or nil if there is none
+	FindStreamSession(streamerName string, at time.Time) (*StreamSession, error)
+	// SaveClipAndNotify saves a new clip and queues its notifications in the
+	// outbox in one transaction
+	SaveClipAndNotify(clip *Clip, notifications []*Notification) error
+	// ClaimNotifications returns up to limit pending notifications whose
+	// next attempt is due at now, soonest first, with their clips, and moves
+	// their next attempt to until so that no other process claims them
+	// before then. A streamerName restricts them to that streamer's clips.
+	ClaimNotifications(streamerName string, now, until time.Time, limit int) ([]*Notification, error)
+	// ListNotifications returns up to limit notifications with the given
+	// status, oldest first, with their clips
+	ListNotifications(status NotificationStatus, limit int) ([]*Notification, error)
+	// UpdateNotification stores the Status, Attempts, LastError,
+	// NextAttemptAt and UpdatedAt fields of a notification
+	UpdateNotification(notification *Notification) error
+	// DeleteNotification removes a delivered notification
+	DeleteNotification(id int64) error
+	// UpdateClipViewCounts stores the view counts of clips, keyed by clip ID
+	UpdateClipViewCounts(viewCounts map[string]int) error
+	// RetryNotification makes a dead letter pending again, due at the given
+	// time, or returns ErrNotificationNotFound
+	RetryNotification(id int64, at time.Time) error
+	// DiscardNotification removes a dead letter or returns ErrNotificationNotFound
+	DiscardNotification(id int64) error
+	// Ping checks that the database is reachable
+	Ping() error
+	// Migrator returns a migrator for the backend's schema migrations
+	Migrator() (*Migrator, error)
+	// Close closes the underlying connections
+	Close() error
+}
+
+// Connect opens the backend selected by cfg and applies pending migrations.
+// A DSN selects PostgreSQL, otherwise the SQLite database at Path is used.
+func Connect(cfg config.DatabaseConfig) (ClipStore, error) {
+	store, err := Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrate(store); err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// Open opens the backend selected by cfg without touching its schema
+func Open(cfg config.DatabaseConfig) (ClipStore, error) {
+	if cfg.DSN != "" {
+		store, err := OpenPostgres(cfg.DSN)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.MaxConnections > 0 {
+			store.db.SetMaxOpenConns(cfg.MaxConnections)
+		}
+		return store, nil
+	}
+
+	store, err := OpenSQLite(cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.MaxConnections > 0 && cfg.Path != ":memory:" {
+		store.db.SetMaxOpenConns(cfg.MaxConnections)
+	}
+	return store, nil
+}
+
+// migrate refuses schemas newer than this binary and applies pending migrations
+func migrate(store ClipStore) error {
+	migrator, err := store.Migrator()
+	if err != nil {
+		return err
+	}
+
+	_, err = migrator.Up()
+	return err
+}
+
+// clipColumns lists the clip columns in the order scanClip expects them
+const clipColumns = "id, streamer_name, broadcaster_id, title, url, embed_url, thumbnail_url, " +
+	"creator_id, creator_name, game_id, video_id, language, view_count, duration, vod_offset, " +
+	"stream_id, created_at, posted_at"
+
+// clipValues returns the values of a clip in clipColumns order
+func clipValues(clip *Clip) []interface{} {
+	return []interface{}{
+		clip.ID,
+		clip.StreamerName,
+		clip.BroadcasterID,
+		clip.Title,
+		clip.URL,
+		clip.EmbedURL,
+		clip.ThumbnailURL,
+		clip.CreatorID,
+		clip.CreatorName,
+		clip.GameID,
+		clip.VideoID,
+		clip.Language,
+		clip.ViewCount,
+		clip.Duration,
+		clip.VodOffset,
+		clip.StreamID,
+		clip.CreatedAt.UTC(),
+		clip.PostedAt.UTC(),
+	}
+}
+
+// scanner is satisfied by *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanClip reads the clipColumns of a row, followed by any extra destinations
+func scanClip(row scanner, clip *Clip, extra ...interface{}) error {
+	dest := []interface{}{
+		&clip.ID,
+		&clip.StreamerName,
+		&clip.BroadcasterID,
+		&clip.Title,
+		&clip.URL,
+		&clip.EmbedURL,
+		&clip.ThumbnailURL,
+		&clip.CreatorID,
+		&clip.CreatorName,
+		&clip.GameID,
+		&clip.VideoID,
+		&clip.Language,
+		&clip.ViewCount,
+		&clip.Duration,
+		&clip.VodOffset,
+		&clip.StreamID,
+		&clip.CreatedAt,
+		&clip.PostedAt,
+	}
+	return row.Scan(append(dest, extra...)...)
+}
+
+// scanClips reads every row of a clipColumns query
+func scanClips(rows *sql.Rows) ([]*Clip, error) {
+	defer rows.Close()
+
+	var clips []*Clip
+	for rows.Next() {
+		clip := &Clip{}
+		if err := scanClip(rows, clip); err != nil {
+			return nil, err
+		}
+		clips = append(clips, clip)
+	}
+
+	return clips, rows.Err()
+}
+
+// placeholders returns n comma separated bind parameters, numbered ($1, $2, ...)
+// for PostgreSQL or positional (?) for SQLite
+func placeholders(n int, numbered bool) string {
+	params := make([]string, n)
+	for i := range params {
+		if numbered {
+			params[i] = fmt.Sprintf("$%d", i+1)
+		} else {
+			params[i] = "?"
+		}
+	}
+	return strings.Join(params, ", ")
+}
+
+// rebind rewrites the positional (?) bind parameters of a query as numbered
+// ($1) ones for PostgreSQL
+func rebind(query string, numbered bool) string {
+	if !numbered {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// prefixColumns qualifies every column in a comma separated list with a table alias
+func prefixColumns(alias, columns string) string {
+	names := strings.Split(columns, ",")
+	for i, name := range names {
+		names[i] = alias + "." + strings.TrimSpace(name)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,550 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// storeBackends returns a constructor for every backend available to the test
+// run. PostgreSQL is tested when TEST_POSTGRES_DSN is set, see `make test-postgres`.
+func storeBackends() map[string]func(t *testing.T) ClipStore {
+	return map[string]func(t *testing.T) ClipStore{
+		"sqlite": func(t *testing.T) ClipStore {
+			return newTestDB(t)
+		},
+		"postgres": newTestPostgres,
+	}
+}
+
+// newTestPostgres connects to TEST_POSTGRES_DSN using a throwaway schema
+func newTestPostgres(t *testing.T) ClipStore {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN not set")
+	}
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("Failed to connect to postgres: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := fmt.Sprintf("clipstore_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+	t.Cleanup(func() { admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+	if strings.Contains(dsn, "://") {
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		dsn += sep + "search_path=" + schema
+	} else {
+		dsn += " search_path=" + schema
+	}
+
+	store, err := NewPostgres(dsn)
+	if err != nil {
+		t.Fatalf("Failed to open postgres store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	return store
+}
+
+// TestClipStore is the conformance suite every backend must pass
+func TestClipStore(t *testing.T) {
+	for name, newStore := range storeBackends() {
+		t.Run(name, func(t *testing.T) {
+			testClipStore(t, newStore(t))
+		})
+	}
+}
+
+func testClipStore(t *testing.T, store ClipStore) {
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	clips := []*Clip{
+		{
+			ID: "a", StreamerName: "shroud", BroadcasterID: "37402112", Title: "Insane clutch ace",
+			URL: "https://clips.twitch.tv/a", EmbedURL: "https://clips.twitch.tv/embed?clip=a",
+			ThumbnailURL: "https://clips-media-assets2.twitch.tv/a-preview-480x272.jpg", CreatorID: "1001",
+			CreatorName: "viewer1", GameID: "516575", VideoID: "2001", Language: "en",
+			ViewCount: 1234, Duration: 29.5, VodOffset: 3600, StreamID: "40001", CreatedAt: base, PostedAt: base,
+		},
+		{ID: "b", StreamerName: "shroud", Title: "Nice shot <3", URL: "https://clips.twitch.tv/b", CreatorName: "clutchfan", ViewCount: 50, CreatedAt: base.Add(time.Hour), PostedAt: base.Add(time.Minute)},
+		{ID: "c", StreamerName: "pokimane", Title: "Shot of espresso", URL: "https://clips.twitch.tv/c", CreatorName: "viewer2", ViewCount: 5000, CreatedAt: base.Add(2 * time.Hour), PostedAt: base.Add(-time.Minute)},
+	}
+
+	t.Run("empty store", func(t *testing.T) {
+		latest, err := store.GetLatestClipTime("shroud")
+		if err != nil || !latest.IsZero() {
+			t.Errorf("Expected zero time, got %v (err: %v)", latest, err)
+		}
+		exists, err := store.ClipExists("a")
+		if err != nil || exists {
+			t.Errorf("Expected clip to not exist (err: %v)", err)
+		}
+	})
+
+	for _, clip := range clips {
+		if err := store.SaveClip(clip); err != nil {
+			t.Fatalf("Failed to save clip: %v", err)
+		}
+	}
+
+	t.Run("duplicate save fails", func(t *testing.T) {
+		if err := store.SaveClip(clips[0]); err == nil {
+			t.Error("Expected an error saving a duplicate clip")
+		}
+	})
+
+	t.Run("exists and latest time", func(t *testing.T) {
+		exists, err := store.ClipExists("a")
+		if err != nil || !exists {
+			t.Errorf("Expected clip to exist (err: %v)", err)
+		}
+		latest, err := store.GetLatestClipTime("shroud")
+		if err != nil || !latest.Equal(base.Add(time.Hour)) {
+			t.Errorf("Expected %v, got %v (err: %v)", base.Add(time.Hour), latest, err)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		page, err := store.GetClips(ClipQuery{Limit: 10})
+		if err != nil {
+			t.Fatalf("GetClips failed: %v", err)
+		}
+		all := page.Clips
+		if page.NextCursor != "" {
+			t.Errorf("Expected no next cursor, got %q", page.NextCursor)
+		}
+		if len(all) != 3 || all[0].ID != "c" || all[2].ID != "a" {
+			t.Fatalf("Expected clips newest first, got %+v", all)
+		}
+		got, want := *all[2], *clips[0]
+		if !got.CreatedAt.Equal(want.CreatedAt) || !got.PostedAt.Equal(want.PostedAt) {
+			t.Errorf("Clip times did not round-trip: %+v", got)
+		}
+		got.CreatedAt, got.PostedAt = want.CreatedAt, want.PostedAt
+		if got != want {
+			t.Errorf("Clip did not round-trip:\n got %+v\nwant %+v", got, want)
+		}
+
+	})
+
+	t.Run("list filters", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			query ClipQuery
+			want  []string
+		}{
+			{"streamer", ClipQuery{StreamerName: "shroud"}, []string{"b", "a"}},
+			{"game", ClipQuery{GameID: "516575"}, []string{"a"}},
+			{"stream", ClipQuery{StreamID: "40001"}, []string{"a"}},
+			{"creator ignores case", ClipQuery{CreatorName: "ClutchFan"}, []string{"b"}},
+			{"since", ClipQuery{Since: base.Add(time.Hour)}, []string{"c", "b"}},
+			{"until", ClipQuery{Until: base.Add(time.Hour)}, []string{"a"}},
+			{"min views", ClipQuery{MinViews: 100}, []string{"c", "a"}},
+			{"sort by views", ClipQuery{Sort: SortViews}, []string{"c", "a", "b"}},
+			{"sort by posted", ClipQuery{Sort: SortPosted}, []string{"b", "a", "c"}},
+		}
+
+		for _, tt := range tests {
+			tt.query.Limit = 10
+			page, err := store.GetClips(tt.query)
+			if err != nil {
+				t.Fatalf("%s: GetClips failed: %v", tt.name, err)
+			}
+			if got := clipIDs(page.Clips); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+			}
+		}
+	})
+
+	t.Run("list pages", func(t *testing.T) {
+		for _, sort := range []ClipSort{SortCreated, SortViews, SortPosted} {
+			var (
+				ids    []string
+				cursor string
+			)
+			for pages := 0; ; pages++ {
+				if pages > 3 {
+					t.Fatalf("%s: paging did not terminate", sort)
+				}
+				page, err := store.GetClips(ClipQuery{Sort: sort, Limit: 2, Cursor: cursor})
+				if err != nil {
+					t.Fatalf("%s: GetClips failed: %v", sort, err)
+				}
+				ids = append(ids, clipIDs(page.Clips)...)
+				if page.NextCursor == "" {
+					break
+				}
+				cursor = page.NextCursor
+			}
+			if len(ids) != 3 {
+				t.Errorf("%s: expected 3 clips across pages, got %v", sort, ids)
+			}
+		}
+
+		page, err := store.GetClips(ClipQuery{Limit: 1})
+		if err != nil {
+			t.Fatalf("GetClips failed: %v", err)
+		}
+		if _, err := store.GetClips(ClipQuery{Sort: SortViews, Limit: 1, Cursor: page.NextCursor}); err != ErrInvalidCursor {
+			t.Errorf("Expected ErrInvalidCursor for a cursor of another sort, got %v", err)
+		}
+		if _, err := store.GetClips(ClipQuery{Limit: 1, Cursor: "not-a-cursor"}); err != ErrInvalidCursor {
+			t.Errorf("Expected ErrInvalidCursor for garbage, got %v", err)
+		}
+	})
+
+	t.Run("search ranks title matches above creator matches", func(t *testing.T) {
+		results, err := store.SearchClips("clutch*", 10)
+		if err != nil {
+			t.Fatalf("SearchClips failed: %v", err)
+		}
+		if len(results) != 2 || results[0].ID != "a" || results[1].ID != "b" {
+			t.Fatalf("Unexpected results: %+v", results)
+		}
+		if results[0].Score <= results[1].Score {
+			t.Errorf("Expected descending scores, got %v and %v", results[0].Score, results[1].Score)
+		}
+		if results[0].Snippet != "Insane <mark>clutch</mark> ace" {
+			t.Errorf("Unexpected snippet: %q", results[0].Snippet)
+		}
+	})
+
+	t.Run("search phrase", func(t *testing.T) {
+		results, err := store.SearchClips(`"nice shot"`, 10)
+		if err != nil {
+			t.Fatalf("SearchClips failed: %v", err)
+		}
+		if len(results) != 1 || results[0].ID != "b" {
+			t.Fatalf("Unexpected results: %+v", results)
+		}
+		if !strings.Contains(results[0].Snippet, "&lt;3") {
+			t.Errorf("Expected an escaped snippet, got %q", results[0].Snippet)
+		}
+	})
+
+	t.Run("search across columns", func(t *testing.T) {
+		results, err := store.SearchClips("shot pokimane", 10)
+		if err != nil {
+			t.Fatalf("SearchClips failed: %v", err)
+		}
+		if len(results) != 1 || results[0].ID != "c" {
+			t.Fatalf("Unexpected results: %+v", results)
+		}
+	})
+
+	t.Run("search ignores operators", func(t *testing.T) {
+		results, err := store.SearchClips(`ace OR | & ! : ( "`, 10)
+		if err != nil {
+			t.Fatalf("SearchClips failed: %v", err)
+		}
+		if len(results) != 0 {
+			t.Fatalf("Expected no results, got %+v", results)
+		}
+	})
+
+	t.Run("backfill checkpoints", func(t *testing.T) {
+		since := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		checkpoint, err := store.GetBackfillCheckpoint("shroud", since)
+		if err != nil || checkpoint != nil {
+			t.Fatalf("Expected no checkpoint, got %+v (err: %v)", checkpoint, err)
+		}
+
+		for _, completed := range []time.Time{since.AddDate(0, 0, 7), since.AddDate(0, 0, 14)} {
+			err := store.SaveBackfillCheckpoint(&BackfillCheckpoint{
+				StreamerName: "shroud", Since: since, CompletedUntil: completed, UpdatedAt: base,
+			})
+			if err != nil {
+				t.Fatalf("Failed to save checkpoint: %v", err)
+			}
+		}
+
+		checkpoint, err = store.GetBackfillCheckpoint("shroud", since)
+		if err != nil || checkpoint == nil {
+			t.Fatalf("Expected a checkpoint (err: %v)", err)
+		}
+		if !checkpoint.CompletedUntil.Equal(since.AddDate(0, 0, 14)) {
+			t.Errorf("Expected checkpoint to advance to %v, got %v", since.AddDate(0, 0, 14), checkpoint.CompletedUntil)
+		}
+
+		// A backfill from a different start is tracked separately
+		checkpoint, err = store.GetBackfillCheckpoint("shroud", since.AddDate(1, 0, 0))
+		if err != nil || checkpoint != nil {
+			t.Errorf("Expected no checkpoint for another start, got %+v (err: %v)", checkpoint, err)
+		}
+	})
+
+	t.Run("stream sessions", func(t *testing.T) {
+		first := &StreamSession{
+			ID: "40001", StreamerName: "shroud", BroadcasterID: "37402112", Title: "ranked",
+			GameID: "516575", GameName: "VALORANT", StartedAt: base.Add(-time.Hour),
+		}
+		if err := store.SaveStreamSession(first); err != nil {
+			t.Fatalf("SaveStreamSession failed: %v", err)
+		}
+		first.Title = "ranked grind"
+		if err := store.SaveStreamSession(first); err != nil {
+			t.Fatalf("SaveStreamSession update failed: %v", err)
+		}
+
+		session, err := store.FindStreamSession("shroud", base)
+		if err != nil || session == nil || session.Title != "ranked grind" || !session.EndedAt.IsZero() {
+			t.Fatalf("Expected the open session with its new title, got %+v (err: %v)", session, err)
+		}
+
+		// A new stream ends the one left open
+		second := &StreamSession{ID: "40002", StreamerName: "shroud", BroadcasterID: "37402112", StartedAt: base.Add(3 * time.Hour)}
+		if err := store.SaveStreamSession(second); err != nil {
+			t.Fatalf("SaveStreamSession failed: %v", err)
+		}
+		session, err = store.FindStreamSession("shroud", base)
+		if err != nil || session == nil || session.ID != "40001" || !session.EndedAt.Equal(second.StartedAt) {
+			t.Errorf("Expected the first session ended when the second started, got %+v (err: %v)", session, err)
+		}
+
+		if err := store.EndStreamSessions("shroud", base.Add(4*time.Hour)); err != nil {
+			t.Fatalf("EndStreamSessions failed: %v", err)
+		}
+		if session, _ := store.FindStreamSession("shroud", base.Add(5*time.Hour)); session != nil {
+			t.Errorf("Expected no session after the stream ended, got %+v", session)
+		}
+		if session, _ := store.FindStreamSession("shroud", base.Add(-2*time.Hour)); session != nil {
+			t.Errorf("Expected no session before the stream started, got %+v", session)
+		}
+	})
+
+	t.Run("streamer rename moves clips", func(t *testing.T) {
+		streamer, err := store.GetStreamer("shroud")
+		if err != nil || streamer != nil {
+			t.Fatalf("Expected no streamer, got %+v (err: %v)", streamer, err)
+		}
+
+		saved := &Streamer{BroadcasterID: "37402112", Login: "shroud", DisplayName: "shroud", RefreshedAt: base}
+		if previous, err := store.SaveStreamer(saved); err != nil || previous != "" {
+			t.Fatalf("Expected a plain save, got previous %q (err: %v)", previous, err)
+		}
+		streamer, err = store.GetStreamer("shroud")
+		if err != nil || streamer == nil || streamer.BroadcasterID != "37402112" || !streamer.RefreshedAt.Equal(base) {
+			t.Fatalf("Streamer did not round-trip: %+v (err: %v)", streamer, err)
+		}
+
+		renamed := &Streamer{BroadcasterID: "37402112", Login: "shroud2", DisplayName: "Shroud2", RefreshedAt: base.Add(time.Hour)}
+		previous, err := store.SaveStreamer(renamed)
+		if err != nil || previous != "shroud" {
+			t.Fatalf("Expected rename from shroud, got %q (err: %v)", previous, err)
+		}
+
+		if streamer, _ := store.GetStreamer("shroud"); streamer != nil {
+			t.Errorf("Expected old login to be gone, got %+v", streamer)
+		}
+		page, err := store.GetClips(ClipQuery{StreamerName: "shroud2", Limit: 10})
+		if err != nil || strings.Join(clipIDs(page.Clips), ",") != "b,a" {
+			t.Errorf("Expected clips to move to the new login (err: %v)", err)
+		}
+		checkpoint, err := store.GetBackfillCheckpoint("shroud2", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+		if err != nil || checkpoint == nil {
+			t.Errorf("Expected backfill checkpoint to move to the new login (err: %v)", err)
+		}
+		session, err := store.FindStreamSession("shroud2", base)
+		if err != nil || session == nil || session.ID != "40001" {
+			t.Errorf("Expected stream sessions to move to the new login (err: %v)", err)
+		}
+	})
+
+	t.Run("streamer monitoring", func(t *testing.T) {
+		streamers, err := store.ListMonitoredStreamers()
+		if err != nil || len(streamers) != 0 {
+			t.Fatalf("Expected no monitored streamers, got %d (err: %v)", len(streamers), err)
+		}
+
+		streamer, _ := store.GetStreamer("shroud2")
+		streamer.Monitored, streamer.WebhookURL = true, "https://discord.com/api/webhooks/1/a"
+		if err := store.SetStreamerMonitoring(streamer); err != nil {
+			t.Fatalf("SetStreamerMonitoring failed: %v", err)
+		}
+
+		// Refreshing the details keeps the monitoring settings
+		if _, err := store.SaveStreamer(&Streamer{BroadcasterID: "37402112", Login: "shroud2", DisplayName: "SHROUD2", RefreshedAt: base}); err != nil {
+			t.Fatalf("SaveStreamer failed: %v", err)
+		}
+
+		streamers, err = store.ListMonitoredStreamers()
+		if err != nil || len(streamers) != 1 {
+			t.Fatalf("Expected one monitored streamer, got %d (err: %v)", len(streamers), err)
+		}
+		if got := streamers[0]; got.DisplayName != "SHROUD2" || !got.Monitored || got.Paused || got.WebhookURL != streamer.WebhookURL {
+			t.Errorf("Unexpected monitored streamer %+v", got)
+		}
+
+		// Another account claiming the login keeps it monitored
+		if _, err := store.SaveStreamer(&Streamer{BroadcasterID: "99", Login: "shroud2", RefreshedAt: base}); err != nil {
+			t.Fatalf("SaveStreamer failed: %v", err)
+		}
+		streamers, err = store.ListMonitoredStreamers()
+		if err != nil || len(streamers) != 1 {
+			t.Fatalf("Expected one monitored streamer, got %d (err: %v)", len(streamers), err)
+		}
+		if got := streamers[0]; got.BroadcasterID != "99" || got.Login != "shroud2" || got.WebhookURL != streamer.WebhookURL {
+			t.Errorf("Expected the monitoring carried over to the new account, got %+v", got)
+		}
+
+		missing := &Streamer{BroadcasterID: "0", Login: "nobody", Monitored: true}
+		if err := store.SetStreamerMonitoring(missing); err == nil {
+			t.Error("Expected an error monitoring a streamer that is not stored")
+		}
+	})
+
+	t.Run("notification outbox", func(t *testing.T) {
+		clip := &Clip{ID: "d", StreamerName: "pokimane", Title: "Outbox", CreatedAt: base, PostedAt: base}
+		notifications := []*Notification{
+			{WebhookURL: "https://discord.com/api/webhooks/1/a", NextAttemptAt: base, CreatedAt: base},
+			{WebhookURL: "https://discord.com/api/webhooks/2/b", MinViews: 500, NextAttemptAt: base.Add(time.Hour), CreatedAt: base},
+		}
+		if err := store.SaveClipAndNotify(clip, notifications); err != nil {
+			t.Fatalf("SaveClipAndNotify failed: %v", err)
+		}
+		// The clip and its notifications are saved together or not at all
+		if err := store.SaveClipAndNotify(clip, notifications); err == nil {
+			t.Error("Expected an error saving a duplicate clip")
+		}
+
+		due, err := store.ClaimNotifications("", base, base, 10)
+		if err != nil || len(due) != 1 {
+			t.Fatalf("Expected one due notification, got %d (err: %v)", len(due), err)
+		}
+		first := due[0]
+		if first.Status != NotificationPending || first.Clip.Title != "Outbox" || first.WebhookURL != notifications[0].WebhookURL {
+			t.Errorf("Unexpected notification %+v", first)
+		}
+
+		first.Status, first.Attempts, first.LastError = NotificationDead, 3, "gone"
+		first.NextAttemptAt, first.UpdatedAt = base.Add(time.Minute), base.Add(time.Minute)
+		if err := store.UpdateNotification(first); err != nil {
+			t.Fatalf("UpdateNotification failed: %v", err)
+		}
+		dead, err := store.ListNotifications(NotificationDead, 10)
+		if err != nil || len(dead) != 1 || dead[0].Attempts != 3 || dead[0].LastError != "gone" {
+			t.Fatalf("Expected the dead letter, got %+v (err: %v)", dead, err)
+		}
+		if due, _ := store.ClaimNotifications("", base.Add(2*time.Hour), base.Add(2*time.Hour), 10); len(due) != 1 || due[0].ID == first.ID {
+			t.Errorf("Expected only the pending notification due, got %d", len(due))
+		}
+
+		if err := store.RetryNotification(first.ID, base.Add(3*time.Hour)); err != nil {
+			t.Fatalf("RetryNotification failed: %v", err)
+		}
+		if err := store.RetryNotification(first.ID, base); !errors.Is(err, ErrNotificationNotFound) {
+			t.Errorf("Expected only dead letters to be retried, got %v", err)
+		}
+		due, _ = store.ClaimNotifications("", base.Add(3*time.Hour), base.Add(3*time.Hour), 10)
+		if len(due) != 2 || due[1].ID != first.ID || due[1].Attempts != 0 {
+			t.Fatalf("Expected the retried notification due again with fresh attempts, got %+v", due)
+		}
+		if due[0].MinViews != 500 {
+			t.Errorf("Expected the held notification to keep its minimum views, got %d", due[0].MinViews)
+		}
+
+		if err := store.UpdateClipViewCounts(map[string]int{"d": 750, "unknown": 1}); err != nil {
+			t.Fatalf("UpdateClipViewCounts failed: %v", err)
+		}
+		if refreshed, _ := store.ClaimNotifications("", base.Add(3*time.Hour), base.Add(3*time.Hour), 10); len(refreshed) != 2 || refreshed[0].Clip.ViewCount != 750 {
+			t.Errorf("Expected the refreshed view count, got %+v", refreshed)
+		}
+
+		// Claims can be restricted to one streamer's clips
+		if claimed, _ := store.ClaimNotifications("shroud", base.Add(3*time.Hour), base.Add(4*time.Hour), 10); len(claimed) != 0 {
+			t.Errorf("Expected no notifications of another streamer claimed, got %d", len(claimed))
+		}
+		// Claimed notifications are not due again until the claim runs out
+		if claimed, _ := store.ClaimNotifications("pokimane", base.Add(3*time.Hour), base.Add(4*time.Hour), 10); len(claimed) != 2 {
+			t.Errorf("Expected both notifications claimed, got %d", len(claimed))
+		}
+		if claimed, _ := store.ClaimNotifications("", base.Add(3*time.Hour), base.Add(4*time.Hour), 10); len(claimed) != 0 {
+			t.Errorf("Expected claimed notifications skipped, got %d", len(claimed))
+		}
+
+		if err := store.DiscardNotification(first.ID); !errors.Is(err, ErrNotificationNotFound) {
+			t.Errorf("Expected only dead letters to be discarded, got %v", err)
+		}
+		for _, notification := range due {
+			if err := store.DeleteNotification(notification.ID); err != nil {
+				t.Errorf("DeleteNotification failed: %v", err)
+			}
+		}
+		if pending, _ := store.ListNotifications(NotificationPending, 10); len(pending) != 0 {
+			t.Errorf("Expected delivered notifications removed, got %d", len(pending))
+		}
+	})
+}
+
+func TestSQLiteConnection(t *testing.T) {
+	db := newTestDB(t)
+
+	var journalMode string
+	var busyTimeout int
+	if err := db.db.QueryRow("PRAGMA journal_mode").Scan(&journalMode); err != nil || journalMode != "wal" {
+		t.Errorf("Expected WAL, got %q (err: %v)", journalMode, err)
+	}
+	if err := db.db.QueryRow("PRAGMA busy_timeout").Scan(&busyTimeout); err != nil || busyTimeout != 5000 {
+		t.Errorf("Expected a busy timeout of 5000ms, got %d (err: %v)", busyTimeout, err)
+	}
+
+	// Concurrent writers wait for each other instead of failing
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		go func(i int) {
+			clip := &Clip{ID: fmt.Sprintf("concurrent-%d", i), StreamerName: "shroud", CreatedAt: time.Now(), PostedAt: time.Now()}
+			errs <- db.SaveClipAndNotify(clip, []*Notification{{WebhookURL: "https://discord.com/api/webhooks/1/a", NextAttemptAt: time.Now(), CreatedAt: time.Now()}})
+		}(i)
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("Concurrent write failed: %v", err)
+		}
+	}
+
+	// Concurrent claims never hand out the same notification twice
+	claims := make(chan []*Notification, 8)
+	for i := 0; i < cap(claims); i++ {
+		go func() {
+			claimed, err := db.ClaimNotifications("", time.Now(), time.Now().Add(time.Hour), 3)
+			if err != nil {
+				t.Errorf("Concurrent claim failed: %v", err)
+			}
+			claims <- claimed
+		}()
+	}
+	seen := make(map[int64]bool)
+	for i := 0; i < cap(claims); i++ {
+		for _, notification := range <-claims {
+			if seen[notification.ID] {
+				t.Errorf("Notification %d claimed twice", notification.ID)
+			}
+			seen[notification.ID] = true
+		}
+	}
+	if len(seen) != cap(errs) {
+		t.Errorf("Expected every notification claimed once, got %d", len(seen))
+	}
+}
+
+func clipIDs(clips []*Clip) []string {
+	ids := make([]string, len(clips))
+	for i, clip := range clips {
+		ids[i] = clip.ID
+	}
+	return ids
+}
@@ -0,0 +1,181 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Streamer is a Twitch broadcaster as last resolved from their login
+type Streamer struct {
+	BroadcasterID   string
+	Login           string
+	DisplayName     string
+	ProfileImageURL string
+	// RefreshedAt is when the details were last fetched from Twitch
+	RefreshedAt time.Time
+
+	// Monitored is set for streamers added through the API, whose new clips
+	// are posted to WebhookURL unless Paused
+	Monitored  bool
+	Paused     bool
+	WebhookURL string
+}
+
+const (
+	streamerColumns = "broadcaster_id, login, display_name, profile_image_url, refreshed_at"
+	// monitorColumns are set through the API and left alone by refreshes
+	monitorColumns = "monitored, paused, webhook_url"
+)
+
+// scanStreamer reads the streamerColumns and monitorColumns of a row
+func scanStreamer(row scanner, streamer *Streamer) error {
+	return row.Scan(
+		&streamer.BroadcasterID, &streamer.Login, &streamer.DisplayName, &streamer.ProfileImageURL, &streamer.RefreshedAt,
+		&streamer.Monitored, &streamer.Paused, &streamer.WebhookURL,
+	)
+}
+
+// getStreamer loads a streamer by login, returning nil if it is not stored
+func getStreamer(db *sql.DB, login string, numbered bool) (*Streamer, error) {
+	var streamer Streamer
+	err := scanStreamer(db.QueryRow(
+		rebind("SELECT "+streamerColumns+", "+monitorColumns+" FROM streamers WHERE login = ?", numbered),
+		login,
+	), &streamer)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load streamer: %w", err)
+	}
+
+	return &streamer, nil
+}
+
+// listMonitoredStreamers loads the streamers added through the API, ordered
+// by login
+func listMonitoredStreamers(db *sql.DB, numbered bool) ([]*Streamer, error) {
+	rows, err := db.Query(rebind("SELECT "+streamerColumns+", "+monitorColumns+" FROM streamers WHERE monitored = ? ORDER BY login", numbered), true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list monitored streamers: %w", err)
+	}
+	defer rows.Close()
+
+	var streamers []*Streamer
+	for rows.Next() {
+		streamer := &Streamer{}
+		if err := scanStreamer(rows, streamer); err != nil {
+			return nil, fmt.Errorf("failed to scan streamer: %w", err)
+		}
+		streamers = append(streamers, streamer)
+	}
+
+	return streamers, rows.Err()
+}
+
+// setStreamerMonitoring stores whether and where a streamer is monitored
+func setStreamerMonitoring(db *sql.DB, streamer *Streamer, numbered bool) error {
+	result, err := db.Exec(
+		rebind("UPDATE streamers SET monitored = ?, paused = ?, webhook_url = ? WHERE broadcaster_id = ?", numbered),
+		streamer.Monitored, streamer.Paused, streamer.WebhookURL, streamer.BroadcasterID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update streamer monitoring: %w", err)
+	}
+
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("streamer %s is not stored", streamer.Login)
+	}
+	return nil
+}
+
+// saveStreamer upserts a streamer by broadcaster ID in one transaction. When
+// the ID was stored under another login the streamer has been renamed, so
+// their clips and backfill checkpoints move to the new login and the old one
+// is returned.
+func saveStreamer(db *sql.DB, streamer *Streamer, numbered bool) (string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var previousLogin string
+	err = tx.QueryRow(rebind("SELECT login FROM streamers WHERE broadcaster_id = ?", numbered), streamer.BroadcasterID).Scan(&previousLogin)
+	if err != nil && err != sql.ErrNoRows {
+		return "", fmt.Errorf("failed to load streamer: %w", err)
+	}
+
+	// A login freed by a rename can be claimed by another account, which
+	// replaces the stale entry. Streamers are monitored by login, so the
+	// account taking it over keeps being monitored like the entry it replaces.
+	var released Streamer
+	err = tx.QueryRow(
+		rebind("SELECT "+monitorColumns+" FROM streamers WHERE login = ? AND broadcaster_id <> ?", numbered),
+		streamer.Login, streamer.BroadcasterID,
+	).Scan(&released.Monitored, &released.Paused, &released.WebhookURL)
+	if err != nil && err != sql.ErrNoRows {
+		return "", fmt.Errorf("failed to load streamer: %w", err)
+	}
+	if _, err := tx.Exec(
+		rebind("DELETE FROM streamers WHERE login = ? AND broadcaster_id <> ?", numbered),
+		streamer.Login, streamer.BroadcasterID,
+	); err != nil {
+		return "", fmt.Errorf("failed to release streamer login: %w", err)
+	}
+
+	if _, err := tx.Exec(
+		"INSERT INTO streamers ("+streamerColumns+") VALUES ("+placeholders(5, numbered)+")"+
+			" ON CONFLICT (broadcaster_id) DO UPDATE SET login = excluded.login, display_name = excluded.display_name,"+
+			" profile_image_url = excluded.profile_image_url, refreshed_at = excluded.refreshed_at",
+		streamer.BroadcasterID, streamer.Login, streamer.DisplayName, streamer.ProfileImageURL, streamer.RefreshedAt.UTC(),
+	); err != nil {
+		return "", fmt.Errorf("failed to save streamer: %w", err)
+	}
+	if released.Monitored {
+		if _, err := tx.Exec(
+			rebind("UPDATE streamers SET monitored = ?, paused = ?, webhook_url = ? WHERE broadcaster_id = ? AND monitored = ?", numbered),
+			true, released.Paused, released.WebhookURL, streamer.BroadcasterID, false,
+		); err != nil {
+			return "", fmt.Errorf("failed to carry over streamer monitoring: %w", err)
+		}
+	}
+
+	renamed := previousLogin != "" && previousLogin != streamer.Login
+	if renamed {
+		if _, err := tx.Exec(
+			rebind("UPDATE clips SET streamer_name = ? WHERE streamer_name = ?", numbered),
+			streamer.Login, previousLogin,
+		); err != nil {
+			return "", fmt.Errorf("failed to move clips to renamed streamer: %w", err)
+		}
+
+		if _, err := tx.Exec(
+			rebind("UPDATE stream_sessions SET streamer_name = ? WHERE streamer_name = ?", numbered),
+			streamer.Login, previousLogin,
+		); err != nil {
+			return "", fmt.Errorf("failed to move stream sessions to renamed streamer: %w", err)
+		}
+
+		// Checkpoints under the new login cannot predate the rename
+		if _, err := tx.Exec(rebind("DELETE FROM backfill_checkpoints WHERE streamer_name = ?", numbered), streamer.Login); err != nil {
+			return "", fmt.Errorf("failed to move backfill checkpoints to renamed streamer: %w", err)
+		}
+		if _, err := tx.Exec(
+			rebind("UPDATE backfill_checkpoints SET streamer_name = ? WHERE streamer_name = ?", numbered),
+			streamer.Login, previousLogin,
+		); err != nil {
+			return "", fmt.Errorf("failed to move backfill checkpoints to renamed streamer: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	if renamed {
+		return previousLogin, nil
+	}
+	return "", nil
+}
@@ -5,7 +5,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"time"
 
 	"twitchclipsearch/internal/database"
@@ -20,6 +22,13 @@ type Client struct {
 	rateLimiter   *rate.Limiter
 	httpClient    *http.Client
 	retryAttempts int
+	// route is the rate limit route of webhookURL, see routeKey
+	route string
+	// limits holds the rate limit buckets Discord reported, shared by the
+	// clients of a registry
+	limits *rateLimits
+	// backoff is the wait before the first retry of a failed delivery
+	backoff time.Duration
 }
 
 // ClientConfig holds configuration for the Discord client
@@ -30,60 +39,113 @@ type ClientConfig struct {
 	RetryAttempts int
 }
 
-// NewClient creates a new Discord webhook client
+// NewClient creates a new Discord webhook client with its own connections
+// and rate limiter. Clients from a Registry share both.
 func NewClient(config *ClientConfig) *Client {
-	if config.RateLimit == 0 {
-		config.RateLimit = 5 // default 5 requests per second
-	}
-	if config.RetryAttempts == 0 {
-		config.RetryAttempts = 3 // default 3 retry attempts
-	}
+	cfg := withDefaults(*config)
+	return newClient(&cfg, &http.Client{Timeout: 10 * time.Second}, rate.NewLimiter(rate.Limit(cfg.RateLimit), 1), newRateLimits())
+}
 
+// newClient creates a client sending through httpClient, paced by limiter
+// and by the rate limit buckets in limits
+func newClient(config *ClientConfig, httpClient *http.Client, limiter *rate.Limiter, limits *rateLimits) *Client {
 	return &Client{
 		webhookURL:    config.WebhookURL,
 		username:      config.Username,
-		rateLimiter:   rate.NewLimiter(rate.Limit(config.RateLimit), 1),
-		httpClient:    &http.Client{Timeout: 10 * time.Second},
+		rateLimiter:   limiter,
+		httpClient:    httpClient,
 		retryAttempts: config.RetryAttempts,
+		route:         routeKey(config.WebhookURL),
+		limits:        limits,
+		backoff:       time.Second,
+	}
+}
+
+// withDefaults fills in the unset settings of a client configuration
+func withDefaults(config ClientConfig) ClientConfig {
+	if config.RateLimit == 0 {
+		config.RateLimit = 5 // default 5 requests per second
 	}
+	if config.RetryAttempts == 0 {
+		config.RetryAttempts = 3 // default 3 retry attempts
+	}
+	return config
 }
 
-// SendClipNotification sends a clip notification to Discord
+// SendClipNotification sends a clip notification with the default message
+// to Discord, see SendMessage
 func (c *Client) SendClipNotification(clip *database.Clip) error {
-	// Wait for rate limit
-	// Add context import at the top of the file
-	if err := c.rateLimiter.Wait(context.Background()); err != nil {
-		return fmt.Errorf("rate limit wait error: %w", err)
+	return c.SendMessage(NewMessage(clip))
+}
+
+// SendMessage sends a message to Discord. Rate limits Discord reports are
+// waited out, and failed deliveries are retried with exponential backoff
+// unless Discord rejected the message.
+func (c *Client) SendMessage(msg *Message) error {
+	payload, err := c.payload(msg)
+	if err != nil {
+		return err
 	}
 
-	// Create message payload
-	msg := NewMessage(clip)
-	msg.Username = c.username
+	ctx := context.Background()
+	target := c.requestURL(msg)
+	return retryWithBackoff(ctx, func() error {
+		return c.sendWebhook(ctx, target, payload)
+	}, c.retryAttempts, c.backoff)
+}
 
-	payload, err := json.Marshal(msg)
+// DeliverMessage makes a single attempt at sending a message, for callers
+// that schedule retries themselves. Rate limits Discord reported earlier are
+// still waited out.
+func (c *Client) DeliverMessage(ctx context.Context, msg *Message) error {
+	payload, err := c.payload(msg)
 	if err != nil {
-		return fmt.Errorf("failed to marshal message: %w", err)
+		return err
 	}
+	return c.sendWebhook(ctx, c.requestURL(msg), payload)
+}
+
+// payload encodes a message as sent by this client's username
+func (c *Client) payload(msg *Message) ([]byte, error) {
+	named := *msg
+	named.Username = c.username
 
-	// Send with retries
-	for attempt := 0; attempt < c.retryAttempts; attempt++ {
-		err = c.sendWebhook(payload)
-		if err == nil {
-			return nil
-		}
-
-		// Wait before retry
-		if attempt < c.retryAttempts-1 {
-			time.Sleep(time.Second * time.Duration(attempt+1))
-		}
+	payload, err := json.Marshal(named)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal message: %w", err)
 	}
+	return payload, nil
+}
 
-	return fmt.Errorf("failed to send webhook after %d attempts: %w", c.retryAttempts, err)
+// requestURL returns the URL a message is posted to. Discord drops the
+// components of webhook messages unless with_components is set.
+func (c *Client) requestURL(msg *Message) string {
+	if len(msg.Components) == 0 {
+		return c.webhookURL
+	}
+	u, err := url.Parse(c.webhookURL)
+	if err != nil {
+		return c.webhookURL
+	}
+	query := u.Query()
+	query.Set("with_components", "true")
+	u.RawQuery = query.Encode()
+	return u.String()
 }
 
-// sendWebhook sends the actual HTTP request to Discord
-func (c *Client) sendWebhook(payload []byte) error {
-	req, err := http.NewRequest("POST", c.webhookURL, bytes.NewBuffer(payload))
+// sendWebhook sends the actual HTTP request to target, the client's webhook
+// URL with any query parameters the message needs, once the rate limits
+// allow it and records the rate limit state of the response
+func (c *Client) sendWebhook(ctx context.Context, target string, payload []byte) error {
+	if err := c.rateLimiter.Wait(ctx); err != nil {
+		return fmt.Errorf("rate limit wait error: %w", err)
+	}
+	// Pause while the webhook's bucket is exhausted or a global limit applies
+	if err := sleep(ctx, c.limits.delay(c.route, time.Now())); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(payload))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
@@ -96,9 +158,10 @@ func (c *Client) sendWebhook(payload []byte) error {
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		return fmt.Errorf("webhook request failed with status %d", resp.StatusCode)
-	}
+	err = handleWebhookResponse(resp)
+	c.limits.update(c.route, parseRateLimitHeaders(resp.Header), err, time.Now())
+	// Drain the body so that the connection can be reused
+	io.Copy(io.Discard, resp.Body)
 
-	return nil
+	return err
 }
@@ -2,9 +2,11 @@ package discord
 
 import (
 	"fmt"
+	"net/url"
 	"time"
 
 	"twitchclipsearch/internal/database"
+	"twitchclipsearch/internal/discord/msgtemplate"
 )
 
 // Message represents a Discord webhook message
@@ -12,16 +14,29 @@ type Message struct {
 	Username  string   `json:"username,omitempty"`
 	Content   string   `json:"content,omitempty"`
 	Embeds    []Embed  `json:"embeds,omitempty"`
+	// Components are sent by adding with_components to the webhook URL,
+	// which lets webhooks not owned by an application send link buttons
+	Components []Component `json:"components,omitempty"`
 }
 
 // Embed represents a Discord message embed
 type Embed struct {
 	Title       string    `json:"title"`
+	// Type is always "rich" for webhook embeds
+	Type        string    `json:"type,omitempty"`
 	Description string    `json:"description,omitempty"`
 	URL         string    `json:"url"`
 	Color       int       `json:"color"`
 	Timestamp   string    `json:"timestamp,omitempty"`
 	Fields      []Field   `json:"fields,omitempty"`
+	Footer      *Footer   `json:"footer,omitempty"`
+	Image       *Media    `json:"image,omitempty"`
+	Thumbnail   *Media    `json:"thumbnail,omitempty"`
+	// Video and Provider are shown for links Discord unfurls itself;
+	// webhooks cannot set them
+	Video       *Media    `json:"video,omitempty"`
+	Provider    *Provider `json:"provider,omitempty"`
+	Author      *Author   `json:"author,omitempty"`
 }
 
 // Field represents a field in a Discord embed
@@ -31,29 +46,132 @@ type Field struct {
 	Inline bool   `json:"inline,omitempty"`
 }
 
-// NewMessage creates a new Discord message from a clip
+// Footer represents the footer of a Discord embed
+type Footer struct {
+	Text    string `json:"text"`
+	IconURL string `json:"icon_url,omitempty"`
+}
+
+// Media represents the image, thumbnail or video of a Discord embed
+type Media struct {
+	URL    string `json:"url"`
+	Height int    `json:"height,omitempty"`
+	Width  int    `json:"width,omitempty"`
+}
+
+// Provider represents the site a Discord embed is from
+type Provider struct {
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url,omitempty"`
+}
+
+// Author represents the author of a Discord embed
+type Author struct {
+	Name    string `json:"name"`
+	URL     string `json:"url,omitempty"`
+	IconURL string `json:"icon_url,omitempty"`
+}
+
+// Component types and button styles used by clip messages
+const (
+	ComponentActionRow = 1
+	ComponentButton    = 2
+	ButtonLink         = 5
+)
+
+// Component represents a message component: an action row holding
+// components, or a button
+type Component struct {
+	Type       int         `json:"type"`
+	Components []Component `json:"components,omitempty"`
+	Style      int         `json:"style,omitempty"`
+	Label      string      `json:"label,omitempty"`
+	URL        string      `json:"url,omitempty"`
+}
+
+// defaultTemplate renders messages for streamers without a template
+var defaultTemplate = msgtemplate.MustParse(msgtemplate.Default)
+
+// NewMessage creates a new Discord message from a clip with the default template
 func NewMessage(clip *database.Clip) *Message {
-	return &Message{
-		Embeds: []Embed{
-			{
-				Title: clip.Title,
-				Description: fmt.Sprintf("New clip from %s!", clip.StreamerName),
-				URL: clip.URL,
-				Color: 0x6441A4, // Twitch purple
-				Timestamp: clip.CreatedAt.Format(time.RFC3339),
-				Fields: []Field{
-					{
-						Name: "Streamer",
-						Value: clip.StreamerName,
-						Inline: true,
-					},
-					{
-						Name: "Created At",
-						Value: clip.CreatedAt.Format("Jan 02, 2006 15:04:05 MST"),
-						Inline: true,
-					},
-				},
-			},
-		},
-	}
-}
\ No newline at end of file
+	// The default template renders every clip
+	msg, _ := RenderMessage(defaultTemplate, clip)
+	return msg
+}
+
+// RenderMessage creates a Discord message from a clip with a template. The
+// embed always links to the clip, carries its creation time and shows its
+// thumbnail and game box art; the author links to the clipper's channel.
+// Clips with a VOD get a button to the moment they were clipped.
+func RenderMessage(tmpl *msgtemplate.Template, clip *database.Clip) (*Message, error) {
+	rendered, err := tmpl.Execute(msgtemplate.Clip(*clip))
+	if err != nil {
+		return nil, err
+	}
+
+	embed := Embed{
+		Title:       rendered.Title,
+		Type:        "rich",
+		Description: rendered.Description,
+		URL:         clip.URL,
+		Color:       rendered.Color,
+		Timestamp:   clip.CreatedAt.Format(time.RFC3339),
+	}
+	for _, field := range rendered.Fields {
+		embed.Fields = append(embed.Fields, Field{Name: field.Name, Value: field.Value, Inline: field.Inline})
+	}
+	if rendered.Footer != "" {
+		embed.Footer = &Footer{Text: rendered.Footer}
+	}
+	if rendered.Author != "" {
+		embed.Author = &Author{Name: rendered.Author}
+		if clip.CreatorName != "" {
+			embed.Author.URL = channelURL(clip.CreatorName)
+		}
+	}
+	if clip.ThumbnailURL != "" {
+		embed.Image = &Media{URL: clip.ThumbnailURL}
+	}
+	if clip.GameID != "" {
+		embed.Thumbnail = &Media{URL: boxArtURL(clip.GameID)}
+	}
+
+	msg := &Message{Content: rendered.Content, Embeds: []Embed{embed}}
+	if vod := vodURL(clip); vod != "" {
+		msg.Components = []Component{{
+			Type: ComponentActionRow,
+			Components: []Component{{
+				Type:  ComponentButton,
+				Style: ButtonLink,
+				Label: "Watch in VOD",
+				URL:   vod,
+			}},
+		}}
+	}
+	return msg, nil
+}
+
+// channelURL returns the Twitch channel of a login
+func channelURL(login string) string {
+	return "https://www.twitch.tv/" + url.PathEscape(login)
+}
+
+// boxArtURL returns the box art of a game at the size Twitch shows it in its
+// directory
+func boxArtURL(gameID string) string {
+	return fmt.Sprintf("https://static-cdn.jtvnw.net/ttv-boxart/%s-144x192.jpg", url.PathEscape(gameID))
+}
+
+// vodURL returns the VOD of a clip at the moment it was clipped, or at its
+// start while Twitch has not reported the offset; empty without a VOD
+func vodURL(clip *database.Clip) string {
+	if clip.VideoID == "" {
+		return ""
+	}
+	vod := "https://www.twitch.tv/videos/" + url.PathEscape(clip.VideoID)
+	if clip.VodOffset <= 0 {
+		return vod
+	}
+	offset := time.Duration(clip.VodOffset) * time.Second
+	return fmt.Sprintf("%s?t=%dh%dm%ds", vod, int(offset.Hours()), int(offset.Minutes())%60, int(offset.Seconds())%60)
+}
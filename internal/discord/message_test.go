@@ -0,0 +1,81 @@
+package discord
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"twitchclipsearch/internal/database"
+)
+
+func TestNewMessage(t *testing.T) {
+	clip := &database.Clip{
+		ID:           "clip",
+		StreamerName: "shroud",
+		Title:        "Nice",
+		URL:          "https://clips.twitch.tv/clip",
+		ThumbnailURL: "https://clips-media-assets2.twitch.tv/clip-preview-480x272.jpg",
+		CreatorName:  "clip_fan",
+		GameID:       "33214",
+		VideoID:      "1234567890",
+		ViewCount:    1234,
+		Duration:     28.5,
+		VodOffset:    3725,
+		CreatedAt:    time.Date(2024, 1, 1, 20, 0, 0, 0, time.UTC),
+	}
+
+	msg := NewMessage(clip)
+	embed := msg.Embeds[0]
+	if embed.Image == nil || embed.Image.URL != clip.ThumbnailURL {
+		t.Errorf("Expected the clip thumbnail as the image, got %+v", embed.Image)
+	}
+	if embed.Thumbnail == nil || embed.Thumbnail.URL != "https://static-cdn.jtvnw.net/ttv-boxart/33214-144x192.jpg" {
+		t.Errorf("Expected the game box art as the thumbnail, got %+v", embed.Thumbnail)
+	}
+	if embed.Author == nil || embed.Author.Name != "Clipped by clip_fan" || embed.Author.URL != "https://www.twitch.tv/clip_fan" {
+		t.Errorf("Expected the clipper as the author, got %+v", embed.Author)
+	}
+	if len(embed.Fields) != 3 || embed.Fields[1].Value != "1,234" || embed.Fields[2].Value != "0:29" {
+		t.Errorf("Expected streamer, views and duration fields, got %+v", embed.Fields)
+	}
+	if len(msg.Components) != 1 || len(msg.Components[0].Components) != 1 ||
+		msg.Components[0].Components[0].URL != "https://www.twitch.tv/videos/1234567890?t=1h2m5s" {
+		t.Errorf("Expected a button to the VOD timestamp, got %+v", msg.Components)
+	}
+
+	// Without a VOD, creator or game the parts that need them are left out
+	msg = NewMessage(testClip())
+	if embed := msg.Embeds[0]; embed.Author != nil || embed.Thumbnail != nil || embed.Image != nil || msg.Components != nil {
+		t.Errorf("Expected a plain card, got %+v", msg)
+	}
+}
+
+func TestSendMessageComponents(t *testing.T) {
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg Message
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Errorf("Failed to decode message: %v", err)
+		}
+		queries = append(queries, r.URL.RawQuery)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewRegistry(ClientConfig{RateLimit: 1000}).Client(server.URL + "/api/webhooks/1/a?thread_id=5")
+	withVOD := testClip()
+	withVOD.VideoID = "1234567890"
+	for _, clip := range []*database.Clip{testClip(), withVOD} {
+		if err := client.SendClipNotification(clip); err != nil {
+			t.Fatalf("SendClipNotification failed: %v", err)
+		}
+	}
+
+	// Components are only respected with with_components, which must not
+	// replace the webhook's own parameters
+	if len(queries) != 2 || queries[0] != "thread_id=5" || queries[1] != "thread_id=5&with_components=true" {
+		t.Errorf("Unexpected query strings: %q", queries)
+	}
+}
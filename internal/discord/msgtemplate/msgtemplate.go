@@ -0,0 +1,399 @@
+// Package msgtemplate renders the parts of Discord clip notifications from
+// text/template templates over a clip's metadata. It has no dependencies on
+// the rest of the service, so that configuration can be validated with it.
+package msgtemplate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+// Discord's limits on the parts of a message; longer parts are cut short
+// rather than have the message rejected
+const (
+	maxContent     = 2000
+	maxTitle       = 256
+	maxDescription = 4096
+	maxFields      = 25
+	maxFieldName   = 256
+	maxFieldValue  = 1024
+	maxFooter      = 2048
+	maxAuthor      = 256
+)
+
+// Clip is the data templates are executed with: the clip's metadata as stored
+type Clip struct {
+	ID            string
+	StreamerName  string
+	BroadcasterID string
+	Title         string
+	URL           string
+	EmbedURL      string
+	ThumbnailURL  string
+	CreatorID     string
+	CreatorName   string
+	GameID        string
+	VideoID       string
+	Language      string
+	ViewCount     int
+	// Duration is the clip length in seconds
+	Duration float64
+	// VodOffset is the clip's start offset into the VOD in seconds, zero if unknown
+	VodOffset int
+	StreamID  string
+	CreatedAt time.Time
+	PostedAt  time.Time
+}
+
+// Sample is the clip templates are checked and previewed with
+var Sample = Clip{
+	ID:            "AwkwardHelplessSalamanderSwiftRage",
+	StreamerName:  "example_streamer",
+	BroadcasterID: "12345678",
+	Title:         "What a play",
+	URL:           "https://clips.twitch.tv/AwkwardHelplessSalamanderSwiftRage",
+	EmbedURL:      "https://clips.twitch.tv/embed?clip=AwkwardHelplessSalamanderSwiftRage",
+	ThumbnailURL:  "https://clips-media-assets2.twitch.tv/AwkwardHelplessSalamanderSwiftRage-preview-480x272.jpg",
+	CreatorID:     "87654321",
+	CreatorName:   "clip_fan",
+	GameID:        "33214",
+	VideoID:       "1234567890",
+	Language:      "en",
+	ViewCount:     1234,
+	Duration:      28.5,
+	VodOffset:     3725,
+	StreamID:      "40123456789",
+	CreatedAt:     time.Date(2024, 1, 1, 20, 0, 0, 0, time.UTC),
+	PostedAt:      time.Date(2024, 1, 1, 20, 1, 0, 0, time.UTC),
+}
+
+// Spec is the text of a message template. Every part is a text/template
+// executed with a Clip; parts that are left empty are not sent, and fields
+// whose name or value render empty are dropped.
+type Spec struct {
+	Content     string `yaml:"content"`
+	Title       string `yaml:"title"`
+	Description string `yaml:"description"`
+	// Color renders to the embed color as #rrggbb, 0xrrggbb or a decimal number
+	Color  string      `yaml:"color"`
+	Fields []FieldSpec `yaml:"fields"`
+	Footer string      `yaml:"footer"`
+	Author string      `yaml:"author"`
+}
+
+// FieldSpec is the template of an embed field
+type FieldSpec struct {
+	Name   string `yaml:"name"`
+	Value  string `yaml:"value"`
+	Inline bool   `yaml:"inline"`
+}
+
+// Default is the message sent when no template is configured
+var Default = Spec{
+	Title:       "{{.Title}}",
+	Description: "New clip from {{.StreamerName}}!",
+	Color:       "#6441A4",
+	Fields: []FieldSpec{
+		{Name: "Streamer", Value: "{{.StreamerName}}", Inline: true},
+		{Name: "Views", Value: "{{number .ViewCount}}", Inline: true},
+		{Name: "Duration", Value: "{{duration .Duration}}", Inline: true},
+	},
+	Author: "{{with .CreatorName}}Clipped by {{.}}{{end}}",
+}
+
+// Merge returns s with the parts set in override replaced. Fields are
+// replaced as a whole.
+func (s Spec) Merge(override Spec) Spec {
+	for _, part := range []struct{ dst, src *string }{
+		{&s.Content, &override.Content},
+		{&s.Title, &override.Title},
+		{&s.Description, &override.Description},
+		{&s.Color, &override.Color},
+		{&s.Footer, &override.Footer},
+		{&s.Author, &override.Author},
+	} {
+		if *part.src != "" {
+			*part.dst = *part.src
+		}
+	}
+	if len(override.Fields) > 0 {
+		s.Fields = override.Fields
+	}
+	return s
+}
+
+// Error is a problem with one part of a template
+type Error struct {
+	// Part names the part as in the configuration, e.g. title or fields[1].value
+	Part string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %v", e.Part, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Validate parses every part of s and renders it for the Sample clip,
+// returning the problems of each part
+func (s Spec) Validate() []*Error {
+	var problems []*Error
+	if len(s.Fields) > maxFields {
+		problems = append(problems, &Error{Part: "fields", Err: fmt.Errorf("at most %d fields are allowed, got %d", maxFields, len(s.Fields))})
+	}
+	for _, part := range s.parts() {
+		tmpl, err := parse(part.name, part.text)
+		if err == nil {
+			var out string
+			out, err = execute(tmpl, Sample)
+			if err == nil && part.name == "color" {
+				_, err = parseColor(out)
+			}
+		}
+		if err != nil {
+			problems = append(problems, &Error{Part: part.name, Err: err})
+		}
+	}
+	return problems
+}
+
+// part is the text of one part of a Spec
+type part struct {
+	name string
+	text string
+}
+
+// parts lists the parts of s in the order they appear in a Spec
+func (s Spec) parts() []part {
+	parts := []part{
+		{"content", s.Content},
+		{"title", s.Title},
+		{"description", s.Description},
+		{"color", s.Color},
+	}
+	for i, field := range s.Fields {
+		parts = append(parts,
+			part{fmt.Sprintf("fields[%d].name", i), field.Name},
+			part{fmt.Sprintf("fields[%d].value", i), field.Value})
+	}
+	return append(parts, part{"footer", s.Footer}, part{"author", s.Author})
+}
+
+// Template is a parsed Spec
+type Template struct {
+	content     *template.Template
+	title       *template.Template
+	description *template.Template
+	color       *template.Template
+	fields      []fieldTemplate
+	footer      *template.Template
+	author      *template.Template
+}
+
+type fieldTemplate struct {
+	name   *template.Template
+	value  *template.Template
+	inline bool
+}
+
+// Message is a rendered template
+type Message struct {
+	Content     string
+	Title       string
+	Description string
+	// Color is zero if the template sets none
+	Color  int
+	Fields []Field
+	Footer string
+	Author string
+}
+
+// Field is a rendered embed field
+type Field struct {
+	Name   string
+	Value  string
+	Inline bool
+}
+
+// Parse parses every part of a Spec and returns the first problem as an *Error
+func Parse(spec Spec) (*Template, error) {
+	t := &Template{}
+	parsed := make(map[string]*template.Template)
+	for _, part := range spec.parts() {
+		tmpl, err := parse(part.name, part.text)
+		if err != nil {
+			return nil, &Error{Part: part.name, Err: err}
+		}
+		parsed[part.name] = tmpl
+	}
+
+	t.content, t.title, t.description, t.color = parsed["content"], parsed["title"], parsed["description"], parsed["color"]
+	t.footer, t.author = parsed["footer"], parsed["author"]
+	for i, field := range spec.Fields {
+		t.fields = append(t.fields, fieldTemplate{
+			name:   parsed[fmt.Sprintf("fields[%d].name", i)],
+			value:  parsed[fmt.Sprintf("fields[%d].value", i)],
+			inline: field.Inline,
+		})
+	}
+	return t, nil
+}
+
+// MustParse is like Parse but panics on an invalid Spec
+func MustParse(spec Spec) *Template {
+	t, err := Parse(spec)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Execute renders the template for a clip, cutting parts down to the lengths
+// Discord accepts
+func (t *Template) Execute(clip Clip) (*Message, error) {
+	msg := &Message{}
+	for _, part := range []struct {
+		name string
+		tmpl *template.Template
+		dst  *string
+		max  int
+	}{
+		{"content", t.content, &msg.Content, maxContent},
+		{"title", t.title, &msg.Title, maxTitle},
+		{"description", t.description, &msg.Description, maxDescription},
+		{"footer", t.footer, &msg.Footer, maxFooter},
+		{"author", t.author, &msg.Author, maxAuthor},
+	} {
+		out, err := execute(part.tmpl, clip)
+		if err != nil {
+			return nil, &Error{Part: part.name, Err: err}
+		}
+		*part.dst = truncate(part.max, out)
+	}
+
+	color, err := execute(t.color, clip)
+	if err == nil {
+		msg.Color, err = parseColor(color)
+	}
+	if err != nil {
+		return nil, &Error{Part: "color", Err: err}
+	}
+
+	for i, field := range t.fields {
+		name, err := execute(field.name, clip)
+		if err != nil {
+			return nil, &Error{Part: fmt.Sprintf("fields[%d].name", i), Err: err}
+		}
+		value, err := execute(field.value, clip)
+		if err != nil {
+			return nil, &Error{Part: fmt.Sprintf("fields[%d].value", i), Err: err}
+		}
+		if name == "" || value == "" || len(msg.Fields) == maxFields {
+			continue
+		}
+		msg.Fields = append(msg.Fields, Field{
+			Name:   truncate(maxFieldName, name),
+			Value:  truncate(maxFieldValue, value),
+			Inline: field.inline,
+		})
+	}
+	return msg, nil
+}
+
+// funcs are the functions templates can call besides the text/template builtins
+var funcs = template.FuncMap{
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	"truncate": truncate,
+	"duration": duration,
+	"number":   number,
+}
+
+// parse parses one part, nil if it is empty
+func parse(name, text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	return template.New(name).Funcs(funcs).Parse(text)
+}
+
+// execute renders one part with surrounding whitespace trimmed, empty for a
+// nil template
+func execute(tmpl *template.Template, clip Clip) (string, error) {
+	if tmpl == nil {
+		return "", nil
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, clip); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// parseColor reads a color as #rrggbb, 0xrrggbb or a decimal number; an empty
+// string is no color
+func parseColor(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	raw, base := s, 10
+	switch {
+	case strings.HasPrefix(raw, "#"):
+		raw, base = raw[1:], 16
+	case strings.HasPrefix(raw, "0x"), strings.HasPrefix(raw, "0X"):
+		raw, base = raw[2:], 16
+	}
+	color, err := strconv.ParseInt(raw, base, 32)
+	if err != nil || color < 0 || color > 0xFFFFFF {
+		return 0, fmt.Errorf("%q is not a color, expected #rrggbb, 0xrrggbb or a number up to 16777215", s)
+	}
+	return int(color), nil
+}
+
+// truncate cuts s down to n characters, ending it with an ellipsis if it was
+// longer
+func truncate(n int, s string) string {
+	if n <= 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:n-1]) + "…"
+}
+
+// duration formats a number of seconds as 1:02:05, 2:05 or 0:05
+func duration(seconds interface{}) (string, error) {
+	var total int
+	switch v := seconds.(type) {
+	case int:
+		total = v
+	case float64:
+		total = int(v + 0.5)
+	default:
+		return "", fmt.Errorf("duration expects seconds as a number, got %T", seconds)
+	}
+
+	hours, minutes, secs := total/3600, total/60%60, total%60
+	if hours > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", hours, minutes, secs), nil
+	}
+	return fmt.Sprintf("%d:%02d", minutes, secs), nil
+}
+
+// number formats an integer with thousands separators, e.g. 12,345
+func number(n int) string {
+	if n < 0 {
+		return "-" + number(-n)
+	}
+	s := strconv.Itoa(n)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
@@ -0,0 +1,121 @@
+package msgtemplate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestExecute(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		msg, err := MustParse(Default).Execute(Sample)
+		if err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+		if msg.Title != "What a play" || msg.Description != "New clip from example_streamer!" || msg.Color != 0x6441A4 {
+			t.Errorf("Unexpected default message: %+v", msg)
+		}
+		if len(msg.Fields) != 3 || msg.Fields[1].Value != "1,234" || msg.Fields[2].Value != "0:29" || msg.Author != "Clipped by clip_fan" {
+			t.Errorf("Unexpected default fields: %+v", msg)
+		}
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		spec := Default.Merge(Spec{
+			Content: "Neuer Clip von **{{.StreamerName}}**",
+			Color:   "0x9146ff",
+			Fields: []FieldSpec{
+				{Name: "Aufrufe", Value: "{{number .ViewCount}}", Inline: true},
+				{Name: "Länge", Value: "{{duration .Duration}}", Inline: true},
+				{Name: "VOD", Value: "{{if .VodOffset}}{{duration .VodOffset}}{{end}}"},
+			},
+			Footer: "{{upper .Language}}",
+			Author: "{{.CreatorName}}",
+		})
+		clip := Sample
+		clip.ViewCount = 1234567
+		clip.VodOffset = 0
+
+		msg, err := MustParse(spec).Execute(clip)
+		if err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+		if msg.Content != "Neuer Clip von **example_streamer**" || msg.Title != "What a play" || msg.Color != 0x9146FF {
+			t.Errorf("Unexpected message: %+v", msg)
+		}
+		// The VOD field renders empty and is dropped
+		if len(msg.Fields) != 2 || msg.Fields[0].Value != "1,234,567" || msg.Fields[1].Value != "0:29" {
+			t.Errorf("Unexpected fields: %+v", msg.Fields)
+		}
+		if msg.Footer != "EN" || msg.Author != "clip_fan" {
+			t.Errorf("Unexpected footer or author: %+v", msg)
+		}
+	})
+
+	t.Run("truncates", func(t *testing.T) {
+		clip := Sample
+		clip.Title = strings.Repeat("é", 300)
+		msg, err := MustParse(Default).Execute(clip)
+		if err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+		if n := utf8.RuneCountInString(msg.Title); n != maxTitle || !strings.HasSuffix(msg.Title, "…") {
+			t.Errorf("Expected the title cut to %d characters, got %d", maxTitle, n)
+		}
+	})
+}
+
+func TestValidate(t *testing.T) {
+	if problems := Default.Validate(); len(problems) != 0 {
+		t.Fatalf("Expected the default template to be valid, got %v", problems)
+	}
+
+	spec := Spec{
+		Title:  "{{.Title",
+		Color:  "{{.ViewCount}}0000000",
+		Fields: []FieldSpec{{Name: "Game", Value: "{{.GameName}}"}},
+		Footer: "{{shout .Title}}",
+	}
+	var parts []string
+	for _, problem := range spec.Validate() {
+		parts = append(parts, problem.Part)
+	}
+	if got := strings.Join(parts, ","); got != "title,color,fields[0].value,footer" {
+		t.Errorf("Expected problems with title, color, fields[0].value and footer, got %s", got)
+	}
+
+	_, err := Parse(spec)
+	var templateErr *Error
+	if !errors.As(err, &templateErr) || templateErr.Part != "title" {
+		t.Errorf("Expected Parse to report the title, got %v", err)
+	}
+}
+
+func TestFuncs(t *testing.T) {
+	for _, tt := range []struct {
+		seconds interface{}
+		want    string
+	}{
+		{5, "0:05"},
+		{28.5, "0:29"},
+		{3725, "1:02:05"},
+	} {
+		if got, err := duration(tt.seconds); err != nil || got != tt.want {
+			t.Errorf("duration(%v) = %q, %v; want %q", tt.seconds, got, err, tt.want)
+		}
+	}
+	for n, want := range map[int]string{0: "0", 999: "999", 1000: "1,000", -1234567: "-1,234,567"} {
+		if got := number(n); got != want {
+			t.Errorf("number(%d) = %q, want %q", n, got, want)
+		}
+	}
+	for s, want := range map[string]int{"#6441A4": 0x6441A4, "0xffffff": 0xFFFFFF, "255": 255, "": 0} {
+		if got, err := parseColor(s); err != nil || got != want {
+			t.Errorf("parseColor(%q) = %d, %v; want %d", s, got, err, want)
+		}
+	}
+	if _, err := parseColor("#1000000"); err == nil {
+		t.Error("Expected colors above #ffffff to be rejected")
+	}
+}
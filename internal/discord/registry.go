@@ -0,0 +1,123 @@
+package discord
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Registry hands out long-lived clients by webhook URL. Every client shares
+// one HTTP client, so connections to Discord are reused, and clients of the
+// same webhook share a rate limiter even when their URLs differ, as Discord
+// limits each webhook as one route. The rate limit buckets and global limits
+// Discord reports apply to every client of the registry and outlive
+// Reconfigure.
+type Registry struct {
+	mu         sync.Mutex
+	config     ClientConfig
+	httpClient *http.Client
+	clients    map[string]*Client
+	// limiters holds the rate limiter of each route by routeKey
+	limiters map[string]*rate.Limiter
+	// limits holds the rate limit buckets Discord reported to any client
+	limits *rateLimits
+}
+
+// NewRegistry creates a registry whose clients use config; its WebhookURL is ignored
+func NewRegistry(config ClientConfig) *Registry {
+	return &Registry{
+		config:     withDefaults(config),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		clients:    make(map[string]*Client),
+		limiters:   make(map[string]*rate.Limiter),
+		limits:     newRateLimits(),
+	}
+}
+
+// Client returns the client of a webhook, creating it on first use
+func (r *Registry) Client(webhookURL string) *Client {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if client, ok := r.clients[webhookURL]; ok {
+		return client
+	}
+
+	route := routeKey(webhookURL)
+	limiter, ok := r.limiters[route]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Limit(r.config.RateLimit), 1)
+		r.limiters[route] = limiter
+	}
+
+	config := r.config
+	config.WebhookURL = webhookURL
+	client := newClient(&config, r.httpClient, limiter, r.limits)
+	r.clients[webhookURL] = client
+	return client
+}
+
+// Reconfigure applies new client settings and drops the clients of webhooks
+// not in webhookURLs. When the settings change every client is rebuilt;
+// otherwise the remaining clients and their rate limiters are kept. Clients
+// handed out earlier keep working with their old settings.
+func (r *Registry) Reconfigure(config ClientConfig, webhookURLs []string) {
+	config = withDefaults(config)
+	config.WebhookURL = ""
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if config != r.config {
+		r.config = config
+		r.clients = make(map[string]*Client)
+		r.limiters = make(map[string]*rate.Limiter)
+		return
+	}
+
+	keep := make(map[string]bool, len(webhookURLs))
+	routes := make(map[string]bool, len(webhookURLs))
+	for _, webhookURL := range webhookURLs {
+		keep[webhookURL] = true
+		routes[routeKey(webhookURL)] = true
+	}
+	for webhookURL := range r.clients {
+		if !keep[webhookURL] {
+			delete(r.clients, webhookURL)
+		}
+	}
+	for route := range r.limiters {
+		if !routes[route] {
+			delete(r.limiters, route)
+		}
+	}
+}
+
+// Len returns the number of clients in the registry
+func (r *Registry) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.clients)
+}
+
+// routeKey identifies the Discord route of a webhook URL: the webhook ID,
+// which is the same across discord.com, discordapp.com, API versions and
+// query parameters. URLs that are not Discord webhooks are their own route.
+func routeKey(webhookURL string) string {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return webhookURL
+	}
+
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i := 0; i+1 < len(parts); i++ {
+		if parts[i] == "webhooks" {
+			return "webhooks/" + parts[i+1]
+		}
+	}
+	return u.Host + u.Path
+}
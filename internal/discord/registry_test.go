@@ -0,0 +1,38 @@
+package discord
+
+import "testing"
+
+func TestRegistry(t *testing.T) {
+	const (
+		webhook      = "https://discord.com/api/webhooks/1/a"
+		legacy       = "https://discordapp.com/api/v10/webhooks/1/a?wait=true"
+		otherWebhook = "https://discord.com/api/webhooks/2/b"
+	)
+	r := NewRegistry(ClientConfig{Username: "bot"})
+
+	client := r.Client(webhook)
+	if r.Client(webhook) != client {
+		t.Error("Expected the same client for the same webhook")
+	}
+	if r.Client(legacy).rateLimiter != client.rateLimiter {
+		t.Error("Expected URLs of one webhook to share a rate limiter")
+	}
+	if r.Client(otherWebhook).rateLimiter == client.rateLimiter {
+		t.Error("Expected separate rate limiters for separate webhooks")
+	}
+	if client.username != "bot" || client.retryAttempts != 3 {
+		t.Errorf("Expected the registry settings with defaults, got %+v", client)
+	}
+
+	// Unchanged settings keep the clients still in use
+	r.Reconfigure(ClientConfig{Username: "bot"}, []string{webhook, legacy})
+	if r.Len() != 2 || r.Client(webhook) != client {
+		t.Errorf("Expected the unused client dropped and the others kept, got %d clients", r.Len())
+	}
+
+	// Changed settings rebuild every client
+	r.Reconfigure(ClientConfig{Username: "bot", RateLimit: 1}, []string{webhook})
+	if rebuilt := r.Client(webhook); rebuilt == client || rebuilt.rateLimiter.Limit() != 1 {
+		t.Error("Expected a new client with the new rate limit")
+	}
+}
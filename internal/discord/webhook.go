@@ -2,18 +2,30 @@ package discord
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"twitchclipsearch/internal/metrics"
 )
 
+// defaultRetryAfter is how long to wait on a 429 that does not say
+const defaultRetryAfter = 5 * time.Second
+
 // WebhookError represents a Discord webhook error
 type WebhookError struct {
 	StatusCode int
 	Message    string
-	RetryAfter int
+	// RetryAfter is how long Discord asked to wait before retrying, zero if
+	// it did not
+	RetryAfter time.Duration
+	// Global is set when the rate limit applies to every webhook
+	Global bool
 }
 
 func (e *WebhookError) Error() string {
@@ -22,12 +34,53 @@ func (e *WebhookError) Error() string {
 
 // IsRateLimitError checks if the error is a rate limit error
 func IsRateLimitError(err error) bool {
-	if webhookErr, ok := err.(*WebhookError); ok {
+	var webhookErr *WebhookError
+	if errors.As(err, &webhookErr) {
 		return webhookErr.StatusCode == http.StatusTooManyRequests
 	}
 	return false
 }
 
+// IsRetryable reports whether a failed delivery may succeed when retried:
+// rate limits, server errors and network failures, but not rejected requests
+// such as a deleted webhook
+func IsRetryable(err error) bool {
+	var webhookErr *WebhookError
+	if !errors.As(err, &webhookErr) {
+		return true
+	}
+	return webhookErr.StatusCode == http.StatusTooManyRequests || webhookErr.StatusCode >= 500
+}
+
+// rateLimitHeaders is the rate limit state Discord reports with a response
+type rateLimitHeaders struct {
+	// Bucket identifies the rate limit shared by the routes reporting it
+	Bucket string
+	// Remaining is the requests left in the bucket, -1 if not reported
+	Remaining int
+	// ResetAfter is when the bucket refills
+	ResetAfter time.Duration
+}
+
+// parseRateLimitHeaders reads the X-RateLimit-* headers of a response
+func parseRateLimitHeaders(header http.Header) rateLimitHeaders {
+	limit := rateLimitHeaders{Bucket: header.Get("X-RateLimit-Bucket"), Remaining: -1}
+	if remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining")); err == nil {
+		limit.Remaining = remaining
+	}
+	limit.ResetAfter = parseSeconds(header.Get("X-RateLimit-Reset-After"))
+	return limit
+}
+
+// parseSeconds parses a possibly fractional number of seconds, zero if invalid
+func parseSeconds(value string) time.Duration {
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
 // handleWebhookResponse processes the webhook response and returns appropriate error
 func handleWebhookResponse(resp *http.Response) error {
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
@@ -43,47 +96,147 @@ func handleWebhookResponse(resp *http.Response) error {
 	if resp.StatusCode == http.StatusTooManyRequests {
 		// Record rate limit metric
 		metrics.RecordRateLimitHit("discord_webhook")
-		
-		// Parse retry-after header
-		if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
-			webhookErr.Message = "rate limit exceeded"
-			// Add retry delay logic here if needed
+		webhookErr.Message = "rate limit exceeded"
+
+		// The body is more precise than the Retry-After header, which is
+		// rounded up to whole seconds
+		var body struct {
+			RetryAfter float64 `json:"retry_after"`
+			Global     bool    `json:"global"`
+		}
+		if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&body); err == nil && body.RetryAfter > 0 {
+			webhookErr.RetryAfter = time.Duration(body.RetryAfter * float64(time.Second))
+		} else {
+			webhookErr.RetryAfter = parseSeconds(resp.Header.Get("Retry-After"))
+		}
+		webhookErr.Global = body.Global || resp.Header.Get("X-RateLimit-Global") == "true"
+		if webhookErr.RetryAfter == 0 {
+			webhookErr.RetryAfter = defaultRetryAfter
 		}
 	}
 
 	return webhookErr
 }
 
-// retryWithBackoff implements exponential backoff for retrying failed requests
-func retryWithBackoff(ctx context.Context, fn func() error, maxAttempts int) error {
-	var lastErr error
+// rateLimits tracks the Discord rate limit buckets of the routes a set of
+// clients send to, so that requests pause before a bucket is exhausted rather
+// than run into a 429
+type rateLimits struct {
+	mu sync.Mutex
+	// buckets maps routes to the bucket Discord reported for them
+	buckets map[string]string
+	// resets holds when each exhausted bucket refills, keyed by bucket or by
+	// route while its bucket is unknown
+	resets map[string]time.Time
+	// globalReset is when a global rate limit ends
+	globalReset time.Time
+}
 
-	for attempt := 0; attempt < maxAttempts; attempt++ {
-		if err := ctx.Err(); err != nil {
-			return fmt.Errorf("context cancelled: %w", err)
+func newRateLimits() *rateLimits {
+	return &rateLimits{
+		buckets: make(map[string]string),
+		resets:  make(map[string]time.Time),
+	}
+}
+
+// key returns the bucket of a route, or the route if its bucket is unknown.
+// The caller must hold l.mu.
+func (l *rateLimits) key(route string) string {
+	if bucket, ok := l.buckets[route]; ok {
+		return bucket
+	}
+	return route
+}
+
+// delay returns how long a request to route must wait
+func (l *rateLimits) delay(route string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	reset := l.globalReset
+	if bucketReset, ok := l.resets[l.key(route)]; ok && bucketReset.After(reset) {
+		reset = bucketReset
+	}
+	if !reset.After(now) {
+		return 0
+	}
+	return reset.Sub(now)
+}
+
+// update records the rate limit state of a response from route, whose error
+// is the one handleWebhookResponse returned
+func (l *rateLimits) update(route string, limit rateLimitHeaders, err error, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if limit.Bucket != "" {
+		l.buckets[route] = limit.Bucket
+	}
+	key := l.key(route)
+
+	switch {
+	case limit.Remaining == 0:
+		l.resets[key] = now.Add(limit.ResetAfter)
+	case limit.Remaining > 0:
+		delete(l.resets, key)
+	}
+	if limit.Remaining >= 0 {
+		metrics.RecordRateLimitRemaining("discord_webhook", float64(limit.Remaining))
+	}
+
+	var webhookErr *WebhookError
+	if errors.As(err, &webhookErr) && webhookErr.StatusCode == http.StatusTooManyRequests {
+		reset := now.Add(webhookErr.RetryAfter)
+		if webhookErr.Global {
+			l.globalReset = reset
+		} else if reset.After(l.resets[key]) {
+			l.resets[key] = reset
 		}
+	}
+}
 
-		if err := fn(); err == nil {
-			return nil
-		} else {
-			lastErr = err
-			
+// retryWithBackoff calls fn until it succeeds, fails with an error that is
+// not worth retrying or has been called maxAttempts times, waiting backoff,
+// then twice as long and so on between attempts. Rate limits are waited out
+// by fn itself.
+func retryWithBackoff(ctx context.Context, fn func() error, maxAttempts int, backoff time.Duration) error {
+	var lastErr error
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if attempt > 0 {
 			// Record retry metric
 			metrics.RecordRetryAttempt("discord_webhook")
+		}
 
-			// If it's a rate limit error, use the retry-after value
-			if IsRateLimitError(err) {
-				time.Sleep(time.Second * 5) // Default retry delay for rate limits
-				continue
-			}
-
-			// Exponential backoff
-			if attempt < maxAttempts-1 {
-				backoff := time.Second * time.Duration(1<<uint(attempt))
-				time.Sleep(backoff)
-			}
+		lastErr = fn()
+		if lastErr == nil || !IsRetryable(lastErr) {
+			return lastErr
+		}
+		if IsRateLimitError(lastErr) || attempt == maxAttempts-1 {
+			continue
+		}
+
+		// Exponential backoff
+		if err := sleep(ctx, backoff<<uint(attempt)); err != nil {
+			return err
 		}
 	}
 
 	return fmt.Errorf("max retry attempts reached: %w", lastErr)
-}
\ No newline at end of file
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
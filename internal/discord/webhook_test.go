@@ -0,0 +1,149 @@
+package discord
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"twitchclipsearch/internal/database"
+)
+
+// discordStandIn answers webhook requests with the responses of respond,
+// called with the request path and its number, counting from 0
+type discordStandIn struct {
+	mu       sync.Mutex
+	requests map[string][]time.Time
+	respond  func(w http.ResponseWriter, path string, n int)
+}
+
+func newDiscordStandIn(t *testing.T, respond func(w http.ResponseWriter, path string, n int)) (*discordStandIn, string) {
+	d := &discordStandIn{requests: make(map[string][]time.Time), respond: respond}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.mu.Lock()
+		n := len(d.requests[r.URL.Path])
+		d.requests[r.URL.Path] = append(d.requests[r.URL.Path], time.Now())
+		d.mu.Unlock()
+		d.respond(w, r.URL.Path, n)
+	}))
+	t.Cleanup(server.Close)
+	return d, server.URL
+}
+
+func (d *discordStandIn) times(path string) []time.Time {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]time.Time(nil), d.requests[path]...)
+}
+
+func testClip() *database.Clip {
+	return &database.Clip{ID: "clip", StreamerName: "shroud", Title: "Nice", URL: "https://clips.twitch.tv/clip", CreatedAt: time.Now()}
+}
+
+func TestRateLimits(t *testing.T) {
+	const hookA, hookB = "/api/webhooks/1/a", "/api/webhooks/2/b"
+
+	t.Run("retries after a 429", func(t *testing.T) {
+		d, base := newDiscordStandIn(t, func(w http.ResponseWriter, path string, n int) {
+			if n == 0 {
+				w.Header().Set("Retry-After", "1")
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusTooManyRequests)
+				fmt.Fprint(w, `{"message": "You are being rate limited.", "retry_after": 0.1, "global": false}`)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+		r := NewRegistry(ClientConfig{RateLimit: 1000})
+
+		if err := r.Client(base + hookA).SendClipNotification(testClip()); err != nil {
+			t.Fatalf("Expected the retry to succeed, got %v", err)
+		}
+		times := d.times(hookA)
+		if len(times) != 2 {
+			t.Fatalf("Expected 2 requests, got %d", len(times))
+		}
+		// The body's retry_after is more precise than the header
+		if wait := times[1].Sub(times[0]); wait < 100*time.Millisecond || wait > 900*time.Millisecond {
+			t.Errorf("Expected the retry after about 100ms, got %v", wait)
+		}
+	})
+
+	t.Run("pauses when a bucket is exhausted", func(t *testing.T) {
+		d, base := newDiscordStandIn(t, func(w http.ResponseWriter, path string, n int) {
+			w.Header().Set("X-RateLimit-Bucket", "shared")
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset-After", "0.15")
+			w.WriteHeader(http.StatusNoContent)
+		})
+		r := NewRegistry(ClientConfig{RateLimit: 1000})
+
+		if err := r.Client(base + hookA).SendClipNotification(testClip()); err != nil {
+			t.Fatalf("First send failed: %v", err)
+		}
+		if err := r.Client(base + hookA).SendClipNotification(testClip()); err != nil {
+			t.Fatalf("Second send failed: %v", err)
+		}
+		times := d.times(hookA)
+		if len(times) != 2 || times[1].Sub(times[0]) < 150*time.Millisecond {
+			t.Errorf("Expected the second request to wait for the bucket reset, got %v", times)
+		}
+	})
+
+	t.Run("global limits pause every webhook", func(t *testing.T) {
+		d, base := newDiscordStandIn(t, func(w http.ResponseWriter, path string, n int) {
+			if path == hookA && n == 0 {
+				w.Header().Set("X-RateLimit-Global", "true")
+				w.Header().Set("Retry-After", "0.2")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+		r := NewRegistry(ClientConfig{RateLimit: 1000, RetryAttempts: 1})
+
+		start := time.Now()
+		if err := r.Client(base + hookA).SendClipNotification(testClip()); !IsRateLimitError(err) {
+			t.Fatalf("Expected a rate limit error without retries, got %v", err)
+		}
+		if err := r.Client(base + hookB).SendClipNotification(testClip()); err != nil {
+			t.Fatalf("Send to the other webhook failed: %v", err)
+		}
+		if times := d.times(hookB); len(times) != 1 || times[0].Sub(start) < 200*time.Millisecond {
+			t.Errorf("Expected the other webhook to wait out the global limit, got %v", times)
+		}
+	})
+
+	t.Run("backs off on server errors only", func(t *testing.T) {
+		d, base := newDiscordStandIn(t, func(w http.ResponseWriter, path string, n int) {
+			if path == hookB {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if n < 2 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+		r := NewRegistry(ClientConfig{RateLimit: 1000})
+
+		client := r.Client(base + hookA)
+		client.backoff = 10 * time.Millisecond
+		if err := client.SendClipNotification(testClip()); err != nil {
+			t.Fatalf("Expected the third attempt to succeed, got %v", err)
+		}
+		if n := len(d.times(hookA)); n != 3 {
+			t.Errorf("Expected 3 attempts, got %d", n)
+		}
+
+		if err := r.Client(base + hookB).SendClipNotification(testClip()); err == nil {
+			t.Error("Expected a deleted webhook to fail")
+		}
+		if n := len(d.times(hookB)); n != 1 {
+			t.Errorf("Expected a deleted webhook not to be retried, got %d attempts", n)
+		}
+	})
+}
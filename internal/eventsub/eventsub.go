@@ -0,0 +1,219 @@
+// Package eventsub receives Twitch EventSub webhook notifications
+package eventsub
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"twitchclipsearch/internal/logger"
+	"twitchclipsearch/internal/metrics"
+)
+
+// Twitch EventSub request headers
+const (
+	HeaderMessageID        = "Twitch-Eventsub-Message-Id"
+	HeaderMessageTimestamp = "Twitch-Eventsub-Message-Timestamp"
+	HeaderMessageSignature = "Twitch-Eventsub-Message-Signature"
+	HeaderMessageType      = "Twitch-Eventsub-Message-Type"
+)
+
+// Twitch EventSub message types
+const (
+	MessageTypeVerification = "webhook_callback_verification"
+	MessageTypeNotification = "notification"
+	MessageTypeRevocation   = "revocation"
+)
+
+// Subscription types that should trigger a clip fetch
+const (
+	TypeStreamOnline  = "stream.online"
+	TypeStreamOffline = "stream.offline"
+	TypeChannelUpdate = "channel.update"
+)
+
+// DefaultReplayWindow is how far a message's timestamp may be from now before
+// it is rejected, as recommended by Twitch
+const DefaultReplayWindow = 10 * time.Minute
+
+// maxBodySize bounds the size of accepted notification bodies
+const maxBodySize = 1 << 20
+
+// Event is a verified notification about a broadcaster
+type Event struct {
+	MessageID        string
+	Type             string
+	BroadcasterID    string
+	BroadcasterLogin string
+	// Raw is the undecoded event object
+	Raw json.RawMessage
+}
+
+// Handler is the EventSub webhook callback endpoint. It verifies message
+// signatures, rejects stale and replayed messages, answers the challenge
+// handshake and passes notifications to the event callback.
+type Handler struct {
+	secret       []byte
+	onEvent      func(Event)
+	replayWindow time.Duration
+	now          func() time.Time
+
+	mu sync.Mutex
+	// seen maps handled message IDs to when they can be forgotten
+	seen map[string]time.Time
+}
+
+// NewHandler creates a handler verifying messages with secret. onEvent is
+// called synchronously for every new notification and must not block.
+func NewHandler(secret string, onEvent func(Event)) *Handler {
+	return &Handler{
+		secret:       []byte(secret),
+		onEvent:      onEvent,
+		replayWindow: DefaultReplayWindow,
+		now:          time.Now,
+		seen:         make(map[string]time.Time),
+	}
+}
+
+// message is the body shared by every EventSub message type
+type message struct {
+	Challenge    string `json:"challenge"`
+	Subscription struct {
+		ID     string `json:"id"`
+		Type   string `json:"type"`
+		Status string `json:"status"`
+	} `json:"subscription"`
+	Event json.RawMessage `json:"event"`
+}
+
+// broadcasterEvent holds the fields common to broadcaster events
+type broadcasterEvent struct {
+	BroadcasterUserID    string `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string `json:"broadcaster_user_login"`
+}
+
+// ServeHTTP handles an EventSub callback request
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	messageID := r.Header.Get(HeaderMessageID)
+	timestamp := r.Header.Get(HeaderMessageTimestamp)
+
+	if !hmac.Equal([]byte(Sign(string(h.secret), messageID, timestamp, body)), []byte(r.Header.Get(HeaderMessageSignature))) {
+		metrics.RecordError("eventsub_invalid_signature")
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+
+	// Messages are only accepted within the replay window on either side of
+	// now, so that a captured message cannot be replayed once its ID expired
+	sentAt, err := time.Parse(time.RFC3339Nano, timestamp)
+	if age := h.now().Sub(sentAt); err != nil || age > h.replayWindow || age < -h.replayWindow {
+		metrics.RecordError("eventsub_stale_message")
+		http.Error(w, "stale message", http.StatusForbidden)
+		return
+	}
+
+	// Twitch redelivers messages it is unsure we received; acknowledge those
+	// without handling them twice. The ID is released again unless the
+	// message is handled, so that Twitch's retry of a failed one gets through.
+	if !h.markSeen(messageID, sentAt) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	handled := false
+	defer func() {
+		if !handled {
+			h.forget(messageID)
+		}
+	}()
+
+	var msg message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		http.Error(w, "invalid message", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Header.Get(HeaderMessageType) {
+	case MessageTypeVerification:
+		logger.Info("EventSub subscription verified", "subscription_id", msg.Subscription.ID, "type", msg.Subscription.Type)
+		w.Header().Set("Content-Type", "text/plain")
+		handled = true
+		io.WriteString(w, msg.Challenge)
+
+	case MessageTypeNotification:
+		var event broadcasterEvent
+		if err := json.Unmarshal(msg.Event, &event); err != nil {
+			http.Error(w, "invalid event", http.StatusBadRequest)
+			return
+		}
+		h.onEvent(Event{
+			MessageID:        messageID,
+			Type:             msg.Subscription.Type,
+			BroadcasterID:    event.BroadcasterUserID,
+			BroadcasterLogin: event.BroadcasterUserLogin,
+			Raw:              msg.Event,
+		})
+		handled = true
+		w.WriteHeader(http.StatusNoContent)
+
+	case MessageTypeRevocation:
+		logger.Warn("EventSub subscription revoked", "subscription_id", msg.Subscription.ID,
+			"type", msg.Subscription.Type, "status", msg.Subscription.Status)
+		handled = true
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "unknown message type", http.StatusBadRequest)
+	}
+}
+
+// markSeen records a message ID and reports whether it was new. IDs are
+// forgotten once their messages would be rejected as stale anyway: a
+// replay window after they were received or, for messages dated ahead of
+// our clock, after they were sent.
+func (h *Handler) markSeen(messageID string, sentAt time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := h.now()
+	for id, expires := range h.seen {
+		if now.After(expires) {
+			delete(h.seen, id)
+		}
+	}
+
+	if _, ok := h.seen[messageID]; ok {
+		return false
+	}
+	if sentAt.Before(now) {
+		sentAt = now
+	}
+	h.seen[messageID] = sentAt.Add(h.replayWindow)
+	return true
+}
+
+// forget releases a message ID that was marked seen but not handled
+func (h *Handler) forget(messageID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.seen, messageID)
+}
+
+// Sign returns the Twitch-Eventsub-Message-Signature header value for a message
+func Sign(secret, messageID, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(messageID))
+	mac.Write([]byte(timestamp))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
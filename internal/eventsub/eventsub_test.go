@@ -0,0 +1,168 @@
+package eventsub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "s3cre7-for-tests"
+
+// sender stands in for Twitch, signing messages the way it does
+type sender struct {
+	t       *testing.T
+	handler http.Handler
+	secret  string
+}
+
+func (s *sender) send(messageType, messageID string, sentAt time.Time, body string) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	timestamp := sentAt.UTC().Format(time.RFC3339Nano)
+	req := httptest.NewRequest(http.MethodPost, "/eventsub", strings.NewReader(body))
+	req.Header.Set(HeaderMessageID, messageID)
+	req.Header.Set(HeaderMessageTimestamp, timestamp)
+	req.Header.Set(HeaderMessageType, messageType)
+	req.Header.Set(HeaderMessageSignature, Sign(s.secret, messageID, timestamp, []byte(body)))
+
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+const onlineBody = `{
+	"subscription": {"id": "sub-1", "type": "stream.online", "version": "1", "status": "enabled"},
+	"event": {"id": "9001", "broadcaster_user_id": "1337", "broadcaster_user_login": "cool_user", "type": "live"}
+}`
+
+func TestHandler(t *testing.T) {
+	var events []Event
+	handler := NewHandler(testSecret, func(event Event) {
+		events = append(events, event)
+	})
+	twitch := &sender{t: t, handler: handler, secret: testSecret}
+	now := time.Now()
+
+	t.Run("challenge", func(t *testing.T) {
+		rec := twitch.send(MessageTypeVerification, "msg-challenge", now,
+			`{"challenge": "pogchamp-kappa-360noscope-vohiyo", "subscription": {"id": "sub-1", "type": "stream.online"}}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+		}
+		if got := rec.Body.String(); got != "pogchamp-kappa-360noscope-vohiyo" {
+			t.Errorf("Expected challenge in body, got %q", got)
+		}
+		if got := rec.Header().Get("Content-Type"); got != "text/plain" {
+			t.Errorf("Expected text/plain content type, got %q", got)
+		}
+	})
+
+	t.Run("notification", func(t *testing.T) {
+		rec := twitch.send(MessageTypeNotification, "msg-1", now, onlineBody)
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("Expected status %d, got %d", http.StatusNoContent, rec.Code)
+		}
+		if len(events) != 1 {
+			t.Fatalf("Expected 1 event, got %d", len(events))
+		}
+		event := events[0]
+		if event.Type != TypeStreamOnline || event.BroadcasterID != "1337" || event.BroadcasterLogin != "cool_user" || event.MessageID != "msg-1" {
+			t.Errorf("Unexpected event %+v", event)
+		}
+	})
+
+	t.Run("duplicate", func(t *testing.T) {
+		rec := twitch.send(MessageTypeNotification, "msg-1", now, onlineBody)
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("Expected status %d, got %d", http.StatusNoContent, rec.Code)
+		}
+		if len(events) != 1 {
+			t.Errorf("Expected redelivered message to be ignored, got %d events", len(events))
+		}
+	})
+
+	t.Run("stale", func(t *testing.T) {
+		rec := twitch.send(MessageTypeNotification, "msg-stale", now.Add(-DefaultReplayWindow-time.Minute), onlineBody)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("Expected status %d, got %d", http.StatusForbidden, rec.Code)
+		}
+	})
+
+	t.Run("future", func(t *testing.T) {
+		rec := twitch.send(MessageTypeNotification, "msg-future", now.Add(DefaultReplayWindow+time.Minute), onlineBody)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("Expected status %d, got %d", http.StatusForbidden, rec.Code)
+		}
+	})
+
+	t.Run("bad signature", func(t *testing.T) {
+		forger := &sender{t: t, handler: handler, secret: "not-the-secret"}
+		rec := forger.send(MessageTypeNotification, "msg-forged", now, onlineBody)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("Expected status %d, got %d", http.StatusForbidden, rec.Code)
+		}
+	})
+
+	t.Run("revocation", func(t *testing.T) {
+		rec := twitch.send(MessageTypeRevocation, "msg-revoked", now,
+			`{"subscription": {"id": "sub-1", "type": "stream.online", "status": "authorization_revoked"}}`)
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("Expected status %d, got %d", http.StatusNoContent, rec.Code)
+		}
+	})
+
+	if len(events) != 1 {
+		t.Errorf("Expected only the first notification to be dispatched, got %d events", len(events))
+	}
+}
+
+func TestHandlerRetriesFailedMessages(t *testing.T) {
+	var calls int
+	handler := NewHandler(testSecret, func(event Event) {
+		calls++
+		if calls == 1 {
+			panic("handling failed")
+		}
+	})
+	twitch := &sender{t: t, handler: handler, secret: testSecret}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("Expected the failed handling to panic")
+			}
+		}()
+		twitch.send(MessageTypeNotification, "msg-retried", time.Now(), onlineBody)
+	}()
+
+	// Twitch retries the message it got no answer for
+	if rec := twitch.send(MessageTypeNotification, "msg-retried", time.Now(), onlineBody); rec.Code != http.StatusNoContent || calls != 2 {
+		t.Errorf("Expected the retry to be handled, got status %d and %d call(s)", rec.Code, calls)
+	}
+	if rec := twitch.send(MessageTypeNotification, "msg-retried", time.Now(), onlineBody); rec.Code != http.StatusNoContent || calls != 2 {
+		t.Errorf("Expected the handled message to be ignored as a replay, got %d call(s)", calls)
+	}
+}
+
+func TestHandlerRejectsReplayedFutureMessages(t *testing.T) {
+	var calls int
+	handler := NewHandler(testSecret, func(event Event) { calls++ })
+	clock := time.Now()
+	handler.now = func() time.Time { return clock }
+	twitch := &sender{t: t, handler: handler, secret: testSecret}
+
+	// Dated ahead of our clock, but within the replay window
+	sentAt := clock.Add(DefaultReplayWindow - time.Minute)
+	if rec := twitch.send(MessageTypeNotification, "msg-ahead", sentAt, onlineBody); rec.Code != http.StatusNoContent || calls != 1 {
+		t.Fatalf("Expected the message handled, got status %d and %d call(s)", rec.Code, calls)
+	}
+
+	// A replay window after receipt the message is still fresh, so its ID
+	// must not have expired yet
+	clock = clock.Add(DefaultReplayWindow + time.Minute)
+	if rec := twitch.send(MessageTypeNotification, "msg-ahead", sentAt, onlineBody); rec.Code != http.StatusNoContent || calls != 1 {
+		t.Errorf("Expected the replay ignored, got status %d and %d call(s)", rec.Code, calls)
+	}
+}
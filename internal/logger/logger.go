@@ -1,6 +1,9 @@
 package logger
 
 import (
+	"fmt"
+	"sync/atomic"
+
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -10,21 +13,59 @@ type Logger struct {
 	*zap.Logger
 }
 
-// NewLogger creates a new logger instance
-func NewLogger() *Logger {
+// global is the sugared logger used by the package-level helpers
+var global atomic.Pointer[zap.SugaredLogger]
+
+func init() {
+	global.Store(zap.NewNop().Sugar())
+}
+
+// NewLogger creates a new logger instance logging at level (debug, info,
+// warn or error; info if empty) and installs it as the package-level logger
+func NewLogger(level string) (*Logger, error) {
 	config := zap.NewProductionConfig()
 	config.EncoderConfig.TimeKey = "timestamp"
 	config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
 
+	if level != "" {
+		lvl, err := zapcore.ParseLevel(level)
+		if err != nil {
+			return nil, fmt.Errorf("invalid log level %q", level)
+		}
+		config.Level = zap.NewAtomicLevelAt(lvl)
+	}
+
 	logger, err := config.Build()
 	if err != nil {
 		panic("failed to initialize logger: " + err.Error())
 	}
 
-	return &Logger{Logger: logger}
+	global.Store(logger.Sugar())
+
+	return &Logger{Logger: logger}, nil
 }
 
 // Sync flushes any buffered log entries
 func (l *Logger) Sync() error {
 	return l.Logger.Sync()
-}
\ No newline at end of file
+}
+
+// Debug logs a debug message with optional key-value pairs
+func Debug(msg string, keysAndValues ...interface{}) {
+	global.Load().Debugw(msg, keysAndValues...)
+}
+
+// Info logs an informational message with optional key-value pairs
+func Info(msg string, keysAndValues ...interface{}) {
+	global.Load().Infow(msg, keysAndValues...)
+}
+
+// Warn logs a warning message with optional key-value pairs
+func Warn(msg string, keysAndValues ...interface{}) {
+	global.Load().Warnw(msg, keysAndValues...)
+}
+
+// Error logs an error message with optional key-value pairs
+func Error(msg string, keysAndValues ...interface{}) {
+	global.Load().Errorw(msg, keysAndValues...)
+}
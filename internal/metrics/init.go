@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"sync"
+	"time"
 )
 
 var (
@@ -23,6 +24,13 @@ func RecordRateLimitHit(service string) {
 	}
 }
 
+// RecordRateLimitRemaining records the requests left in a service's rate limit bucket
+func RecordRateLimitRemaining(service string, remaining float64) {
+	if metrics != nil {
+		metrics.SetRateLimitRemaining(service, remaining)
+	}
+}
+
 // RecordRetryAttempt records a retry attempt for the specified service
 func RecordRetryAttempt(service string) {
 	if metrics != nil {
@@ -35,4 +43,68 @@ func RecordError(errorType string) {
 	if metrics != nil {
 		metrics.ClipsFailed.WithLabelValues("system", errorType).Inc()
 	}
-}
\ No newline at end of file
+}
+
+// RecordWorkerPoolSize records the number of workers in a pool
+func RecordWorkerPoolSize(pool string, size float64) {
+	if metrics != nil {
+		metrics.SetWorkerPoolSize(pool, size)
+	}
+}
+
+// RecordQueueSize records the current size of a worker queue
+func RecordQueueSize(pool string, size float64) {
+	if metrics != nil {
+		metrics.SetQueueSize(pool, size)
+	}
+}
+
+// RecordWorkerUtilization records the current utilization of a worker pool
+func RecordWorkerUtilization(pool string, utilization float64) {
+	if metrics != nil {
+		metrics.SetWorkerUtilization(pool, utilization)
+	}
+}
+
+// RecordTokenRefresh records an app access token request and its outcome
+func RecordTokenRefresh(success bool) {
+	if metrics != nil {
+		status := "success"
+		if !success {
+			status = "failure"
+		}
+		metrics.RecordTokenRefresh(status)
+	}
+}
+
+// RecordConfigReload records a configuration reload and whether it was applied
+func RecordConfigReload(success bool) {
+	if metrics != nil {
+		status := "success"
+		if !success {
+			status = "failure"
+		}
+		metrics.RecordConfigReload(status)
+	}
+}
+
+// RecordNotification records the outcome of an outbox delivery attempt:
+// delivered, retrying or dead, or filtered for a clip that never reached a
+// destination's minimum views
+func RecordNotification(status string) {
+	if metrics != nil {
+		metrics.RecordNotification(status)
+	}
+}
+
+// RecordTokenExpiry records when the current app access token expires, or the
+// zero time if there is no valid token
+func RecordTokenExpiry(expiresAt time.Time) {
+	if metrics != nil {
+		if expiresAt.IsZero() {
+			metrics.SetTokenExpiry(0)
+			return
+		}
+		metrics.SetTokenExpiry(float64(expiresAt.Unix()))
+	}
+}
@@ -8,13 +8,19 @@ import (
 
 // Metrics holds all the Prometheus metrics for the application
 type Metrics struct {
-	ClipsProcessed   *prometheus.CounterVec
-	ClipsFailed      *prometheus.CounterVec
-	ProcessingTime   *prometheus.HistogramVec
-	APIRequestsTotal *prometheus.CounterVec
-	APILatency       *prometheus.HistogramVec
-	QueueSize        *prometheus.GaugeVec
+	ClipsProcessed    *prometheus.CounterVec
+	ClipsFailed       *prometheus.CounterVec
+	ProcessingTime    *prometheus.HistogramVec
+	APIRequestsTotal  *prometheus.CounterVec
+	APILatency        *prometheus.HistogramVec
+	QueueSize         *prometheus.GaugeVec
 	WorkerUtilization *prometheus.GaugeVec
+	WorkerPoolSize    *prometheus.GaugeVec
+	TokenRefreshes    *prometheus.CounterVec
+	TokenExpiry       prometheus.Gauge
+	RateLimitBudget   *prometheus.GaugeVec
+	ConfigReloads     *prometheus.CounterVec
+	Notifications     *prometheus.CounterVec
 }
 
 // New creates and registers all application metrics
@@ -78,6 +84,53 @@ func New(namespace string) *Metrics {
 			},
 			[]string{"pool"},
 		),
+		WorkerPoolSize: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "worker_pool_size",
+				Help:      "Number of workers in the pool",
+			},
+			[]string{"pool"},
+		),
+		TokenRefreshes: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "twitch_token_refreshes_total",
+				Help:      "Total number of Twitch app access token requests",
+			},
+			[]string{"status"},
+		),
+		TokenExpiry: promauto.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "twitch_token_expiry_timestamp_seconds",
+				Help:      "Unix time at which the current Twitch app access token expires, 0 without a token",
+			},
+		),
+		RateLimitBudget: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "rate_limit_remaining",
+				Help:      "Requests left in the current rate limit bucket",
+			},
+			[]string{"service"},
+		),
+		ConfigReloads: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "config_reloads_total",
+				Help:      "Total number of configuration reloads",
+			},
+			[]string{"status"},
+		),
+		Notifications: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "notifications_total",
+				Help:      "Total number of Discord notification delivery attempts from the outbox",
+			},
+			[]string{"status"},
+		),
 	}
 }
 
@@ -114,4 +167,34 @@ func (m *Metrics) SetQueueSize(pool string, size float64) {
 // SetWorkerUtilization sets the worker utilization metric
 func (m *Metrics) SetWorkerUtilization(pool string, utilization float64) {
 	m.WorkerUtilization.WithLabelValues(pool).Set(utilization)
-}
\ No newline at end of file
+}
+
+// SetWorkerPoolSize sets the worker pool size metric
+func (m *Metrics) SetWorkerPoolSize(pool string, size float64) {
+	m.WorkerPoolSize.WithLabelValues(pool).Set(size)
+}
+
+// RecordTokenRefresh increments the token refresh counter
+func (m *Metrics) RecordTokenRefresh(status string) {
+	m.TokenRefreshes.WithLabelValues(status).Inc()
+}
+
+// SetTokenExpiry sets the token expiry metric
+func (m *Metrics) SetTokenExpiry(expiresAt float64) {
+	m.TokenExpiry.Set(expiresAt)
+}
+
+// RecordConfigReload increments the config reload counter
+func (m *Metrics) RecordConfigReload(status string) {
+	m.ConfigReloads.WithLabelValues(status).Inc()
+}
+
+// SetRateLimitRemaining sets the remaining rate limit budget metric
+func (m *Metrics) SetRateLimitRemaining(service string, remaining float64) {
+	m.RateLimitBudget.WithLabelValues(service).Set(remaining)
+}
+
+// RecordNotification increments the notification delivery counter
+func (m *Metrics) RecordNotification(status string) {
+	m.Notifications.WithLabelValues(status).Inc()
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"twitchclipsearch/internal/database"
+	"twitchclipsearch/internal/logger"
+	"twitchclipsearch/internal/metrics"
+)
+
+const (
+	// DefaultBackfillWindow is the span of clips requested per query, matching
+	// the range Twitch applies when no end time is given
+	DefaultBackfillWindow = 7 * 24 * time.Hour
+	// minBackfillWindow stops windows that overflow the page limit from being
+	// split any further
+	minBackfillWindow = time.Hour
+)
+
+// BackfillOptions controls a backfill of a streamer's clip archive
+type BackfillOptions struct {
+	// Since and Until bound the clip creation times to import. Until defaults
+	// to now.
+	Since time.Time
+	Until time.Time
+	// Window is the span requested per query. Windows holding more clips than
+	// the page limit are split in half until they fit.
+	Window time.Duration
+	// Notify posts the imported clips to the streamer's Discord webhook,
+	// delivering the streamer's notifications after every window
+	Notify bool
+	// Restart ignores the checkpoint of a previous run with the same Since
+	Restart bool
+}
+
+// BackfillResult summarizes a backfill run
+type BackfillResult struct {
+	Windows int
+	Fetched int
+	Saved   int
+	// ResumedFrom is where the run picked up a previous one, zero if it did not
+	ResumedFrom time.Time
+}
+
+// Backfill imports a streamer's clips created between opts.Since and
+// opts.Until, walking the range window by window. Progress is checkpointed
+// after every window, so an interrupted backfill resumes when run again with
+// the same Since. Twitch requests go through the service rate limiter.
+func (s *ClipService) Backfill(ctx context.Context, streamerName string, opts BackfillOptions) (*BackfillResult, error) {
+	if opts.Until.IsZero() {
+		opts.Until = time.Now()
+	}
+	if opts.Window <= 0 {
+		opts.Window = DefaultBackfillWindow
+	}
+	if !opts.Since.Before(opts.Until) {
+		return nil, fmt.Errorf("backfill start %s is not before its end %s", opts.Since.Format(time.RFC3339), opts.Until.Format(time.RFC3339))
+	}
+
+	streamer, err := s.lookupStreamer(ctx, streamerName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up %s: %w", streamerName, err)
+	}
+
+	result := &BackfillResult{}
+	start := opts.Since
+	if !opts.Restart {
+		checkpoint, err := s.db.GetBackfillCheckpoint(streamerName, opts.Since)
+		if err != nil {
+			return nil, err
+		}
+		if checkpoint != nil && checkpoint.CompletedUntil.After(start) {
+			start = checkpoint.CompletedUntil
+			result.ResumedFrom = start
+			logger.Info("Resuming backfill", "streamer", streamerName, "from", start)
+		}
+	}
+
+	window := opts.Window
+	for start.Before(opts.Until) {
+		end := start.Add(window)
+		if end.After(opts.Until) {
+			end = opts.Until
+		}
+
+		if err := s.limiter.Wait(ctx); err != nil {
+			return result, err
+		}
+		clips, truncated, err := s.fetchClips(ctx, streamer.BroadcasterID, start, end)
+		if err != nil {
+			metrics.RecordError("twitch_api_error")
+			return result, fmt.Errorf("failed to fetch clips from %s to %s: %w", start.Format(time.RFC3339), end.Format(time.RFC3339), err)
+		}
+
+		// Retry busy windows in smaller pieces rather than lose clips
+		if truncated && window > minBackfillWindow {
+			window /= 2
+			if window < minBackfillWindow {
+				window = minBackfillWindow
+			}
+			logger.Debug("Splitting backfill window", "streamer", streamerName, "start", start, "window", window.String())
+			continue
+		}
+		if truncated {
+			logger.Warn("Backfill window exceeds the page limit, some clips were skipped",
+				"streamer", streamerName, "start", start, "end", end)
+		}
+
+		for i := range clips {
+			dbClip, err := s.storeClip(streamerName, &clips[i], opts.Notify)
+			if err != nil {
+				return result, err
+			}
+			if dbClip != nil {
+				result.Saved++
+			}
+		}
+		result.Fetched += len(clips)
+		result.Windows++
+
+		if err := s.db.SaveBackfillCheckpoint(&database.BackfillCheckpoint{
+			StreamerName:   streamerName,
+			Since:          opts.Since,
+			CompletedUntil: end,
+			UpdatedAt:      time.Now(),
+		}); err != nil {
+			return result, err
+		}
+		if opts.Notify && len(clips) > 0 {
+			if err := s.deliverAll(ctx, streamerName); err != nil {
+				return result, err
+			}
+		}
+
+		logger.Info("Backfilled window", "streamer", streamerName, "start", start, "end", end, "clips", len(clips))
+
+		start = end
+		// Grow back towards the requested window once the burst has passed
+		if !truncated && window < opts.Window {
+			window *= 2
+			if window > opts.Window {
+				window = opts.Window
+			}
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"twitchclipsearch/internal/eventsub"
+	"twitchclipsearch/internal/logger"
+	"twitchclipsearch/internal/metrics"
+
+	"github.com/nicklaw5/helix/v2"
+)
+
+// eventSubTypes are the subscription types and versions created for every
+// streamer; each of them triggers an immediate clip check
+var eventSubTypes = map[string]string{
+	eventsub.TypeStreamOnline:  "1",
+	eventsub.TypeStreamOffline: "1",
+	eventsub.TypeChannelUpdate: "2",
+}
+
+// HandleEvent triggers a clip check for EventSub notifications about monitored
+// streamers. Polling continues regardless, so missed events only add latency.
+func (s *ClipService) HandleEvent(event eventsub.Event) {
+	switch event.Type {
+	case eventsub.TypeStreamOnline, eventsub.TypeStreamOffline, eventsub.TypeChannelUpdate:
+	default:
+		return
+	}
+
+	streamerName := strings.ToLower(event.BroadcasterLogin)
+	if _, ok := s.destinations(streamerName); !ok {
+		return
+	}
+
+	logger.Info("EventSub notification received", "type", event.Type, "streamer", streamerName)
+
+	// Follow the live status between Get Streams refreshes; the session itself
+	// is recorded by the next refresh
+	switch event.Type {
+	case eventsub.TypeStreamOnline:
+		s.scheduler.setLive(streamerName, true, time.Now())
+	case eventsub.TypeStreamOffline:
+		s.scheduler.setLive(streamerName, false, time.Now())
+	}
+	s.TriggerCheck(streamerName)
+}
+
+// subscribeEventSub creates the EventSub webhook subscriptions for the given
+// streamers. Existing subscriptions are left untouched.
+func (s *ClipService) subscribeEventSub(ctx context.Context, logins []string) {
+	for _, batch := range batches(logins, helixBatchSize) {
+		users, err := s.getUsers(ctx, &helix.UsersParams{Logins: batch})
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Error("Failed to look up streamers for EventSub", "error", err)
+			}
+			return
+		}
+
+		for _, user := range users {
+			for subscriptionType, version := range eventSubTypes {
+				if err := s.limiter.Wait(ctx); err != nil {
+					return
+				}
+				s.createSubscription(subscriptionType, version, user)
+			}
+		}
+	}
+}
+
+// createSubscription creates one EventSub subscription for a broadcaster
+func (s *ClipService) createSubscription(subscriptionType, version string, user helix.User) {
+	resp, err := s.twitch.CreateEventSubSubscription(&helix.EventSubSubscription{
+		Type:    subscriptionType,
+		Version: version,
+		Condition: helix.EventSubCondition{
+			BroadcasterUserID: user.ID,
+		},
+		Transport: helix.EventSubTransport{
+			Method:   "webhook",
+			Callback: s.cfg().Twitch.EventSub.CallbackURL,
+			Secret:   s.cfg().Twitch.EventSub.Secret,
+		},
+	})
+
+	switch {
+	case err != nil:
+		logger.Error("Failed to create EventSub subscription", "error", err, "type", subscriptionType, "streamer", user.Login)
+		metrics.RecordError("twitch_api_error")
+	case resp.StatusCode == http.StatusConflict:
+		// Already subscribed
+	case resp.StatusCode >= 300:
+		logger.Error("Failed to create EventSub subscription", "status", resp.StatusCode,
+			"message", resp.ErrorMessage, "type", subscriptionType, "streamer", user.Login)
+		metrics.RecordError("twitch_api_error")
+	default:
+		logger.Info("Created EventSub subscription", "type", subscriptionType, "streamer", user.Login)
+	}
+}
@@ -0,0 +1,341 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"twitchclipsearch/internal/config"
+	"twitchclipsearch/internal/database"
+	"twitchclipsearch/internal/logger"
+	"twitchclipsearch/internal/metrics"
+)
+
+// Where a monitored streamer is configured
+const (
+	SourceConfig = "config"
+	SourceAPI    = "api"
+)
+
+var (
+	// ErrStreamerExists is returned when adding a streamer that is already monitored
+	ErrStreamerExists = errors.New("streamer is already monitored")
+	// ErrStreamerNotMonitored is returned when changing a streamer that is not monitored
+	ErrStreamerNotMonitored = errors.New("streamer is not monitored")
+	// ErrConfigStreamer is returned when changing a streamer set in the
+	// configuration file, which only the file can change
+	ErrConfigStreamer = errors.New("streamer is set in the configuration file")
+	// ErrInvalidWebhookURL is returned for webhook URLs that are not Discord
+	// webhooks, as config.CheckWebhookURL checks them
+	ErrInvalidWebhookURL = errors.New("invalid webhook URL")
+)
+
+// MonitoredStreamer is a streamer whose new clips are posted to webhooks
+type MonitoredStreamer struct {
+	Login string
+	// WebhookURL is the first of WebhookURLs
+	WebhookURL string
+	// WebhookURLs are the webhooks of every destination of the streamer
+	WebhookURLs []string
+	Paused      bool
+	// Source is SourceConfig or SourceAPI
+	Source string
+}
+
+// StreamerUpdate changes a monitored streamer; nil fields are left alone
+type StreamerUpdate struct {
+	WebhookURL *string
+	Paused     *bool
+}
+
+// LoadStreamers reads the streamers added through the API. While a streamer
+// is also in the configuration file, the file takes precedence. Start calls
+// it; one-off commands call it to reach the webhooks of those streamers.
+func (s *ClipService) LoadStreamers() error {
+	streamers, err := s.db.ListMonitoredStreamers()
+	if err != nil {
+		metrics.RecordError("database_error")
+		return err
+	}
+
+	s.streamersMu.Lock()
+	defer s.streamersMu.Unlock()
+
+	configured := s.cfg().Discord.Streamers
+	s.managed = make(map[string]*database.Streamer, len(streamers))
+	for _, streamer := range streamers {
+		if _, ok := configured[streamer.Login]; ok {
+			logger.Warn("Streamer added through the API is also in the configuration file, using the file", "streamer", streamer.Login)
+		}
+		s.managed[streamer.Login] = streamer
+	}
+
+	return nil
+}
+
+// monitoredLogins returns every streamer to poll: those in the configuration
+// file and those added through the API that are not paused
+func (s *ClipService) monitoredLogins() []string {
+	s.streamersMu.RLock()
+	defer s.streamersMu.RUnlock()
+
+	configured := s.cfg().Discord.Streamers
+	logins := make([]string, 0, len(configured)+len(s.managed))
+	for login := range configured {
+		logins = append(logins, login)
+	}
+	for login, streamer := range s.managed {
+		if _, shadowed := configured[login]; !shadowed && !streamer.Paused {
+			logins = append(logins, login)
+		}
+	}
+	sort.Strings(logins)
+	return logins
+}
+
+// destinations returns where a streamer's clips are posted, if they are
+// monitored. Streamers added through the API have a single destination
+// without filters.
+func (s *ClipService) destinations(login string) (config.Destinations, bool) {
+	if destinations, ok := s.cfg().Discord.Streamers[login]; ok {
+		return destinations, true
+	}
+
+	s.streamersMu.RLock()
+	defer s.streamersMu.RUnlock()
+
+	streamer, ok := s.managed[login]
+	if !ok || streamer.Paused {
+		return nil, false
+	}
+	return config.Destinations{{WebhookURL: streamer.WebhookURL}}, true
+}
+
+// webhookURLs returns the webhooks of every monitored streamer that is not paused
+func (s *ClipService) webhookURLs() []string {
+	s.streamersMu.RLock()
+	defer s.streamersMu.RUnlock()
+
+	configured := s.cfg().Discord.Streamers
+	webhookURLs := make([]string, 0, len(configured)+len(s.managed))
+	for _, destinations := range configured {
+		for _, destination := range destinations {
+			webhookURLs = append(webhookURLs, destination.WebhookURL)
+		}
+	}
+	for login, streamer := range s.managed {
+		if _, shadowed := configured[login]; !shadowed && !streamer.Paused {
+			webhookURLs = append(webhookURLs, streamer.WebhookURL)
+		}
+	}
+	return webhookURLs
+}
+
+// Streamers returns every monitored streamer, including paused ones, ordered by login
+func (s *ClipService) Streamers() []MonitoredStreamer {
+	s.streamersMu.RLock()
+	defer s.streamersMu.RUnlock()
+
+	configured := s.cfg().Discord.Streamers
+	streamers := make([]MonitoredStreamer, 0, len(configured)+len(s.managed))
+	for login, destinations := range configured {
+		streamer := MonitoredStreamer{Login: login, Source: SourceConfig}
+		for _, destination := range destinations {
+			streamer.WebhookURLs = append(streamer.WebhookURLs, destination.WebhookURL)
+		}
+		if len(streamer.WebhookURLs) > 0 {
+			streamer.WebhookURL = streamer.WebhookURLs[0]
+		}
+		streamers = append(streamers, streamer)
+	}
+	for login, streamer := range s.managed {
+		if _, shadowed := configured[login]; !shadowed {
+			streamers = append(streamers, newMonitoredStreamer(streamer))
+		}
+	}
+
+	sort.Slice(streamers, func(i, j int) bool { return streamers[i].Login < streamers[j].Login })
+	return streamers
+}
+
+// AddStreamer starts monitoring a streamer and posting their clips to
+// webhookURL. The login is resolved on Twitch first, so unknown logins fail
+// with ErrStreamerNotFound.
+func (s *ClipService) AddStreamer(ctx context.Context, login, webhookURL string) (*MonitoredStreamer, error) {
+	login = strings.ToLower(strings.TrimSpace(login))
+	if err := validateWebhookURL(webhookURL); err != nil {
+		return nil, err
+	}
+	if s.isManagedOrConfigured(login) {
+		return nil, ErrStreamerExists
+	}
+
+	streamer, err := s.lookupStreamer(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+
+	s.streamersMu.Lock()
+	// Another request may have added the streamer during the lookup
+	if _, ok := s.managed[login]; ok {
+		s.streamersMu.Unlock()
+		return nil, ErrStreamerExists
+	}
+
+	added := *streamer
+	added.Monitored, added.Paused, added.WebhookURL = true, false, webhookURL
+	if err := s.db.SetStreamerMonitoring(&added); err != nil {
+		s.streamersMu.Unlock()
+		metrics.RecordError("database_error")
+		return nil, err
+	}
+	if s.managed == nil {
+		s.managed = make(map[string]*database.Streamer)
+	}
+	s.managed[login] = &added
+	s.streamersMu.Unlock()
+
+	s.scheduler.add(login, time.Now())
+	s.subscribeInBackground(login)
+	logger.Info("Started monitoring streamer", "streamer", login)
+
+	result := newMonitoredStreamer(&added)
+	return &result, nil
+}
+
+// UpdateStreamer changes the webhook of a streamer added through the API or
+// pauses and resumes monitoring them
+func (s *ClipService) UpdateStreamer(login string, update StreamerUpdate) (*MonitoredStreamer, error) {
+	login = strings.ToLower(login)
+	if _, ok := s.cfg().Discord.Streamers[login]; ok {
+		return nil, ErrConfigStreamer
+	}
+	if update.WebhookURL != nil {
+		if err := validateWebhookURL(*update.WebhookURL); err != nil {
+			return nil, err
+		}
+	}
+
+	// Deferred first so that it runs once streamersMu is released
+	defer s.refreshDiscordClients()
+	s.streamersMu.Lock()
+	defer s.streamersMu.Unlock()
+
+	current, ok := s.managed[login]
+	if !ok {
+		return nil, ErrStreamerNotMonitored
+	}
+
+	updated := *current
+	if update.WebhookURL != nil {
+		updated.WebhookURL = *update.WebhookURL
+	}
+	if update.Paused != nil {
+		updated.Paused = *update.Paused
+	}
+	if err := s.db.SetStreamerMonitoring(&updated); err != nil {
+		metrics.RecordError("database_error")
+		return nil, err
+	}
+	s.managed[login] = &updated
+
+	switch {
+	case updated.Paused && !current.Paused:
+		s.scheduler.remove(login)
+		logger.Info("Paused monitoring streamer", "streamer", login)
+	case !updated.Paused && current.Paused:
+		s.scheduler.add(login, time.Now())
+		logger.Info("Resumed monitoring streamer", "streamer", login)
+	}
+
+	result := newMonitoredStreamer(&updated)
+	return &result, nil
+}
+
+// RemoveStreamer stops monitoring a streamer added through the API. Their
+// clips stay in the archive.
+func (s *ClipService) RemoveStreamer(login string) error {
+	login = strings.ToLower(login)
+	if _, ok := s.cfg().Discord.Streamers[login]; ok {
+		return ErrConfigStreamer
+	}
+
+	// Deferred first so that it runs once streamersMu is released
+	defer s.refreshDiscordClients()
+	s.streamersMu.Lock()
+	defer s.streamersMu.Unlock()
+
+	current, ok := s.managed[login]
+	if !ok {
+		return ErrStreamerNotMonitored
+	}
+
+	removed := *current
+	removed.Monitored, removed.Paused, removed.WebhookURL = false, false, ""
+	if err := s.db.SetStreamerMonitoring(&removed); err != nil {
+		metrics.RecordError("database_error")
+		return err
+	}
+	delete(s.managed, login)
+	s.scheduler.remove(login)
+
+	logger.Info("Stopped monitoring streamer", "streamer", login)
+	return nil
+}
+
+// isManagedOrConfigured reports whether a streamer is monitored or paused
+func (s *ClipService) isManagedOrConfigured(login string) bool {
+	if _, ok := s.cfg().Discord.Streamers[login]; ok {
+		return true
+	}
+
+	s.streamersMu.RLock()
+	defer s.streamersMu.RUnlock()
+	_, ok := s.managed[login]
+	return ok
+}
+
+// subscribeInBackground creates the EventSub subscriptions of a streamer
+// added while the service is running
+func (s *ClipService) subscribeInBackground(login string) {
+	if !s.cfg().Twitch.EventSub.Enabled || s.cfg().Twitch.EventSub.CallbackURL == "" {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ctx == nil || s.stopped {
+		s.mu.Unlock()
+		return
+	}
+	ctx := s.ctx
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	go func() {
+		defer s.wg.Done()
+		s.subscribeEventSub(ctx, []string{login})
+	}()
+}
+
+// validateWebhookURL applies the configuration's webhook check, so that the
+// API cannot point the outbox at hosts the configuration would refuse
+func validateWebhookURL(raw string) error {
+	if err := config.CheckWebhookURL(raw); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidWebhookURL, err)
+	}
+	return nil
+}
+
+// newMonitoredStreamer describes a streamer added through the API
+func newMonitoredStreamer(streamer *database.Streamer) MonitoredStreamer {
+	return MonitoredStreamer{
+		Login:       streamer.Login,
+		WebhookURL:  streamer.WebhookURL,
+		WebhookURLs: []string{streamer.WebhookURL},
+		Paused:      streamer.Paused,
+		Source:      SourceAPI,
+	}
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"twitchclipsearch/internal/config"
+	"twitchclipsearch/internal/database"
+	"twitchclipsearch/internal/discord"
+	"twitchclipsearch/internal/metrics"
+)
+
+// PollResult summarizes a one-off check of a streamer's clips
+type PollResult struct {
+	Fetched int
+	Saved   int
+	// Truncated is set when the page limit cut the fetched clips short
+	Truncated bool
+}
+
+// PollOnce checks a streamer's clips once, outside the scheduler, saving the
+// clips created since the newest stored one, or in the last hour if none is
+// stored, and, if notify is set, posting them to the streamer's webhook
+// through the outbox. Unlike scheduled checks
+// it waits for every clip to be processed and returns the first error.
+func (s *ClipService) PollOnce(ctx context.Context, streamerName string, notify bool) (*PollResult, error) {
+	streamer, err := s.lookupStreamer(ctx, streamerName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up %s: %w", streamerName, err)
+	}
+
+	latestTime, err := s.checkStart(streamerName)
+	if err != nil {
+		metrics.RecordError("database_error")
+		return nil, err
+	}
+
+	if err := s.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	clips, truncated, err := s.fetchAllClips(ctx, streamer.BroadcasterID, latestTime, time.Now())
+	if err != nil {
+		metrics.RecordError("twitch_api_error")
+		return nil, fmt.Errorf("failed to fetch clips: %w", err)
+	}
+
+	result := &PollResult{Fetched: len(clips), Truncated: truncated}
+	for i := range clips {
+		dbClip, err := s.storeClip(streamerName, &clips[i], notify)
+		if err != nil {
+			return result, err
+		}
+		if dbClip != nil {
+			result.Saved++
+		}
+	}
+
+	// No delivery loop runs outside the server, so deliver right away;
+	// notifications that fail stay queued for the next run
+	if notify && result.Saved > 0 {
+		if err := s.deliverAll(ctx, streamerName); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// ErrDestinationNotFound is returned when naming a destination a streamer
+// does not have
+var ErrDestinationNotFound = errors.New("streamer has no such destination")
+
+// TestWebhook posts the newest stored clip of a streamer, or a sample clip if
+// none is stored, to the destination named, or to all of them if destination
+// is empty. Filters are not applied. It returns the delivery errors of every
+// destination.
+func (s *ClipService) TestWebhook(streamerName, destination string) error {
+	if _, ok := s.destinations(streamerName); !ok {
+		return ErrStreamerNotMonitored
+	}
+	destinations, err := s.namedDestinations(streamerName, destination)
+	if err != nil {
+		return err
+	}
+	clip, err := s.previewClip(streamerName)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, destination := range destinations {
+		msg, err := s.previewMessage(clip, destination.Destination)
+		if err == nil {
+			err = s.discord.Client(destination.WebhookURL).SendMessage(msg)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", destination.label, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// PreviewMessage renders the message the newest stored clip of a streamer,
+// or a sample clip if none is stored, would be posted to one of their
+// destinations with, without sending it. The destination is named as by
+// config.Destination.Label or by its number; empty selects the first.
+func (s *ClipService) PreviewMessage(streamerName, destination string) (*discord.Message, error) {
+	destinations, err := s.namedDestinations(streamerName, destination)
+	if err != nil {
+		return nil, err
+	}
+	clip, err := s.previewClip(streamerName)
+	if err != nil {
+		return nil, err
+	}
+	return s.previewMessage(clip, destinations[0].Destination)
+}
+
+// labeledDestination is a destination with its label among the streamer's
+type labeledDestination struct {
+	config.Destination
+	label string
+}
+
+// namedDestinations returns the destination of a streamer with the given
+// name or number, or every destination if name is empty. A streamer that is
+// not monitored has a single destination without a webhook.
+func (s *ClipService) namedDestinations(streamerName, name string) ([]labeledDestination, error) {
+	destinations, ok := s.destinations(streamerName)
+	if !ok {
+		destinations = config.Destinations{{}}
+	}
+
+	labeled := make([]labeledDestination, 0, len(destinations))
+	for i, destination := range destinations {
+		labeled = append(labeled, labeledDestination{Destination: destination, label: destination.Label(i)})
+	}
+	if name == "" {
+		return labeled, nil
+	}
+
+	for _, destination := range labeled {
+		if destination.label == name {
+			return []labeledDestination{destination}, nil
+		}
+	}
+	if n, err := strconv.Atoi(strings.TrimPrefix(name, "#")); err == nil && n >= 1 && n <= len(labeled) {
+		return labeled[n-1 : n], nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrDestinationNotFound, name)
+}
+
+// previewClip returns the newest stored clip of a streamer, or a sample clip
+// if none is stored
+func (s *ClipService) previewClip(streamerName string) (*database.Clip, error) {
+	page, err := s.db.GetClips(database.ClipQuery{StreamerName: streamerName, Limit: 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(page.Clips) > 0 {
+		return page.Clips[0], nil
+	}
+
+	return &database.Clip{
+		ID:           "test",
+		StreamerName: streamerName,
+		Title:        "Webhook test",
+		URL:          "https://www.twitch.tv/" + streamerName,
+		CreatedAt:    time.Now(),
+	}, nil
+}
+
+// previewMessage renders the message of a clip for a destination as the
+// webhook would show it
+func (s *ClipService) previewMessage(clip *database.Clip, destination config.Destination) (*discord.Message, error) {
+	msg, err := s.message(clip, destination)
+	if err != nil {
+		return nil, err
+	}
+	msg.Username = discordConfig(s.cfg()).Username
+	return msg, nil
+}
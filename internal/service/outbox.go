@@ -0,0 +1,224 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"twitchclipsearch/internal/database"
+	"twitchclipsearch/internal/discord"
+	"twitchclipsearch/internal/logger"
+	"twitchclipsearch/internal/metrics"
+)
+
+const (
+	// outboxInterval is how often the outbox is checked for due notifications
+	outboxInterval = 5 * time.Second
+	// outboxBatch is the most notifications delivered per pass
+	outboxBatch = 50
+	// defaultMaxDeliveryAttempts is how often a notification is tried before
+	// it is kept as a dead letter
+	defaultMaxDeliveryAttempts = 8
+	// outboxBaseBackoff is the wait after the first failed attempt, doubled
+	// after every further one up to outboxMaxBackoff
+	outboxBaseBackoff = 30 * time.Second
+	outboxMaxBackoff  = time.Hour
+	// outboxLease is how long claimed notifications are kept from other
+	// processes delivering the outbox. Notifications a process claimed but
+	// did not get to send are due again once it runs out.
+	outboxLease = 5 * time.Minute
+)
+
+// runOutbox delivers due notifications until the service stops, checking
+// every outboxInterval and whenever new notifications are queued
+func (s *ClipService) runOutbox(ctx context.Context) {
+	defer s.wg.Done()
+
+	tick := time.NewTicker(outboxInterval)
+	defer tick.Stop()
+
+	for {
+		if _, err := s.DeliverDue(ctx); err != nil && ctx.Err() == nil {
+			logger.Error("Failed to deliver notifications", "error", err)
+			metrics.RecordError("database_error")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.shutdown:
+			return
+		case <-tick.C:
+		case <-s.outboxWake:
+		}
+	}
+}
+
+// wakeOutbox makes the delivery loop check the outbox right away
+func (s *ClipService) wakeOutbox() {
+	select {
+	case s.outboxWake <- struct{}{}:
+	default:
+	}
+}
+
+// DeliverDue makes one attempt at every due notification and returns how
+// many were delivered. Due notifications are claimed first, so that
+// processes sharing the database never send the same one twice.
+// Notifications to the same webhook are sent in order,
+// different webhooks in parallel. Notifications held back for their clip's
+// views are only sent once it has enough. Failed notifications are retried
+// later with exponential backoff, or kept as dead letters once they ran out
+// of attempts or Discord rejected them.
+func (s *ClipService) DeliverDue(ctx context.Context) (int, error) {
+	return s.deliverDue(ctx, "")
+}
+
+// deliverDue is DeliverDue restricted to one streamer's notifications if
+// streamerName is set
+func (s *ClipService) deliverDue(ctx context.Context, streamerName string) (int, error) {
+	now := time.Now()
+	notifications, err := s.db.ClaimNotifications(streamerName, now, now.Add(outboxLease), outboxBatch)
+	if err != nil {
+		return 0, err
+	}
+	notifications = s.releaseHeld(ctx, notifications)
+
+	byWebhook := make(map[string][]*database.Notification)
+	for _, notification := range notifications {
+		byWebhook[notification.WebhookURL] = append(byWebhook[notification.WebhookURL], notification)
+	}
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		delivered int
+	)
+	for webhookURL, queue := range byWebhook {
+		wg.Add(1)
+		go func(client *discord.Client, queue []*database.Notification) {
+			defer wg.Done()
+			for _, notification := range queue {
+				if ctx.Err() != nil {
+					return
+				}
+				if s.deliver(ctx, client, notification) {
+					mu.Lock()
+					delivered++
+					mu.Unlock()
+				}
+			}
+		}(s.discord.Client(webhookURL), queue)
+	}
+	wg.Wait()
+
+	return delivered, nil
+}
+
+// deliverAll delivers a streamer's due notifications until none is left that
+// can be delivered now, for one-off commands that run without the delivery
+// loop. Other streamers' notifications are left to the server.
+func (s *ClipService) deliverAll(ctx context.Context, streamerName string) error {
+	for {
+		delivered, err := s.deliverDue(ctx, streamerName)
+		if err != nil || delivered == 0 {
+			return err
+		}
+	}
+}
+
+// deliver makes one attempt at a notification and records the outcome,
+// reporting whether it was delivered and removed from the outbox
+func (s *ClipService) deliver(ctx context.Context, client *discord.Client, notification *database.Notification) bool {
+	msg, err := s.message(notification.Clip, s.destination(notification.Clip.StreamerName, notification.WebhookURL))
+	if err == nil {
+		err = client.DeliverMessage(ctx, msg)
+	}
+	if err == nil {
+		metrics.RecordNotification("delivered")
+		if err := s.db.DeleteNotification(notification.ID); err != nil {
+			// The claim keeps it from being sent again until the lease runs out
+			logger.Error("Failed to remove delivered notification", "error", err, "notification_id", notification.ID)
+			metrics.RecordError("database_error")
+			return false
+		}
+		return true
+	}
+	if ctx.Err() != nil {
+		// Interrupted by shutdown, not a failed attempt
+		return false
+	}
+
+	now := time.Now()
+	notification.Attempts++
+	notification.LastError = err.Error()
+	notification.UpdatedAt = now
+	// A message that does not render will not render next time either
+	if notification.Attempts >= s.maxDeliveryAttempts() || msg == nil || !discord.IsRetryable(err) {
+		notification.Status = database.NotificationDead
+		logger.Error("Giving up on clip notification", "error", err, "notification_id", notification.ID,
+			"clip_id", notification.ClipID, "attempts", notification.Attempts)
+		metrics.RecordNotification("dead")
+	} else {
+		notification.NextAttemptAt = now.Add(deliveryBackoff(notification.Attempts, err))
+		logger.Warn("Failed to send clip notification, will retry", "error", err, "notification_id", notification.ID,
+			"clip_id", notification.ClipID, "attempts", notification.Attempts, "next_attempt_at", notification.NextAttemptAt)
+		metrics.RecordNotification("retrying")
+	}
+	metrics.RecordError("discord_webhook_error")
+
+	if err := s.db.UpdateNotification(notification); err != nil {
+		logger.Error("Failed to update notification", "error", err, "notification_id", notification.ID)
+		metrics.RecordError("database_error")
+	}
+	return false
+}
+
+// maxDeliveryAttempts returns the configured attempts per notification
+func (s *ClipService) maxDeliveryAttempts() int {
+	if attempts := s.cfg().Discord.MaxDeliveryAttempts; attempts > 0 {
+		return attempts
+	}
+	return defaultMaxDeliveryAttempts
+}
+
+// deliveryBackoff returns the wait before the next attempt at a notification
+// that failed attempts times: exponential with up to 50% jitter, so that
+// notifications failing together do not retry together, and never shorter
+// than a rate limit Discord asked to wait out
+func deliveryBackoff(attempts int, err error) time.Duration {
+	backoff := outboxMaxBackoff
+	if shift := attempts - 1; shift < 20 && outboxBaseBackoff<<uint(shift) < outboxMaxBackoff {
+		backoff = outboxBaseBackoff << uint(shift)
+	}
+
+	backoff += time.Duration(rand.Int63n(int64(backoff/2) + 1))
+
+	var webhookErr *discord.WebhookError
+	if errors.As(err, &webhookErr) && webhookErr.RetryAfter > backoff {
+		backoff = webhookErr.RetryAfter
+	}
+	return backoff
+}
+
+// Notifications lists the notifications with the given status, oldest first
+func (s *ClipService) Notifications(status database.NotificationStatus, limit int) ([]*database.Notification, error) {
+	return s.db.ListNotifications(status, limit)
+}
+
+// RetryNotification queues a dead letter for delivery again with a fresh set
+// of attempts
+func (s *ClipService) RetryNotification(id int64) error {
+	if err := s.db.RetryNotification(id, time.Now()); err != nil {
+		return err
+	}
+	s.wakeOutbox()
+	return nil
+}
+
+// DiscardNotification removes a dead letter for good
+func (s *ClipService) DiscardNotification(id int64) error {
+	return s.db.DiscardNotification(id)
+}
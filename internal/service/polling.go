@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"twitchclipsearch/internal/database"
+	"twitchclipsearch/internal/logger"
+	"twitchclipsearch/internal/metrics"
+
+	"github.com/nicklaw5/helix/v2"
+)
+
+const (
+	// schedulerTick is how often the scheduler looks for due checks
+	schedulerTick = time.Second
+	// helixBatchSize is the most logins Get Users and Get Streams accept per call
+	helixBatchSize = 100
+)
+
+// runScheduler starts the checks the scheduler reports as due and refreshes
+// the streamers' details and live status once per live interval
+func (s *ClipService) runScheduler(ctx context.Context) {
+	defer s.wg.Done()
+
+	s.refreshStatus(ctx)
+
+	tick := time.NewTicker(schedulerTick)
+	defer tick.Stop()
+	// A timer rather than a ticker, so that a reloaded interval applies
+	liveInterval, _ := s.scheduler.intervals()
+	status := time.NewTimer(liveInterval)
+	defer status.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.shutdown:
+			return
+		case <-status.C:
+			s.refreshStatus(ctx)
+			liveInterval, _ := s.scheduler.intervals()
+			status.Reset(liveInterval)
+		case now := <-tick.C:
+			for _, streamerName := range s.scheduler.due(now) {
+				s.startCheck(ctx, streamerName)
+			}
+		}
+	}
+}
+
+// refreshStatus resolves stale streamer details and the live status of every
+// scheduled streamer, 100 logins per request, and records the stream sessions
+// that started or ended since the last refresh
+func (s *ClipService) refreshStatus(ctx context.Context) {
+	logins := s.scheduler.logins()
+	s.refreshStreamers(ctx, logins)
+
+	for _, batch := range batches(logins, helixBatchSize) {
+		live, err := s.liveStreams(ctx, batch)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Error("Failed to get live status", "error", err, "streamers", len(batch))
+			}
+			continue
+		}
+
+		now := time.Now()
+		for _, login := range batch {
+			stream, isLive := live[login]
+			s.recordSession(login, stream, isLive, now)
+			s.scheduler.setLive(login, isLive, now)
+		}
+	}
+}
+
+// recordSession saves the current stream of a live streamer, keeping its
+// title and game up to date, or ends the open session of an offline one
+func (s *ClipService) recordSession(login string, stream helix.Stream, live bool, now time.Time) {
+	var err error
+	if live {
+		err = s.db.SaveStreamSession(&database.StreamSession{
+			ID:            stream.ID,
+			StreamerName:  login,
+			BroadcasterID: stream.UserID,
+			Title:         stream.Title,
+			GameID:        stream.GameID,
+			GameName:      stream.GameName,
+			StartedAt:     stream.StartedAt,
+		})
+	} else {
+		err = s.db.EndStreamSessions(login, now)
+	}
+	if err != nil {
+		logger.Error("Failed to record stream session", "error", err, "streamer", login, "live", live)
+		metrics.RecordError("database_error")
+	}
+}
+
+// liveStreams returns the streams of the live channels among logins, keyed by
+// lowercase login
+func (s *ClipService) liveStreams(ctx context.Context, logins []string) (map[string]helix.Stream, error) {
+	if err := s.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.twitch.GetStreams(&helix.StreamsParams{
+		UserLogins: logins,
+		First:      helixBatchSize,
+	})
+	if err == nil && resp.StatusCode >= 300 {
+		err = fmt.Errorf("get streams failed with status %d: %s", resp.StatusCode, resp.ErrorMessage)
+	}
+	if err != nil {
+		metrics.RecordError("twitch_api_error")
+		return nil, err
+	}
+
+	live := make(map[string]helix.Stream, len(resp.Data.Streams))
+	for _, stream := range resp.Data.Streams {
+		live[strings.ToLower(stream.UserLogin)] = stream
+	}
+	return live, nil
+}
+
+// batches splits logins into slices of at most size
+func batches(logins []string, size int) [][]string {
+	var out [][]string
+	for start := 0; start < len(logins); start += size {
+		end := start + size
+		if end > len(logins) {
+			end = len(logins)
+		}
+		out = append(out, logins[start:end])
+	}
+	return out
+}
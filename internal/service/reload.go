@@ -0,0 +1,114 @@
+package service
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"twitchclipsearch/internal/config"
+	"twitchclipsearch/internal/logger"
+	"twitchclipsearch/internal/metrics"
+)
+
+// Reload applies a new configuration to the running service. Streamers,
+// webhooks, Discord and polling settings take effect straight away; the
+// settings listed by keepRestartOnly keep their current values until the next
+// restart. An invalid configuration is rejected and the current one stays in
+// place.
+func (s *ClipService) Reload(next *config.Config) error {
+	if err := next.Validate(); err != nil {
+		metrics.RecordConfigReload(false)
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	current := s.cfg()
+	applied := *next
+	for _, setting := range keepRestartOnly(current, &applied) {
+		logger.Warn("Configuration change needs a restart to take effect", "setting", setting)
+	}
+
+	before := s.monitoredLogins()
+	s.config.Store(&applied)
+	after := s.monitoredLogins()
+	s.templates.Store(newMessageTemplates(&applied))
+	s.refreshDiscordClients()
+
+	// Start and stop polling the streamers that came and went
+	now := time.Now()
+	added, removed := diffLogins(before, after)
+	for _, login := range removed {
+		s.scheduler.remove(login)
+	}
+	for _, login := range added {
+		s.scheduler.add(login, now)
+		s.subscribeInBackground(login)
+	}
+
+	liveInterval, offlineInterval := checkIntervals(&applied)
+	s.scheduler.setIntervals(liveInterval, offlineInterval, now)
+
+	metrics.RecordConfigReload(true)
+	logger.Info("Configuration reloaded", "added", added, "removed", removed,
+		"live_interval", liveInterval, "offline_interval", offlineInterval)
+	return nil
+}
+
+// keepRestartOnly copies the settings that cannot change at runtime from
+// current into next and returns the names of those that differed
+func keepRestartOnly(current, next *config.Config) []string {
+	var changed []string
+	keep := func(name string, cur, nxt interface{}, restore func()) {
+		if !reflect.DeepEqual(cur, nxt) {
+			changed = append(changed, name)
+			restore()
+		}
+	}
+
+	keep("database", current.Database, next.Database, func() { next.Database = current.Database })
+	keep("server", current.Server, next.Server, func() { next.Server = current.Server })
+	keep("metrics", current.Metrics, next.Metrics, func() { next.Metrics = current.Metrics })
+	keep("logging", current.Logging, next.Logging, func() { next.Logging = current.Logging })
+	keep("reload", current.Reload, next.Reload, func() { next.Reload = current.Reload })
+	keep("twitch.client_id", current.Twitch.ClientID, next.Twitch.ClientID, func() { next.Twitch.ClientID = current.Twitch.ClientID })
+	keep("twitch.client_secret", current.Twitch.ClientSecret, next.Twitch.ClientSecret, func() { next.Twitch.ClientSecret = current.Twitch.ClientSecret })
+	keep("twitch.eventsub", current.Twitch.EventSub, next.Twitch.EventSub, func() { next.Twitch.EventSub = current.Twitch.EventSub })
+
+	return changed
+}
+
+// checkIntervals returns the live and offline check intervals of a configuration
+func checkIntervals(cfg *config.Config) (time.Duration, time.Duration) {
+	interval := time.Duration(cfg.Twitch.CheckIntervalSecs) * time.Second
+	if interval <= 0 {
+		interval = defaultCheckInterval
+	}
+	offlineInterval := time.Duration(cfg.Twitch.OfflineIntervalSecs) * time.Second
+	if offlineInterval <= 0 {
+		offlineInterval = interval * offlineIntervalFactor
+	}
+	return interval, offlineInterval
+}
+
+// diffLogins returns the logins only in after and those only in before
+func diffLogins(before, after []string) (added, removed []string) {
+	inBefore := make(map[string]bool, len(before))
+	for _, login := range before {
+		inBefore[login] = true
+	}
+	inAfter := make(map[string]bool, len(after))
+	for _, login := range after {
+		inAfter[login] = true
+		if !inBefore[login] {
+			added = append(added, login)
+		}
+	}
+	for _, login := range before {
+		if !inAfter[login] {
+			removed = append(removed, login)
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"twitchclipsearch/internal/config"
+	"twitchclipsearch/internal/database"
+	"twitchclipsearch/internal/logger"
+	"twitchclipsearch/internal/metrics"
+
+	"github.com/nicklaw5/helix/v2"
+)
+
+const (
+	// viewHoldWindow is how long after its creation a clip below a
+	// destination's minimum views is waited on before it is dropped
+	viewHoldWindow = 24 * time.Hour
+	// viewRecheckInterval is how often the view counts of held clips are
+	// refreshed
+	viewRecheckInterval = 15 * time.Minute
+	// clipIDsPerRequest is the most clips Get Clips looks up by ID at once
+	clipIDsPerRequest = 100
+)
+
+// notifications returns the notifications of a new clip, one for every
+// destination of its streamer whose filters it passes. Clips below a
+// destination's minimum views are held back and checked again later.
+func (s *ClipService) notifications(clip *database.Clip) []*database.Notification {
+	destinations, ok := s.destinations(clip.StreamerName)
+	if !ok {
+		return nil
+	}
+
+	var notifications []*database.Notification
+	for i, destination := range destinations {
+		if !accepts(destination, clip) {
+			logger.Debug("Clip filtered out of destination", "clip_id", clip.ID, "streamer", clip.StreamerName,
+				"destination", destination.Label(i))
+			continue
+		}
+
+		notification := &database.Notification{
+			WebhookURL:    destination.WebhookURL,
+			NextAttemptAt: clip.PostedAt,
+			CreatedAt:     clip.PostedAt,
+		}
+		if clip.ViewCount < destination.MinViews {
+			if clip.PostedAt.Sub(clip.CreatedAt) >= viewHoldWindow {
+				continue
+			}
+			notification.MinViews = destination.MinViews
+			notification.NextAttemptAt = clip.PostedAt.Add(viewRecheckInterval)
+		}
+		notifications = append(notifications, notification)
+	}
+	return notifications
+}
+
+// accepts reports whether a clip passes the game, keyword and language
+// filters of a destination; filters that are not set let every clip through
+func accepts(destination config.Destination, clip *database.Clip) bool {
+	if len(destination.Games) > 0 && !contains(destination.Games, clip.GameID, false) {
+		return false
+	}
+	if len(destination.Languages) > 0 && !contains(destination.Languages, clip.Language, true) {
+		return false
+	}
+	if len(destination.Keywords) == 0 {
+		return true
+	}
+	title := strings.ToLower(clip.Title)
+	for _, keyword := range destination.Keywords {
+		if strings.Contains(title, strings.ToLower(keyword)) {
+			return true
+		}
+	}
+	return false
+}
+
+// contains reports whether value is one of values
+func contains(values []string, value string, ignoreCase bool) bool {
+	for _, v := range values {
+		if v == value || (ignoreCase && strings.EqualFold(v, value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// destination returns the destination of a streamer a notification is
+// queued for. A destination that was removed from the configuration since
+// leaves the notification with the streamer's template.
+func (s *ClipService) destination(login, webhookURL string) config.Destination {
+	destinations, _ := s.destinations(login)
+	for _, destination := range destinations {
+		if destination.WebhookURL == webhookURL {
+			return destination
+		}
+	}
+	return config.Destination{WebhookURL: webhookURL}
+}
+
+// releaseHeld returns the notifications that can be delivered now. The view
+// counts of clips held back for their minimum views are refreshed first;
+// those still short are checked again later, or dropped once the hold
+// window has passed.
+func (s *ClipService) releaseHeld(ctx context.Context, notifications []*database.Notification) []*database.Notification {
+	var held []*database.Clip
+	for _, notification := range notifications {
+		if notification.Clip.ViewCount < notification.MinViews {
+			held = append(held, notification.Clip)
+		}
+	}
+	if len(held) == 0 {
+		return notifications
+	}
+	if err := s.refreshViewCounts(ctx, held); err != nil {
+		// The held clips are checked again with the next recheck
+		logger.Warn("Failed to refresh clip view counts", "error", err, "clips", len(held))
+	}
+
+	now := time.Now()
+	ready := make([]*database.Notification, 0, len(notifications))
+	for _, notification := range notifications {
+		switch {
+		case notification.Clip.ViewCount >= notification.MinViews:
+			ready = append(ready, notification)
+		case now.Sub(notification.Clip.CreatedAt) >= viewHoldWindow:
+			if err := s.db.DeleteNotification(notification.ID); err != nil {
+				logger.Error("Failed to remove held notification", "error", err, "notification_id", notification.ID)
+				metrics.RecordError("database_error")
+				continue
+			}
+			logger.Debug("Clip did not reach the minimum views of destination", "clip_id", notification.ClipID,
+				"views", notification.Clip.ViewCount, "min_views", notification.MinViews)
+			metrics.RecordNotification("filtered")
+		default:
+			notification.NextAttemptAt, notification.UpdatedAt = now.Add(viewRecheckInterval), now
+			if err := s.db.UpdateNotification(notification); err != nil {
+				logger.Error("Failed to update notification", "error", err, "notification_id", notification.ID)
+				metrics.RecordError("database_error")
+			}
+		}
+	}
+	return ready
+}
+
+// refreshViewCounts looks up the current view counts of clips on Twitch and
+// stores them
+func (s *ClipService) refreshViewCounts(ctx context.Context, clips []*database.Clip) error {
+	byID := make(map[string][]*database.Clip, len(clips))
+	ids := make([]string, 0, len(clips))
+	for _, clip := range clips {
+		if _, ok := byID[clip.ID]; !ok {
+			ids = append(ids, clip.ID)
+		}
+		byID[clip.ID] = append(byID[clip.ID], clip)
+	}
+
+	viewCounts := make(map[string]int, len(ids))
+	for start := 0; start < len(ids); start += clipIDsPerRequest {
+		end := start + clipIDsPerRequest
+		if end > len(ids) {
+			end = len(ids)
+		}
+		if err := s.limiter.Wait(ctx); err != nil {
+			return err
+		}
+
+		resp, err := s.twitch.GetClips(&helix.ClipsParams{IDs: ids[start:end]})
+		if err != nil {
+			metrics.RecordError("twitch_api_error")
+			return err
+		}
+		if resp.StatusCode >= 300 {
+			metrics.RecordError("twitch_api_error")
+			return fmt.Errorf("get clips failed with status %d: %s", resp.StatusCode, resp.ErrorMessage)
+		}
+		for _, clip := range resp.Data.Clips {
+			viewCounts[clip.ID] = clip.ViewCount
+		}
+	}
+
+	for id, viewCount := range viewCounts {
+		for _, clip := range byID[id] {
+			clip.ViewCount = viewCount
+		}
+	}
+	if err := s.db.UpdateClipViewCounts(viewCounts); err != nil {
+		metrics.RecordError("database_error")
+		return err
+	}
+	return nil
+}
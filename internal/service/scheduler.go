@@ -0,0 +1,172 @@
+package service
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// jitterFraction bounds how far a check may move from its nominal time, as a
+// fraction of the interval, so that streamers do not fall into lockstep
+const jitterFraction = 0.1
+
+// scheduleEntry is the polling state of one streamer
+type scheduleEntry struct {
+	login string
+	live  bool
+	next  time.Time
+}
+
+// scheduler decides when each streamer is checked for new clips. Streamers
+// are spread across the interval when added, live channels are checked every
+// liveInterval and offline ones every offlineInterval, and a channel going
+// live is checked straight away.
+type scheduler struct {
+	mu              sync.Mutex
+	liveInterval    time.Duration
+	offlineInterval time.Duration
+	entries         map[string]*scheduleEntry
+	rand            *rand.Rand
+}
+
+// newScheduler creates an empty scheduler
+func newScheduler(liveInterval, offlineInterval time.Duration) *scheduler {
+	return &scheduler{
+		liveInterval:    liveInterval,
+		offlineInterval: offlineInterval,
+		entries:         make(map[string]*scheduleEntry),
+		rand:            rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// add schedules a streamer's first check at a random point of the interval.
+// Streamers already scheduled are left alone.
+func (s *scheduler) add(login string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.entries[login]; ok {
+		return
+	}
+	s.entries[login] = &scheduleEntry{
+		login: login,
+		next:  now.Add(time.Duration(s.rand.Int63n(int64(s.liveInterval) + 1))),
+	}
+}
+
+// intervals returns the live and offline check intervals
+func (s *scheduler) intervals() (time.Duration, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.liveInterval, s.offlineInterval
+}
+
+// setIntervals changes the check intervals. Checks scheduled further out than
+// their new interval are brought forward.
+func (s *scheduler) setIntervals(liveInterval, offlineInterval time.Duration, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.liveInterval, s.offlineInterval = liveInterval, offlineInterval
+	for _, entry := range s.entries {
+		interval := offlineInterval
+		if entry.live {
+			interval = liveInterval
+		}
+		if next := now.Add(s.spread(interval)); next.Before(entry.next) {
+			entry.next = next
+		}
+	}
+}
+
+// remove stops scheduling a streamer
+func (s *scheduler) remove(login string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, login)
+}
+
+// logins returns every scheduled streamer
+func (s *scheduler) logins() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	logins := make([]string, 0, len(s.entries))
+	for login := range s.entries {
+		logins = append(logins, login)
+	}
+	sort.Strings(logins)
+	return logins
+}
+
+// setLive records whether a streamer is live. A streamer going live is due
+// within a small jitter rather than at the end of its offline interval, and
+// one going offline gets a final sweep one live interval later to pick up
+// clips made at the end of the stream.
+func (s *scheduler) setLive(login string, live bool, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[login]
+	if !ok || entry.live == live {
+		return
+	}
+	entry.live = live
+
+	next := now.Add(s.spread(s.liveInterval))
+	if live {
+		next = now.Add(s.jitter(s.liveInterval) / 2)
+	}
+	if next.Before(entry.next) {
+		entry.next = next
+	}
+}
+
+// due returns the streamers whose check is due, live ones first, and
+// schedules their next check one interval from now
+func (s *scheduler) due(now time.Time) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []*scheduleEntry
+	for _, entry := range s.entries {
+		if !entry.next.After(now) {
+			due = append(due, entry)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if due[i].live != due[j].live {
+			return due[i].live
+		}
+		return due[i].next.Before(due[j].next)
+	})
+
+	logins := make([]string, len(due))
+	for i, entry := range due {
+		logins[i] = entry.login
+
+		interval := s.offlineInterval
+		if entry.live {
+			interval = s.liveInterval
+		}
+		entry.next = now.Add(s.spread(interval))
+	}
+
+	return logins
+}
+
+// jitter returns a random duration up to jitterFraction of interval
+func (s *scheduler) jitter(interval time.Duration) time.Duration {
+	max := int64(float64(interval) * jitterFraction)
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(s.rand.Int63n(max + 1))
+}
+
+// spread returns interval moved by a random amount of up to half of
+// jitterFraction either way
+func (s *scheduler) spread(interval time.Duration) time.Duration {
+	return interval + s.jitter(interval) - time.Duration(float64(interval)*jitterFraction/2)
+}
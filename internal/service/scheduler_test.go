@@ -0,0 +1,104 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScheduler(t *testing.T) {
+	interval := time.Minute
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("spreads first checks", func(t *testing.T) {
+		s := newScheduler(interval, 4*interval)
+		for i := 0; i < 100; i++ {
+			s.add(fmt.Sprintf("streamer%d", i), now)
+		}
+
+		if due := s.due(now.Add(-time.Nanosecond)); len(due) != 0 {
+			t.Errorf("Expected nothing due before the first interval, got %d", len(due))
+		}
+		first := len(s.due(now.Add(interval / 2)))
+		if first == 0 || first == 100 {
+			t.Errorf("Expected checks spread across the interval, got %d of 100 in its first half", first)
+		}
+		if rest := len(s.due(now.Add(interval))); first+rest != 100 {
+			t.Errorf("Expected every streamer due within one interval, got %d", first+rest)
+		}
+	})
+
+	t.Run("offline streamers are checked less often", func(t *testing.T) {
+		s := newScheduler(interval, 4*interval)
+		s.add("live", now)
+		s.add("offline", now)
+		s.setLive("live", true, now)
+		s.due(now.Add(interval))
+
+		var liveChecks, offlineChecks int
+		for at := now.Add(interval); at.Before(now.Add(20 * interval)); at = at.Add(time.Second) {
+			for _, login := range s.due(at) {
+				if login == "live" {
+					liveChecks++
+				} else {
+					offlineChecks++
+				}
+			}
+		}
+		if liveChecks < 3*offlineChecks {
+			t.Errorf("Expected live checks to outnumber offline ones about 4 to 1, got %d and %d", liveChecks, offlineChecks)
+		}
+	})
+
+	t.Run("live streamers first", func(t *testing.T) {
+		s := newScheduler(interval, 4*interval)
+		for _, login := range []string{"a", "b", "c"} {
+			s.add(login, now)
+		}
+		s.setLive("c", true, now)
+
+		due := s.due(now.Add(interval))
+		if len(due) != 3 || due[0] != "c" {
+			t.Errorf("Expected the live streamer first, got %s", strings.Join(due, ","))
+		}
+	})
+
+	t.Run("going live is checked soon", func(t *testing.T) {
+		s := newScheduler(interval, 4*interval)
+		s.add("a", now)
+		s.due(now.Add(interval)) // next check a whole offline interval away
+
+		s.setLive("a", true, now.Add(interval))
+		if due := s.due(now.Add(interval + interval/10)); len(due) != 1 {
+			t.Errorf("Expected a check shortly after going live, got %v", due)
+		}
+	})
+
+	t.Run("going offline gets a final sweep", func(t *testing.T) {
+		s := newScheduler(interval, 4*interval)
+		s.add("a", now)
+		s.setLive("a", true, now)
+		s.due(now.Add(interval))
+
+		s.setLive("a", false, now.Add(interval))
+		if due := s.due(now.Add(interval + interval/2)); len(due) != 0 {
+			t.Errorf("Expected no check before the final sweep, got %v", due)
+		}
+		if due := s.due(now.Add(2*interval + interval/10)); len(due) != 1 {
+			t.Errorf("Expected a final sweep one live interval after going offline, got %v", due)
+		}
+		if due := s.due(now.Add(4 * interval)); len(due) != 0 {
+			t.Errorf("Expected the offline interval after the final sweep, got %v", due)
+		}
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		s := newScheduler(interval, 4*interval)
+		s.add("a", now)
+		s.remove("a")
+		if due := s.due(now.Add(interval)); len(due) != 0 || len(s.logins()) != 0 {
+			t.Errorf("Expected removed streamer to be gone, got %v", due)
+		}
+	})
+}
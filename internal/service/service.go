@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"twitchclipsearch/internal/config"
@@ -12,57 +13,153 @@ import (
 	"twitchclipsearch/internal/discord"
 	"twitchclipsearch/internal/logger"
 	"twitchclipsearch/internal/metrics"
+	"twitchclipsearch/internal/twitch"
 
 	"github.com/nicklaw5/helix/v2"
-	"golang.org/x/time/rate"
+)
+
+const (
+	// clipsPerPage is the largest page size Get Clips allows
+	clipsPerPage = 100
+	// defaultMaxClipPages bounds how many pages of clips one check fetches
+	defaultMaxClipPages = 10
+	// minClipWindow stops clip windows that overflow the page limit from
+	// being split any further
+	minClipWindow = time.Minute
+	// firstCheckWindow is how far back the first check of a streamer without
+	// stored clips looks; older clips are left to backfill
+	firstCheckWindow = time.Hour
+	// defaultCheckInterval is how often live streamers are checked by default
+	defaultCheckInterval = 5 * time.Minute
+	// offlineIntervalFactor stretches the check interval for offline streamers
+	// when no offline interval is configured
+	offlineIntervalFactor = 4
 )
 
 // ClipService handles the core business logic for monitoring and processing Twitch clips
 type ClipService struct {
-	config     *config.Config
-	db         *database.DB
+	config     atomic.Pointer[config.Config]
+	db         database.ClipStore
 	twitch     *helix.Client
-	limiter    *rate.Limiter
+	tokens     *twitch.TokenManager
+	limiter    *twitch.RateLimiter
 	workerPool *WorkerPool
+	scheduler  *scheduler
+	// discord holds a client per webhook, rebuilt by Reload
+	discord *discord.Registry
+	// templates holds the parsed message templates, rebuilt by Reload
+	templates atomic.Pointer[messageTemplates]
+	// outboxWake makes the delivery loop check the outbox before its next tick
+	outboxWake chan struct{}
 	shutdown   chan struct{}
 	wg         sync.WaitGroup
+
+	// mu guards ctx, cancel and stopped, which gate out-of-band checks
+	mu      sync.Mutex
+	ctx     context.Context
+	cancel  context.CancelFunc
+	stopped bool
+	// checking holds the streamers whose clips are being checked right now
+	checking sync.Map
+
+	// streamersMu guards managed, the streamers added through the API by login
+	streamersMu sync.RWMutex
+	managed     map[string]*database.Streamer
+	// reloadMu serializes configuration reloads
+	reloadMu sync.Mutex
 }
 
 // NewClipService creates a new instance of ClipService with the provided dependencies
-func NewClipService(cfg *config.Config, db *database.DB) (*ClipService, error) {
+func NewClipService(cfg *config.Config, db database.ClipStore) (*ClipService, error) {
+	// Every Helix request is authorized with an app access token and paced
+	// by the rate limit bucket Twitch reports
+	tokens := twitch.NewTokenManager(cfg.Twitch.ClientID, cfg.Twitch.ClientSecret)
+	limiter := twitch.NewRateLimiter(tokens)
+
 	client, err := helix.NewClient(&helix.Options{
-		ClientID:     cfg.TwitchClientID,
-		ClientSecret: cfg.TwitchClientSecret,
+		ClientID:     cfg.Twitch.ClientID,
+		ClientSecret: cfg.Twitch.ClientSecret,
+		HTTPClient:   limiter,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Twitch client: %w", err)
 	}
 
-	// Initialize rate limiter with Twitch API limits (30 requests per minute)
-	limiter := rate.NewLimiter(rate.Every(2*time.Second), 1)
-
 	// Create worker pool with configurable size
 	pool := NewWorkerPool(5) // Adjust pool size based on needs
 
-	return &ClipService{
-		config:     cfg,
+	interval, offlineInterval := checkIntervals(cfg)
+
+	s := &ClipService{
 		db:         db,
 		twitch:     client,
+		tokens:     tokens,
 		limiter:    limiter,
 		workerPool: pool,
+		scheduler:  newScheduler(interval, offlineInterval),
+		discord:    discord.NewRegistry(discordConfig(cfg)),
+		outboxWake: make(chan struct{}, 1),
 		shutdown:   make(chan struct{}),
-	}, nil
+		managed:    make(map[string]*database.Streamer),
+	}
+	s.config.Store(cfg)
+	s.templates.Store(newMessageTemplates(cfg))
+
+	return s, nil
+}
+
+// cfg returns the current configuration, which Reload may replace at any time
+func (s *ClipService) cfg() *config.Config {
+	return s.config.Load()
 }
 
 // Start begins the clip monitoring service
 func (s *ClipService) Start(ctx context.Context) error {
+	// Fail fast on bad credentials rather than on every poll
+	if _, err := s.tokens.Token(ctx); err != nil {
+		return fmt.Errorf("failed to obtain Twitch app access token: %w", err)
+	}
+	if err := s.LoadStreamers(); err != nil {
+		return fmt.Errorf("failed to load monitored streamers: %w", err)
+	}
+
 	// Start the worker pool
 	s.workerPool.Start()
 
-	// Start monitoring for each streamer
-	for streamerName := range s.config.Streamers {
+	ctx, cancel := context.WithCancel(ctx)
+	s.mu.Lock()
+	s.ctx = ctx
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	// Renew the app access token before it expires
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.tokens.Run(ctx)
+	}()
+
+	// Schedule every streamer and start polling
+	now := time.Now()
+	logins := s.monitoredLogins()
+	for _, streamerName := range logins {
+		s.scheduler.add(streamerName, now)
+	}
+	s.wg.Add(1)
+	go s.runScheduler(ctx)
+
+	// Deliver queued Discord notifications, including those left over from
+	// an earlier run
+	s.wg.Add(1)
+	go s.runOutbox(ctx)
+
+	// Subscribe to EventSub notifications for near-real-time checks
+	if s.cfg().Twitch.EventSub.Enabled && s.cfg().Twitch.EventSub.CallbackURL != "" {
 		s.wg.Add(1)
-		go s.monitorStreamer(ctx, streamerName)
+		go func() {
+			defer s.wg.Done()
+			s.subscribeEventSub(ctx, logins)
+		}()
 	}
 
 	return nil
@@ -71,6 +168,12 @@ func (s *ClipService) Start(ctx context.Context) error {
 // Stop gracefully shuts down the service
 func (s *ClipService) Stop() error {
 	// Signal shutdown
+	s.mu.Lock()
+	s.stopped = true
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.mu.Unlock()
 	close(s.shutdown)
 
 	// Wait for all goroutines to finish
@@ -82,89 +185,213 @@ func (s *ClipService) Stop() error {
 	return nil
 }
 
-// monitorStreamer continuously monitors a streamer's clips
-func (s *ClipService) monitorStreamer(ctx context.Context, streamerName string) {
+// TriggerCheck checks a streamer's clips immediately, outside the polling
+// interval. It returns false if the service is not running or a check for the
+// streamer is already in progress.
+func (s *ClipService) TriggerCheck(streamerName string) bool {
+	s.mu.Lock()
+	if s.ctx == nil || s.stopped {
+		s.mu.Unlock()
+		return false
+	}
+	ctx := s.ctx
+	s.wg.Add(1)
+	s.mu.Unlock()
 	defer s.wg.Done()
 
-	ticker := time.NewTicker(time.Duration(s.config.CheckIntervalSecs) * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-s.shutdown:
-			return
-		case <-ticker.C:
-			s.checkNewClips(ctx, streamerName)
-		}
+	return s.startCheck(ctx, streamerName)
+}
+
+// startCheck runs a check in the background unless one for the streamer is
+// already in progress. The caller must hold a reference on s.wg.
+func (s *ClipService) startCheck(ctx context.Context, streamerName string) bool {
+	if _, busy := s.checking.Load(streamerName); busy {
+		return false
 	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.runCheck(ctx, streamerName)
+	}()
+
+	return true
+}
+
+// runCheck runs checkNewClips unless a check for the streamer is already running
+func (s *ClipService) runCheck(ctx context.Context, streamerName string) {
+	if _, busy := s.checking.LoadOrStore(streamerName, struct{}{}); busy {
+		return
+	}
+	defer s.checking.Delete(streamerName)
+
+	s.checkNewClips(ctx, streamerName)
 }
 
 // checkNewClips fetches and processes new clips for a streamer
 func (s *ClipService) checkNewClips(ctx context.Context, streamerName string) {
-	// Wait for rate limit
-	err := s.limiter.Wait(ctx)
+	// Resolve the broadcaster ID, usually from the streamers table
+	streamer, err := s.lookupStreamer(ctx, streamerName)
 	if err != nil {
-		logger.Error("Rate limit wait error", "error", err)
+		if ctx.Err() == nil {
+			logger.Error("Failed to look up streamer", "error", err, "streamer", streamerName)
+		}
 		return
 	}
 
-	// Get user ID for the streamer
-	users, err := s.twitch.GetUsers(&helix.UsersParams{
-		Logins: []string{streamerName},
-	})
+	latestTime, err := s.checkStart(streamerName)
 	if err != nil {
-		logger.Error("Failed to get Twitch user", "error", err, "streamer", streamerName)
-		metrics.RecordError("twitch_api_error")
+		logger.Error("Failed to get latest clip time", "error", err, "streamer", streamerName)
+		metrics.RecordError("database_error")
 		return
 	}
 
-	if len(users.Data.Users) == 0 {
+	// Fetch the clips created since the newest stored one. fetchClips paces
+	// every page after the first, so the first request waits here.
+	if err := s.limiter.Wait(ctx); err != nil {
 		return
 	}
 
-	userID := users.Data.Users[0].ID
-
-	// Get latest clip time from database
-	latestTime, err := s.db.GetLatestClipTime(streamerName)
+	// Nothing is stored from a failed fetch, so the next check asks for the
+	// same window again
+	clips, truncated, err := s.fetchAllClips(ctx, streamer.BroadcasterID, latestTime, time.Now())
 	if err != nil {
-		logger.Error("Failed to get latest clip time", "error", err, "streamer", streamerName)
-		metrics.RecordError("database_error")
+		if ctx.Err() == nil {
+			logger.Error("Failed to fetch clips", "error", err, "streamer", streamerName)
+			metrics.RecordError("twitch_api_error")
+		}
 		return
 	}
-
-	// Fetch clips after the latest time
-	clips, err := s.twitch.GetClips(&helix.ClipsParams{
-		BroadcasterID: userID,
-		StartedAt:     latestTime,
-	})
-	if err != nil {
-		logger.Error("Failed to fetch clips", "error", err, "streamer", streamerName)
-		metrics.RecordError("twitch_api_error")
-		return
+	if truncated {
+		logger.Warn("Clips in a minute exceed the page limit, some were skipped", "streamer", streamerName, "clips", len(clips))
 	}
 
 	// Process new clips using worker pool
-	for _, clip := range clips.Data.Clips {
+	for _, clip := range clips {
 		clipData := clip // Create new variable to avoid closure issues
 		s.workerPool.Submit(func() {
-			s.processClip(ctx, streamerName, &clipData)
+			s.processClip(streamerName, &clipData)
+		})
+	}
+}
+
+// checkStart returns where a check's window starts: the creation time of the
+// streamer's newest stored clip, or firstCheckWindow ago if none is stored,
+// so that a new streamer's archive is not posted to Discord
+func (s *ClipService) checkStart(streamerName string) (time.Time, error) {
+	latest, err := s.db.GetLatestClipTime(streamerName)
+	if err != nil || !latest.IsZero() {
+		return latest, err
+	}
+	return time.Now().Add(-firstCheckWindow), nil
+}
+
+// fetchClips returns the broadcaster's clips created between startedAt and
+// endedAt, following the pagination cursor up to the configured page limit,
+// and whether that limit cut the results short. On error the clips fetched so
+// far are returned with it.
+func (s *ClipService) fetchClips(ctx context.Context, broadcasterID string, startedAt, endedAt time.Time) ([]helix.Clip, bool, error) {
+	maxPages := s.cfg().Twitch.MaxClipPages
+	if maxPages <= 0 {
+		maxPages = defaultMaxClipPages
+	}
+
+	var (
+		clips  []helix.Clip
+		cursor string
+	)
+	for page := 0; page < maxPages; page++ {
+		// The caller waits for the rate limiter before the first page
+		if page > 0 {
+			if err := s.limiter.Wait(ctx); err != nil {
+				return clips, false, err
+			}
+		}
+
+		resp, err := s.twitch.GetClips(&helix.ClipsParams{
+			BroadcasterID: broadcasterID,
+			First:         clipsPerPage,
+			After:         cursor,
+			StartedAt:     helix.Time{Time: startedAt},
+			EndedAt:       helix.Time{Time: endedAt},
 		})
+		if err != nil {
+			return clips, false, err
+		}
+		if resp.StatusCode >= 300 {
+			return clips, false, fmt.Errorf("get clips failed with status %d: %s", resp.StatusCode, resp.ErrorMessage)
+		}
+
+		clips = append(clips, resp.Data.Clips...)
+
+		cursor = resp.Data.Pagination.Cursor
+		if cursor == "" {
+			return clips, false, nil
+		}
+	}
+
+	return clips, true, nil
+}
+
+// fetchAllClips returns every clip of the broadcaster created between
+// startedAt and endedAt. Twitch returns clips by view count, not by time, so a
+// window cut short at the page limit may be missing older clips with few
+// views; such windows are fetched again in halves until each fits. Only
+// windows of minClipWindow that still overflow are returned truncated.
+func (s *ClipService) fetchAllClips(ctx context.Context, broadcasterID string, startedAt, endedAt time.Time) ([]helix.Clip, bool, error) {
+	clips, truncated, err := s.fetchClips(ctx, broadcasterID, startedAt, endedAt)
+	if err != nil {
+		return nil, false, err
+	}
+	if !truncated || endedAt.Sub(startedAt) <= minClipWindow {
+		return clips, truncated, nil
+	}
+
+	middle := startedAt.Add(endedAt.Sub(startedAt) / 2)
+	logger.Debug("Splitting clip window", "broadcaster_id", broadcasterID, "started_at", startedAt, "ended_at", endedAt)
+
+	var all []helix.Clip
+	seen := make(map[string]bool)
+	truncated = false
+	for _, window := range [][2]time.Time{{startedAt, middle}, {middle, endedAt}} {
+		if err := s.limiter.Wait(ctx); err != nil {
+			return nil, false, err
+		}
+		clips, windowTruncated, err := s.fetchAllClips(ctx, broadcasterID, window[0], window[1])
+		if err != nil {
+			return nil, false, err
+		}
+		truncated = truncated || windowTruncated
+		// A clip created at the middle can be in both halves
+		for _, clip := range clips {
+			if !seen[clip.ID] {
+				seen[clip.ID] = true
+				all = append(all, clip)
+			}
+		}
 	}
+	return all, truncated, nil
 }
 
 // processClip handles individual clip processing and storage
-func (s *ClipService) processClip(ctx context.Context, streamerName string, clip *helix.Clip) {
+func (s *ClipService) processClip(streamerName string, clip *helix.Clip) {
+	// Errors are logged by storeClip; the notification is delivered by the outbox
+	s.storeClip(streamerName, clip, true)
+}
+
+// storeClip saves a clip unless it is already stored, queueing its
+// notifications in the outbox along with it if notify is set. It returns the
+// saved clip, nil if it already existed, or the error it logged.
+func (s *ClipService) storeClip(streamerName string, clip *helix.Clip, notify bool) (*database.Clip, error) {
 	// Check if clip already exists
 	exists, err := s.db.ClipExists(clip.ID)
 	if err != nil {
 		logger.Error("Failed to check clip existence", "error", err, "clip_id", clip.ID, "streamer", streamerName)
 		metrics.RecordError("database_error")
-		return
+		return nil, err
 	}
 	if exists {
-		return
+		return nil, nil
 	}
 
 	// Convert clip data
@@ -172,49 +399,91 @@ func (s *ClipService) processClip(ctx context.Context, streamerName string, clip
 	if err != nil {
 		logger.Error("Failed to parse clip creation time", "error", err, "clip_id", clip.ID, "streamer", streamerName)
 		metrics.RecordError("clip_processing_error")
-		return
+		return nil, err
+	}
+
+	// Group the clip with the stream it was made in; a clip that cannot be
+	// placed is still worth keeping
+	var streamID string
+	session, err := s.db.FindStreamSession(streamerName, createdAt)
+	if err != nil {
+		logger.Warn("Failed to find stream session for clip", "error", err, "clip_id", clip.ID, "streamer", streamerName)
+	} else if session != nil {
+		streamID = session.ID
 	}
 
 	dbClip := &database.Clip{
-		ID:           clip.ID,
-		StreamerName: streamerName,
-		Title:        clip.Title,
-		URL:          clip.URL,
-		CreatedAt:    createdAt,
-		PostedAt:     time.Now(),
+		ID:            clip.ID,
+		StreamerName:  streamerName,
+		BroadcasterID: clip.BroadcasterID,
+		Title:         clip.Title,
+		URL:           clip.URL,
+		EmbedURL:      clip.EmbedURL,
+		ThumbnailURL:  clip.ThumbnailURL,
+		CreatorID:     clip.CreatorID,
+		CreatorName:   clip.CreatorName,
+		GameID:        clip.GameID,
+		VideoID:       clip.VideoID,
+		Language:      clip.Language,
+		ViewCount:     clip.ViewCount,
+		Duration:      clip.Duration,
+		VodOffset:     clip.VodOffset,
+		StreamID:      streamID,
+		CreatedAt:     createdAt,
+		PostedAt:      time.Now(),
 	}
 
-	// Save to database
-	if err := s.db.SaveClip(dbClip); err != nil {
+	// Save to database, together with the notification so that neither is
+	// stored without the other
+	var notifications []*database.Notification
+	if notify {
+		notifications = s.notifications(dbClip)
+	}
+	if len(notifications) > 0 {
+		err = s.db.SaveClipAndNotify(dbClip, notifications)
+	} else {
+		err = s.db.SaveClip(dbClip)
+	}
+	if err != nil {
 		logger.Error("Failed to save clip", "error", err, "clip_id", clip.ID, "streamer", streamerName)
 		metrics.RecordError("database_error")
-		return
+		return nil, err
+	}
+	if len(notifications) > 0 {
+		s.wakeOutbox()
 	}
 
-	// Send notification (webhook)
-	s.sendNotification(streamerName, dbClip)
+	return dbClip, nil
 }
 
-// sendNotification sends a webhook notification for a new clip
-func (s *ClipService) sendNotification(streamerName string, clip *database.Clip) {
-	// Get webhook URL for the streamer
-	webhookURL, ok := s.config.Streamers[streamerName]
-	if !ok {
-		return
+// message renders the Discord message of a clip with the template of one of
+// its streamer's destinations
+func (s *ClipService) message(clip *database.Clip, destination config.Destination) (*discord.Message, error) {
+	tmpl, err := s.templates.Load().lookup(s.cfg(), clip.StreamerName, destination)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message template: %w", err)
 	}
-
-	// Create Discord client
-	discordConfig := &discord.ClientConfig{
-		WebhookURL: webhookURL,
-		Username:   "TwitchClipBot",
-		RateLimit:  5,
+	msg, err := discord.RenderMessage(tmpl, clip)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render message template: %w", err)
 	}
+	return msg, nil
+}
 
-	client := discord.NewClient(discordConfig)
-
-	// Send notification
-	if err := client.SendClipNotification(clip); err != nil {
-		// Record metric for failed webhook
-		metrics.RecordRateLimitHit("discord_webhook")
+// discordConfig returns the Discord client settings of a configuration
+func discordConfig(cfg *config.Config) discord.ClientConfig {
+	username := cfg.Discord.Username
+	if username == "" {
+		username = "TwitchClipBot"
+	}
+	return discord.ClientConfig{
+		Username:  username,
+		RateLimit: float64(cfg.Discord.RateLimit),
 	}
 }
+
+// refreshDiscordClients applies the current Discord settings and drops the
+// clients of webhooks that are no longer used
+func (s *ClipService) refreshDiscordClients() {
+	s.discord.Reconfigure(discordConfig(s.cfg()), s.webhookURLs())
+}
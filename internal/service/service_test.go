@@ -0,0 +1,1020 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"twitchclipsearch/internal/config"
+	"twitchclipsearch/internal/database"
+	"twitchclipsearch/internal/discord"
+	"twitchclipsearch/internal/discord/msgtemplate"
+	"twitchclipsearch/internal/twitch"
+
+	"github.com/nicklaw5/helix/v2"
+)
+
+// newTestService returns a service talking to a Twitch API stand-in
+func newTestService(t *testing.T, cfg *config.Config, api http.Handler) *ClipService {
+	t.Helper()
+
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	client, err := helix.NewClient(&helix.Options{
+		ClientID:       "test",
+		AppAccessToken: "test",
+		APIBaseURL:     server.URL,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Twitch client: %v", err)
+	}
+
+	s := &ClipService{
+		twitch:     client,
+		limiter:    twitch.NewRateLimiter(http.DefaultClient),
+		scheduler:  newScheduler(time.Minute, 4*time.Minute),
+		discord:    discord.NewRegistry(discordConfig(cfg)),
+		outboxWake: make(chan struct{}, 1),
+		shutdown:   make(chan struct{}),
+		managed:    make(map[string]*database.Streamer),
+	}
+	s.config.Store(cfg)
+	s.templates.Store(newMessageTemplates(cfg))
+	return s
+}
+
+// clipPages serves totalClips clips in pages of the requested size
+func clipPages(t *testing.T, totalClips int, requests *[]*http.Request) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		*requests = append(*requests, r)
+
+		first, _ := strconv.Atoi(r.URL.Query().Get("first"))
+		offset, _ := strconv.Atoi(r.URL.Query().Get("after"))
+
+		var page helix.ManyClips
+		for i := offset; i < totalClips && i < offset+first; i++ {
+			page.Clips = append(page.Clips, helix.Clip{ID: fmt.Sprintf("clip-%d", i)})
+		}
+		if next := offset + first; next < totalClips {
+			page.Pagination.Cursor = strconv.Itoa(next)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(page); err != nil {
+			t.Errorf("Failed to encode clips: %v", err)
+		}
+	}
+}
+
+func TestFetchClips(t *testing.T) {
+	startedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	endedAt := startedAt.Add(24 * time.Hour)
+
+	t.Run("follows cursor", func(t *testing.T) {
+		var requests []*http.Request
+		s := newTestService(t, &config.Config{}, clipPages(t, 250, &requests))
+
+		clips, truncated, err := s.fetchClips(context.Background(), "1337", startedAt, endedAt)
+		if err != nil {
+			t.Fatalf("fetchClips failed: %v", err)
+		}
+		if truncated {
+			t.Error("Expected all pages to be fetched")
+		}
+		if len(clips) != 250 {
+			t.Errorf("Expected 250 clips, got %d", len(clips))
+		}
+		if len(requests) != 3 {
+			t.Fatalf("Expected 3 requests, got %d", len(requests))
+		}
+
+		query := requests[0].URL.Query()
+		if query.Get("first") != "100" || query.Get("broadcaster_id") != "1337" {
+			t.Errorf("Unexpected query %s", requests[0].URL.RawQuery)
+		}
+		if query.Get("started_at") != startedAt.Format(time.RFC3339) || query.Get("ended_at") != endedAt.Format(time.RFC3339) {
+			t.Errorf("Expected clip window %s to %s, got %s", startedAt.Format(time.RFC3339), endedAt.Format(time.RFC3339), requests[0].URL.RawQuery)
+		}
+		if after := requests[1].URL.Query().Get("after"); after != "100" {
+			t.Errorf("Expected second request after cursor 100, got %q", after)
+		}
+	})
+
+	t.Run("page limit", func(t *testing.T) {
+		var requests []*http.Request
+		s := newTestService(t, &config.Config{Twitch: config.TwitchConfig{MaxClipPages: 2}}, clipPages(t, 1000, &requests))
+
+		clips, truncated, err := s.fetchClips(context.Background(), "1337", startedAt, endedAt)
+		if err != nil {
+			t.Fatalf("fetchClips failed: %v", err)
+		}
+		if !truncated {
+			t.Error("Expected results to be cut short at the page limit")
+		}
+		if len(clips) != 200 || len(requests) != 2 {
+			t.Errorf("Expected 200 clips from 2 requests, got %d from %d", len(clips), len(requests))
+		}
+	})
+
+	t.Run("error keeps fetched pages", func(t *testing.T) {
+		var requests []*http.Request
+		pages := clipPages(t, 1000, &requests)
+		s := newTestService(t, &config.Config{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("after") == "200" {
+				http.Error(w, `{"error":"Internal Server Error","status":500,"message":""}`, http.StatusInternalServerError)
+				return
+			}
+			pages(w, r)
+		}))
+
+		clips, _, err := s.fetchClips(context.Background(), "1337", startedAt, endedAt)
+		if err == nil {
+			t.Error("Expected error for failed page")
+		}
+		if len(clips) != 200 {
+			t.Errorf("Expected the 200 clips fetched before the error, got %d", len(clips))
+		}
+	})
+}
+
+// memoryStore keeps clips, backfill checkpoints, streamers, stream sessions
+// and queued notifications in memory
+type memoryStore struct {
+	database.ClipStore
+	clips         map[string]*database.Clip
+	checkpoints   map[string]*database.BackfillCheckpoint
+	streamers     map[string]*database.Streamer
+	sessions      map[string]*database.StreamSession
+	notifications map[int64]*database.Notification
+	// notificationID is the ID of the last queued notification
+	notificationID int64
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		clips:         make(map[string]*database.Clip),
+		checkpoints:   make(map[string]*database.BackfillCheckpoint),
+		streamers:     make(map[string]*database.Streamer),
+		sessions:      make(map[string]*database.StreamSession),
+		notifications: make(map[int64]*database.Notification),
+	}
+}
+
+func (m *memoryStore) ListMonitoredStreamers() ([]*database.Streamer, error) {
+	var streamers []*database.Streamer
+	for _, streamer := range m.streamers {
+		if streamer.Monitored {
+			streamers = append(streamers, streamer)
+		}
+	}
+	return streamers, nil
+}
+
+func (m *memoryStore) SetStreamerMonitoring(streamer *database.Streamer) error {
+	stored := *streamer
+	m.streamers[streamer.Login] = &stored
+	return nil
+}
+
+func (m *memoryStore) SaveStreamSession(session *database.StreamSession) error {
+	m.sessions[session.ID] = session
+	return nil
+}
+
+func (m *memoryStore) EndStreamSessions(streamerName string, endedAt time.Time) error {
+	for _, session := range m.sessions {
+		if session.StreamerName == streamerName && session.EndedAt.IsZero() {
+			session.EndedAt = endedAt
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) FindStreamSession(streamerName string, at time.Time) (*database.StreamSession, error) {
+	for _, session := range m.sessions {
+		if session.StreamerName == streamerName && !session.StartedAt.After(at) &&
+			(session.EndedAt.IsZero() || !session.EndedAt.Before(at)) {
+			return session, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memoryStore) GetStreamer(login string) (*database.Streamer, error) {
+	return m.streamers[login], nil
+}
+
+func (m *memoryStore) SaveStreamer(streamer *database.Streamer) (string, error) {
+	var previousLogin string
+	for login, stored := range m.streamers {
+		if stored.BroadcasterID == streamer.BroadcasterID && login != streamer.Login {
+			previousLogin = login
+			delete(m.streamers, login)
+		}
+	}
+	m.streamers[streamer.Login] = streamer
+	return previousLogin, nil
+}
+
+func (m *memoryStore) ClipExists(clipID string) (bool, error) {
+	_, ok := m.clips[clipID]
+	return ok, nil
+}
+
+func (m *memoryStore) SaveClip(clip *database.Clip) error {
+	m.clips[clip.ID] = clip
+	return nil
+}
+
+func (m *memoryStore) SaveClipAndNotify(clip *database.Clip, notifications []*database.Notification) error {
+	m.clips[clip.ID] = clip
+	for _, notification := range notifications {
+		m.notificationID++
+		queued := *notification
+		queued.ID = m.notificationID
+		queued.ClipID = clip.ID
+		queued.Clip = clip
+		queued.Status = database.NotificationPending
+		m.notifications[queued.ID] = &queued
+	}
+	return nil
+}
+
+func (m *memoryStore) ClaimNotifications(streamerName string, now, until time.Time, limit int) ([]*database.Notification, error) {
+	var due []*database.Notification
+	for id := int64(1); id <= m.notificationID; id++ {
+		notification, ok := m.notifications[id]
+		if !ok || (streamerName != "" && notification.Clip.StreamerName != streamerName) {
+			continue
+		}
+		if notification.Status == database.NotificationPending && !notification.NextAttemptAt.After(now) && len(due) < limit {
+			notification.NextAttemptAt = until
+			copied := *notification
+			due = append(due, &copied)
+		}
+	}
+	return due, nil
+}
+
+func (m *memoryStore) UpdateNotification(notification *database.Notification) error {
+	stored := *notification
+	m.notifications[notification.ID] = &stored
+	return nil
+}
+
+func (m *memoryStore) DeleteNotification(id int64) error {
+	delete(m.notifications, id)
+	return nil
+}
+
+func (m *memoryStore) UpdateClipViewCounts(viewCounts map[string]int) error {
+	for id, viewCount := range viewCounts {
+		if clip, ok := m.clips[id]; ok {
+			clip.ViewCount = viewCount
+		}
+	}
+	return nil
+}
+
+// GetClips returns the newest clip of the queried streamer, all previews need
+func (m *memoryStore) GetClips(query database.ClipQuery) (*database.ClipPage, error) {
+	var newest *database.Clip
+	for _, clip := range m.clips {
+		if clip.StreamerName == query.StreamerName && (newest == nil || clip.CreatedAt.After(newest.CreatedAt)) {
+			newest = clip
+		}
+	}
+	page := &database.ClipPage{}
+	if newest != nil {
+		page.Clips = append(page.Clips, newest)
+	}
+	return page, nil
+}
+
+func (m *memoryStore) GetLatestClipTime(streamerName string) (time.Time, error) {
+	var latest time.Time
+	for _, clip := range m.clips {
+		if clip.StreamerName == streamerName && clip.CreatedAt.After(latest) {
+			latest = clip.CreatedAt
+		}
+	}
+	return latest, nil
+}
+
+func (m *memoryStore) GetBackfillCheckpoint(streamerName string, since time.Time) (*database.BackfillCheckpoint, error) {
+	return m.checkpoints[streamerName+since.UTC().String()], nil
+}
+
+func (m *memoryStore) SaveBackfillCheckpoint(checkpoint *database.BackfillCheckpoint) error {
+	m.checkpoints[checkpoint.StreamerName+checkpoint.Since.UTC().String()] = checkpoint
+	return nil
+}
+
+// archiveAPI serves one broadcaster and the clips created at the given times,
+// filtered by the requested window and paged like Get Clips
+func archiveAPI(t *testing.T, createdAt []time.Time, clipRequests *int) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"data": [{"id": "1337", "login": "cool_user"}]}`)
+	})
+	mux.HandleFunc("/clips", func(w http.ResponseWriter, r *http.Request) {
+		*clipRequests++
+
+		query := r.URL.Query()
+		startedAt, _ := time.Parse(time.RFC3339, query.Get("started_at"))
+		endedAt, _ := time.Parse(time.RFC3339, query.Get("ended_at"))
+		first, _ := strconv.Atoi(query.Get("first"))
+		offset, _ := strconv.Atoi(query.Get("after"))
+
+		var inWindow []helix.Clip
+		for i, created := range createdAt {
+			if !created.Before(startedAt) && created.Before(endedAt) {
+				inWindow = append(inWindow, helix.Clip{ID: fmt.Sprintf("clip-%d", i), CreatedAt: created.Format(time.RFC3339)})
+			}
+		}
+
+		var page helix.ManyClips
+		for i := offset; i < len(inWindow) && i < offset+first; i++ {
+			page.Clips = append(page.Clips, inWindow[i])
+		}
+		if next := offset + first; next < len(inWindow) {
+			page.Pagination.Cursor = strconv.Itoa(next)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(page); err != nil {
+			t.Errorf("Failed to encode clips: %v", err)
+		}
+	})
+	return mux
+}
+
+func TestBackfill(t *testing.T) {
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("walks windows and resumes", func(t *testing.T) {
+		createdAt := []time.Time{since.Add(time.Hour), since.AddDate(0, 0, 8), since.AddDate(0, 0, 20)}
+		var requests int
+		store := newMemoryStore()
+		s := newTestService(t, &config.Config{}, archiveAPI(t, createdAt, &requests))
+		s.db = store
+
+		opts := BackfillOptions{Since: since, Until: since.AddDate(0, 0, 21), Window: 7 * 24 * time.Hour}
+		result, err := s.Backfill(context.Background(), "cool_user", opts)
+		if err != nil {
+			t.Fatalf("Backfill failed: %v", err)
+		}
+		if result.Windows != 3 || result.Saved != 3 || len(store.clips) != 3 {
+			t.Errorf("Expected 3 clips saved over 3 windows, got %+v", result)
+		}
+
+		// Extending the range only fetches the new part
+		requests = 0
+		opts.Until = since.AddDate(0, 0, 28)
+		result, err = s.Backfill(context.Background(), "cool_user", opts)
+		if err != nil {
+			t.Fatalf("Resumed backfill failed: %v", err)
+		}
+		if !result.ResumedFrom.Equal(since.AddDate(0, 0, 21)) || result.Windows != 1 || requests != 1 {
+			t.Errorf("Expected one window resumed from the checkpoint, got %+v after %d requests", result, requests)
+		}
+	})
+
+	t.Run("splits busy windows", func(t *testing.T) {
+		// 150 clips in two days do not fit one page of 100
+		var createdAt []time.Time
+		for i := 0; i < 150; i++ {
+			createdAt = append(createdAt, since.Add(time.Duration(i)*20*time.Minute))
+		}
+		var requests int
+		store := newMemoryStore()
+		s := newTestService(t, &config.Config{Twitch: config.TwitchConfig{MaxClipPages: 1}}, archiveAPI(t, createdAt, &requests))
+		s.db = store
+
+		result, err := s.Backfill(context.Background(), "cool_user", BackfillOptions{
+			Since: since, Until: since.AddDate(0, 0, 7), Window: 7 * 24 * time.Hour,
+		})
+		if err != nil {
+			t.Fatalf("Backfill failed: %v", err)
+		}
+		if result.Saved != 150 || len(store.clips) != 150 {
+			t.Errorf("Expected all 150 clips saved, got %+v", result)
+		}
+	})
+}
+
+func TestPollOnce(t *testing.T) {
+	stored := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	var requests int
+	store := newMemoryStore()
+	store.clips["clip-0"] = &database.Clip{ID: "clip-0", StreamerName: "cool_user", CreatedAt: stored}
+	s := newTestService(t, &config.Config{}, archiveAPI(t, []time.Time{stored, stored.Add(time.Hour)}, &requests))
+	s.db = store
+
+	result, err := s.PollOnce(context.Background(), "cool_user", false)
+	if err != nil {
+		t.Fatalf("PollOnce failed: %v", err)
+	}
+	// The newest stored clip is fetched again but not saved twice
+	if result.Fetched != 2 || result.Saved != 1 || len(store.clips) != 2 {
+		t.Errorf("Expected 1 of 2 fetched clips saved, got %+v", result)
+	}
+}
+
+func TestCheckNewClips(t *testing.T) {
+	run := func(t *testing.T, cfg *config.Config, api http.Handler, stored time.Time) *memoryStore {
+		t.Helper()
+		store := newMemoryStore()
+		store.clips["stored"] = &database.Clip{ID: "stored", StreamerName: "cool_user", CreatedAt: stored}
+		s := newTestService(t, cfg, api)
+		s.db = store
+		s.workerPool = NewWorkerPool(1)
+		s.workerPool.Start()
+
+		s.checkNewClips(context.Background(), "cool_user")
+		s.workerPool.Stop()
+		return store
+	}
+
+	t.Run("failed page stores nothing", func(t *testing.T) {
+		stored := time.Now().Add(-time.Hour).Truncate(time.Second)
+		createdAt := make([]time.Time, 150)
+		for i := range createdAt {
+			createdAt[i] = stored.Add(time.Duration(i+1) * time.Second)
+		}
+		var requests int
+		archive := archiveAPI(t, createdAt, &requests)
+		api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("after") != "" {
+				http.Error(w, `{"error":"Internal Server Error","status":500,"message":""}`, http.StatusInternalServerError)
+				return
+			}
+			archive.ServeHTTP(w, r)
+		})
+
+		// The first page alone would move the newest stored clip past the
+		// clips of the failed page
+		if store := run(t, &config.Config{}, api, stored); len(store.clips) != 1 {
+			t.Errorf("Expected no clips stored from a failed fetch, got %d", len(store.clips)-1)
+		}
+	})
+
+	t.Run("new streamer starts from recent clips", func(t *testing.T) {
+		now := time.Now().Truncate(time.Second)
+		createdAt := []time.Time{now.AddDate(-2, 0, 0), now.AddDate(0, -1, 0), now.Add(-10 * time.Minute)}
+		var requests int
+		store := newMemoryStore()
+		s := newTestService(t, &config.Config{}, archiveAPI(t, createdAt, &requests))
+		s.db = store
+		s.workerPool = NewWorkerPool(1)
+		s.workerPool.Start()
+
+		s.checkNewClips(context.Background(), "cool_user")
+		s.workerPool.Stop()
+		// The archive is left to backfill rather than posted to Discord
+		if _, ok := store.clips["clip-2"]; !ok || len(store.clips) != 1 || requests != 1 {
+			t.Errorf("Expected only the recent clip stored with one request, got %d clips and %d requests", len(store.clips), requests)
+		}
+	})
+
+	t.Run("splits truncated windows", func(t *testing.T) {
+		stored := time.Now().Add(-3 * time.Hour).Truncate(time.Second)
+		// Clips come by view count: a page of popular recent clips, then an
+		// older clip with few views
+		var createdAt []time.Time
+		for i := 0; i < clipsPerPage; i++ {
+			createdAt = append(createdAt, time.Now().Truncate(time.Second).Add(-time.Duration(i+2)*time.Second))
+		}
+		createdAt = append(createdAt, stored.Add(time.Hour))
+		var requests int
+		cfg := &config.Config{Twitch: config.TwitchConfig{MaxClipPages: 1}}
+
+		store := run(t, cfg, archiveAPI(t, createdAt, &requests), stored)
+		if _, ok := store.clips[fmt.Sprintf("clip-%d", clipsPerPage)]; !ok || len(store.clips) != clipsPerPage+2 {
+			t.Errorf("Expected the older clip and every recent clip stored, got %d clips", len(store.clips))
+		}
+	})
+}
+
+func TestLookupStreamer(t *testing.T) {
+	var lookups int
+	api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups++
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("login") != "cool_user" && r.URL.Query().Get("id") != "1337" {
+			fmt.Fprint(w, `{"data": []}`)
+			return
+		}
+		fmt.Fprint(w, `{"data": [{"id": "1337", "login": "cool_user", "display_name": "Cool_User"}]}`)
+	})
+	store := newMemoryStore()
+	s := newTestService(t, &config.Config{}, api)
+	s.db = store
+
+	for i := 0; i < 3; i++ {
+		streamer, err := s.lookupStreamer(context.Background(), "cool_user")
+		if err != nil {
+			t.Fatalf("lookupStreamer failed: %v", err)
+		}
+		if streamer.BroadcasterID != "1337" || streamer.DisplayName != "Cool_User" {
+			t.Errorf("Unexpected streamer %+v", streamer)
+		}
+	}
+	if lookups != 1 {
+		t.Errorf("Expected one Twitch lookup within the TTL, got %d", lookups)
+	}
+
+	// Expired details are refreshed
+	store.streamers["cool_user"].RefreshedAt = time.Now().Add(-2 * defaultStreamerTTL)
+	if _, err := s.lookupStreamer(context.Background(), "cool_user"); err != nil {
+		t.Fatalf("lookupStreamer failed: %v", err)
+	}
+	if lookups != 2 {
+		t.Errorf("Expected expired details to be refreshed, got %d lookups", lookups)
+	}
+
+	if _, err := s.lookupStreamer(context.Background(), "nobody"); err != ErrStreamerNotFound {
+		t.Errorf("Expected ErrStreamerNotFound, got %v", err)
+	}
+}
+
+func TestLookupStreamerRenamedOnTwitch(t *testing.T) {
+	var login string
+	var queries []string
+	api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("id") != "1337" || login == "" {
+			fmt.Fprint(w, `{"data": []}`)
+			return
+		}
+		fmt.Fprintf(w, `{"data": [{"id": "1337", "login": %q}]}`, login)
+	})
+	store := newMemoryStore()
+	store.streamers["cool_user"] = &database.Streamer{
+		BroadcasterID: "1337",
+		Login:         "cool_user",
+		RefreshedAt:   time.Now().Add(-2 * defaultStreamerTTL),
+	}
+	s := newTestService(t, &config.Config{}, api)
+	s.db = store
+
+	// A broadcaster Twitch no longer returns keeps their details, which are
+	// not looked up again until they are stale
+	for i := 0; i < 2; i++ {
+		streamer, err := s.lookupStreamer(context.Background(), "cool_user")
+		if err != nil {
+			t.Fatalf("lookupStreamer failed: %v", err)
+		}
+		if streamer.BroadcasterID != "1337" {
+			t.Errorf("Unexpected streamer %+v", streamer)
+		}
+	}
+	if len(queries) != 1 || queries[0] != "id=1337" {
+		t.Errorf("Expected one lookup by broadcaster ID, got %v", queries)
+	}
+
+	// The rename is stored once the details are stale again
+	login = "cooler_user"
+	store.streamers["cool_user"].RefreshedAt = time.Now().Add(-2 * defaultStreamerTTL)
+	if _, err := s.lookupStreamer(context.Background(), "cool_user"); !errors.Is(err, ErrStreamerRenamed) {
+		t.Errorf("Expected ErrStreamerRenamed, got %v", err)
+	}
+	if _, ok := store.streamers["cool_user"]; ok {
+		t.Error("Expected the old login to be replaced")
+	}
+	if streamer := store.streamers["cooler_user"]; streamer == nil || streamer.BroadcasterID != "1337" {
+		t.Errorf("Expected the new login stored, got %+v", streamer)
+	}
+
+	// The configuration catching up finds the stored broadcaster
+	streamer, err := s.lookupStreamer(context.Background(), "cooler_user")
+	if err != nil || streamer.BroadcasterID != "1337" {
+		t.Errorf("Expected the renamed streamer, got %+v, %v", streamer, err)
+	}
+	if len(queries) != 2 {
+		t.Errorf("Expected no lookup of the fresh new login, got %v", queries)
+	}
+}
+
+func TestRefreshStatus(t *testing.T) {
+	live := true
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"data": [{"id": "1337", "login": "cool_user"}]}`)
+	})
+	mux.HandleFunc("/streams", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if !live {
+			fmt.Fprint(w, `{"data": []}`)
+			return
+		}
+		fmt.Fprint(w, `{"data": [{"id": "42", "user_id": "1337", "user_login": "Cool_User", "title": "speedruns",
+			"game_id": "7", "game_name": "Celeste", "started_at": "2024-01-01T10:00:00Z"}]}`)
+	})
+	store := newMemoryStore()
+	s := newTestService(t, &config.Config{}, mux)
+	s.db = store
+	s.scheduler.add("cool_user", time.Now())
+
+	s.refreshStatus(context.Background())
+	session := store.sessions["42"]
+	if session == nil || session.StreamerName != "cool_user" || session.GameName != "Celeste" || !session.EndedAt.IsZero() {
+		t.Fatalf("Expected an open session for the live stream, got %+v", session)
+	}
+	if !s.scheduler.entries["cool_user"].live {
+		t.Error("Expected the streamer to be scheduled as live")
+	}
+
+	clip := &helix.Clip{ID: "clip", CreatedAt: "2024-01-01T11:00:00Z"}
+	saved, err := s.storeClip("cool_user", clip, false)
+	if err != nil {
+		t.Fatalf("storeClip failed: %v", err)
+	}
+	if saved.StreamID != "42" {
+		t.Errorf("Expected the clip linked to stream 42, got %q", saved.StreamID)
+	}
+
+	live = false
+	s.refreshStatus(context.Background())
+	if session.EndedAt.IsZero() {
+		t.Error("Expected the session to end when the stream goes offline")
+	}
+}
+
+func TestManageStreamers(t *testing.T) {
+	api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("login") != "cool_user" {
+			fmt.Fprint(w, `{"data": []}`)
+			return
+		}
+		fmt.Fprint(w, `{"data": [{"id": "1337", "login": "cool_user"}]}`)
+	})
+	store := newMemoryStore()
+	cfg := &config.Config{Discord: config.DiscordConfig{Streamers: map[string]config.Destinations{"from_file": {{WebhookURL: "https://discord.com/api/webhooks/0/f"}}}}}
+	s := newTestService(t, cfg, api)
+	s.db = store
+	ctx := context.Background()
+	webhook := "https://discord.com/api/webhooks/1/a"
+
+	for _, invalid := range []string{"http://insecure.example", "https://attacker.example/api/webhooks/1/a", "https://discord.com/api/users/1"} {
+		if _, err := s.AddStreamer(ctx, "Cool_User", invalid); !errors.Is(err, ErrInvalidWebhookURL) {
+			t.Errorf("Expected ErrInvalidWebhookURL for %s, got %v", invalid, err)
+		}
+	}
+	if _, err := s.AddStreamer(ctx, "nobody", webhook); !errors.Is(err, ErrStreamerNotFound) {
+		t.Errorf("Expected ErrStreamerNotFound, got %v", err)
+	}
+	if _, err := s.AddStreamer(ctx, "from_file", webhook); !errors.Is(err, ErrStreamerExists) {
+		t.Errorf("Expected ErrStreamerExists, got %v", err)
+	}
+
+	added, err := s.AddStreamer(ctx, "Cool_User", webhook)
+	if err != nil {
+		t.Fatalf("AddStreamer failed: %v", err)
+	}
+	if added.Login != "cool_user" || added.Source != SourceAPI || !store.streamers["cool_user"].Monitored {
+		t.Errorf("Unexpected streamer %+v", added)
+	}
+	if got := strings.Join(s.scheduler.logins(), ","); got != "cool_user" {
+		t.Errorf("Expected the streamer to be scheduled, got %s", got)
+	}
+	if destinations, ok := s.destinations("cool_user"); !ok || len(destinations) != 1 || destinations[0].WebhookURL != webhook {
+		t.Errorf("Expected the webhook to be used, got %+v", destinations)
+	}
+
+	exfiltrate := "https://attacker.example/collect"
+	if _, err := s.UpdateStreamer("cool_user", StreamerUpdate{WebhookURL: &exfiltrate}); !errors.Is(err, ErrInvalidWebhookURL) {
+		t.Errorf("Expected ErrInvalidWebhookURL, got %v", err)
+	}
+	paused := true
+	if _, err := s.UpdateStreamer("cool_user", StreamerUpdate{Paused: &paused}); err != nil {
+		t.Fatalf("UpdateStreamer failed: %v", err)
+	}
+	if len(s.scheduler.logins()) != 0 {
+		t.Error("Expected a paused streamer to be unscheduled")
+	}
+	if _, ok := s.destinations("cool_user"); ok {
+		t.Error("Expected no notifications for a paused streamer")
+	}
+	if _, err := s.UpdateStreamer("from_file", StreamerUpdate{Paused: &paused}); !errors.Is(err, ErrConfigStreamer) {
+		t.Errorf("Expected ErrConfigStreamer, got %v", err)
+	}
+
+	// A restart picks up the streamers added through the API
+	restarted := newTestService(t, cfg, api)
+	restarted.db = store
+	if err := restarted.LoadStreamers(); err != nil {
+		t.Fatalf("LoadStreamers failed: %v", err)
+	}
+	if streamers := restarted.Streamers(); len(streamers) != 2 || !streamers[0].Paused || streamers[1].Source != SourceConfig {
+		t.Errorf("Unexpected streamers after restart: %+v", streamers)
+	}
+
+	if err := s.RemoveStreamer("cool_user"); err != nil {
+		t.Fatalf("RemoveStreamer failed: %v", err)
+	}
+	if err := s.RemoveStreamer("cool_user"); !errors.Is(err, ErrStreamerNotMonitored) {
+		t.Errorf("Expected ErrStreamerNotMonitored, got %v", err)
+	}
+	if store.streamers["cool_user"].Monitored {
+		t.Error("Expected the streamer to be stored as not monitored")
+	}
+}
+
+func TestReload(t *testing.T) {
+	cfg := &config.Config{
+		Twitch: config.TwitchConfig{ClientID: "id", CheckIntervalSecs: 60},
+		Discord: config.DiscordConfig{Streamers: map[string]config.Destinations{
+			"a": {{WebhookURL: "https://discord.com/api/webhooks/1/a"}},
+			"b": {{WebhookURL: "https://discord.com/api/webhooks/1/b"}},
+		}},
+	}
+	s := newTestService(t, cfg, http.NotFoundHandler())
+	for _, login := range s.monitoredLogins() {
+		s.scheduler.add(login, time.Now())
+	}
+	kept := s.discord.Client("https://discord.com/api/webhooks/1/a")
+	s.discord.Client("https://discord.com/api/webhooks/1/b")
+
+	next := &config.Config{
+		Twitch: config.TwitchConfig{ClientID: "other", CheckIntervalSecs: 30, OfflineIntervalSecs: 600},
+		Discord: config.DiscordConfig{Streamers: map[string]config.Destinations{
+			"b": {{WebhookURL: "https://discord.com/api/webhooks/2/b"}},
+			"c": {{WebhookURL: "https://discord.com/api/webhooks/1/c"}},
+		}, Template: msgtemplate.Spec{Content: "Reloaded {{.StreamerName}}"}},
+	}
+	if err := s.Reload(next); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	if got := strings.Join(s.scheduler.logins(), ","); got != "b,c" {
+		t.Errorf("Expected streamers b and c scheduled, got %s", got)
+	}
+	if destinations, _ := s.destinations("b"); len(destinations) != 1 || destinations[0].WebhookURL != "https://discord.com/api/webhooks/2/b" {
+		t.Errorf("Expected the new webhook for b, got %+v", destinations)
+	}
+	if live, offline := s.scheduler.intervals(); live != 30*time.Second || offline != 10*time.Minute {
+		t.Errorf("Expected the new intervals, got %v and %v", live, offline)
+	}
+	if s.discord.Len() != 0 || s.discord.Client("https://discord.com/api/webhooks/1/a") == kept {
+		t.Errorf("Expected the Discord clients dropped, got %d", s.discord.Len())
+	}
+	if s.cfg().Twitch.ClientID != "id" {
+		t.Errorf("Expected the client ID to wait for a restart, got %q", s.cfg().Twitch.ClientID)
+	}
+	destination, _ := s.destinations("b")
+	if msg, err := s.message(&database.Clip{StreamerName: "b"}, destination[0]); err != nil || msg.Content != "Reloaded b" {
+		t.Errorf("Expected the reloaded template, got %+v (err: %v)", msg, err)
+	}
+
+	invalid := &config.Config{Twitch: config.TwitchConfig{CheckIntervalSecs: -1}}
+	if err := s.Reload(invalid); err == nil {
+		t.Error("Expected an invalid configuration to be rejected")
+	}
+	if got := strings.Join(s.scheduler.logins(), ","); got != "b,c" || s.cfg().Twitch.CheckIntervalSecs != 30 {
+		t.Errorf("Expected the rejected configuration to change nothing, got %s", got)
+	}
+}
+
+func TestDeliverDue(t *testing.T) {
+	// The Discord stand-in answers with the queued statuses, then 204
+	var statuses []int
+	var posts int
+	var lastMessage discord.Message
+	discordAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts++
+		json.NewDecoder(r.Body).Decode(&lastMessage)
+		status := http.StatusNoContent
+		if len(statuses) > 0 {
+			status, statuses = statuses[0], statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(discordAPI.Close)
+
+	cfg := &config.Config{Discord: config.DiscordConfig{
+		Streamers:           map[string]config.Destinations{"cool_user": {{WebhookURL: discordAPI.URL + "/api/webhooks/1/token"}}},
+		MaxDeliveryAttempts: 2,
+		Templates: map[string]msgtemplate.Spec{
+			"cool_user": {Content: "New clip by {{.StreamerName}}"},
+		},
+	}}
+	store := newMemoryStore()
+	s := newTestService(t, cfg, http.NotFoundHandler())
+	s.db = store
+
+	queue := func(id string) *database.Notification {
+		t.Helper()
+		if _, err := s.storeClip("cool_user", &helix.Clip{ID: id, CreatedAt: "2024-01-01T11:00:00Z"}, true); err != nil {
+			t.Fatalf("storeClip failed: %v", err)
+		}
+		return store.notifications[store.notificationID]
+	}
+	deliver := func(want int) {
+		t.Helper()
+		delivered, err := s.DeliverDue(context.Background())
+		if err != nil {
+			t.Fatalf("DeliverDue failed: %v", err)
+		}
+		if delivered != want {
+			t.Errorf("Expected %d notification(s) delivered, got %d", want, delivered)
+		}
+	}
+
+	t.Run("delivers and removes", func(t *testing.T) {
+		notification := queue("delivered")
+		deliver(1)
+		if _, ok := store.notifications[notification.ID]; ok || posts != 1 {
+			t.Errorf("Expected the notification posted once and removed, got %d posts", posts)
+		}
+		// Rendered with the streamer's template on top of the default message
+		if lastMessage.Content != "New clip by cool_user" || len(lastMessage.Embeds) != 1 || lastMessage.Embeds[0].Description != "New clip from cool_user!" {
+			t.Errorf("Expected the streamer's template applied, got %+v", lastMessage)
+		}
+	})
+
+	t.Run("backs off then gives up", func(t *testing.T) {
+		statuses = []int{http.StatusInternalServerError, http.StatusBadGateway}
+		id := queue("flaky").ID
+		before := time.Now()
+		deliver(0)
+
+		notification := store.notifications[id]
+		wait := notification.NextAttemptAt.Sub(before)
+		if notification.Status != database.NotificationPending || notification.Attempts != 1 ||
+			wait < outboxBaseBackoff || wait > outboxBaseBackoff*3/2+time.Second {
+			t.Fatalf("Expected a retry in 30 to 45 seconds, got %+v", notification)
+		}
+
+		// Not due yet
+		deliver(0)
+		notification.NextAttemptAt = time.Now()
+		deliver(0)
+		if notification := store.notifications[id]; notification.Status != database.NotificationDead || notification.Attempts != 2 || notification.LastError == "" {
+			t.Errorf("Expected a dead letter after 2 attempts, got %+v", notification)
+		}
+	})
+
+	t.Run("gives up on rejected messages", func(t *testing.T) {
+		statuses = []int{http.StatusNotFound}
+		id := queue("rejected").ID
+		deliver(0)
+		if notification := store.notifications[id]; notification.Status != database.NotificationDead || notification.Attempts != 1 {
+			t.Errorf("Expected a dead letter after the first attempt, got %+v", notification)
+		}
+	})
+
+	t.Run("one-off delivery keeps to its streamer", func(t *testing.T) {
+		other := &database.Clip{ID: "other", StreamerName: "other_user"}
+		if err := store.SaveClipAndNotify(other, []*database.Notification{{WebhookURL: discordAPI.URL + "/api/webhooks/2/token", NextAttemptAt: time.Now()}}); err != nil {
+			t.Fatalf("SaveClipAndNotify failed: %v", err)
+		}
+		otherID := store.notificationID
+		id := queue("polled").ID
+
+		if err := s.deliverAll(context.Background(), "cool_user"); err != nil {
+			t.Fatalf("deliverAll failed: %v", err)
+		}
+		if _, ok := store.notifications[id]; ok {
+			t.Error("Expected the streamer's notification delivered")
+		}
+		if _, ok := store.notifications[otherID]; !ok {
+			t.Error("Expected another streamer's notification left to the server")
+		}
+	})
+}
+
+func TestRouting(t *testing.T) {
+	// The Twitch stand-in serves the current view counts of clips by ID
+	views := make(map[string]int)
+	api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var clips []string
+		for _, id := range r.URL.Query()["id"] {
+			clips = append(clips, fmt.Sprintf(`{"id": %q, "view_count": %d}`, id, views[id]))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"data": [%s]}`, strings.Join(clips, ","))
+	})
+	posts := make(map[string][]string)
+	discordAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg discord.Message
+		json.NewDecoder(r.Body).Decode(&msg)
+		posts[r.URL.Path] = append(posts[r.URL.Path], msg.Content)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(discordAPI.Close)
+
+	allClips, bestClips := discordAPI.URL+"/api/webhooks/1/all", discordAPI.URL+"/api/webhooks/2/best"
+	cfg := &config.Config{Discord: config.DiscordConfig{
+		Streamers: map[string]config.Destinations{"cool_user": {
+			{Name: "all-clips", WebhookURL: allClips},
+			{
+				Name:       "best-clips",
+				WebhookURL: bestClips,
+				MinViews:   100,
+				Games:      []string{"33214"},
+				Keywords:   []string{"clutch"},
+				Languages:  []string{"en"},
+				Template:   msgtemplate.Spec{Content: "Best of {{.StreamerName}}"},
+			},
+		}},
+		Template: msgtemplate.Spec{Content: "New clip by {{.StreamerName}}"},
+	}}
+	store := newMemoryStore()
+	s := newTestService(t, cfg, api)
+	s.db = store
+
+	queue := func(id, title string, age time.Duration) []*database.Notification {
+		t.Helper()
+		before := store.notificationID
+		clip := &helix.Clip{ID: id, Title: title, GameID: "33214", Language: "en", ViewCount: 5,
+			CreatedAt: time.Now().Add(-age).UTC().Format(time.RFC3339)}
+		if _, err := s.storeClip("cool_user", clip, true); err != nil {
+			t.Fatalf("storeClip failed: %v", err)
+		}
+		var queued []*database.Notification
+		for id := before + 1; id <= store.notificationID; id++ {
+			queued = append(queued, store.notifications[id])
+		}
+		return queued
+	}
+	deliver := func(want int) {
+		t.Helper()
+		if delivered, err := s.DeliverDue(context.Background()); err != nil || delivered != want {
+			t.Errorf("Expected %d notification(s) delivered, got %d (err: %v)", want, delivered, err)
+		}
+	}
+
+	if queued := queue("plain", "Just chatting", time.Minute); len(queued) != 1 || queued[0].WebhookURL != allClips {
+		t.Errorf("Expected a clip without the keyword to go to all-clips only, got %+v", queued)
+	}
+	if queued := queue("stale", "Clutch from yesterday", 2*viewHoldWindow); len(queued) != 1 {
+		t.Errorf("Expected an old clip below the minimum views not to be held, got %d notifications", len(queued))
+	}
+
+	queued := queue("clutch", "CLUTCH round", time.Minute)
+	if len(queued) != 2 {
+		t.Fatalf("Expected the clip queued for both destinations, got %d", len(queued))
+	}
+	held := queued[1]
+	if held.WebhookURL != bestClips || held.MinViews != 100 || time.Until(held.NextAttemptAt) < viewRecheckInterval-time.Minute {
+		t.Fatalf("Expected the best-clips notification held for its views, got %+v", held)
+	}
+
+	deliver(3)
+	if len(posts["/api/webhooks/1/all"]) != 3 || len(posts["/api/webhooks/2/best"]) != 0 {
+		t.Fatalf("Expected every clip posted to all-clips only, got %v", posts)
+	}
+
+	// Still short of the minimum views: checked again later without using an attempt
+	views["clutch"] = 50
+	held.NextAttemptAt = time.Now()
+	deliver(0)
+	if held = store.notifications[held.ID]; held == nil || held.Attempts != 0 || time.Until(held.NextAttemptAt) < viewRecheckInterval-time.Minute {
+		t.Fatalf("Expected the notification held again, got %+v", held)
+	}
+
+	views["clutch"] = 150
+	held.NextAttemptAt = time.Now()
+	deliver(1)
+	if best := posts["/api/webhooks/2/best"]; len(best) != 1 || best[0] != "Best of cool_user" {
+		t.Errorf("Expected the clip posted with the destination's template, got %v", best)
+	}
+	if all := posts["/api/webhooks/1/all"]; all[0] != "New clip by cool_user" {
+		t.Errorf("Expected all-clips to use the global template, got %v", all)
+	}
+	if store.clips["clutch"].ViewCount != 150 {
+		t.Errorf("Expected the refreshed view count stored, got %d", store.clips["clutch"].ViewCount)
+	}
+
+	// Clips that never reach the minimum views are dropped after the hold window
+	held = queue("slow", "Clutch but quiet", time.Minute)[1]
+	store.clips["slow"].CreatedAt = time.Now().Add(-viewHoldWindow)
+	held.NextAttemptAt = time.Now()
+	deliver(1)
+	if _, ok := store.notifications[held.ID]; ok || len(posts["/api/webhooks/2/best"]) != 1 {
+		t.Errorf("Expected the held notification dropped, got %v", posts)
+	}
+
+	if _, err := s.PreviewMessage("cool_user", "best-clips"); err != nil {
+		t.Errorf("Expected a preview for best-clips, got %v", err)
+	}
+	if msg, err := s.PreviewMessage("cool_user", "2"); err != nil || msg.Content != "Best of cool_user" {
+		t.Errorf("Expected destinations to be selected by number, got %+v (err: %v)", msg, err)
+	}
+	if _, err := s.PreviewMessage("cool_user", "missing"); !errors.Is(err, ErrDestinationNotFound) {
+		t.Errorf("Expected ErrDestinationNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"twitchclipsearch/internal/database"
+	"twitchclipsearch/internal/logger"
+	"twitchclipsearch/internal/metrics"
+
+	"github.com/nicklaw5/helix/v2"
+)
+
+// defaultStreamerTTL is how long resolved streamer details are trusted
+const defaultStreamerTTL = 24 * time.Hour
+
+// ErrStreamerNotFound is returned for logins Twitch does not know
+var ErrStreamerNotFound = errors.New("streamer not found on Twitch")
+
+// ErrStreamerRenamed is returned for a login whose broadcaster has moved to
+// another login on Twitch
+var ErrStreamerRenamed = errors.New("streamer renamed on Twitch")
+
+// lookupStreamer resolves a login to its broadcaster, using the streamers
+// table while the stored details are fresh. Stale details are refreshed by
+// broadcaster ID, so a rename on Twitch is stored and moves the broadcaster's
+// clips to the new login; the old login then fails with ErrStreamerRenamed
+// until the configuration catches up. Refreshing a login that now belongs to
+// a broadcaster stored under another name moves their clips the same way.
+func (s *ClipService) lookupStreamer(ctx context.Context, login string) (*database.Streamer, error) {
+	cached, err := s.db.GetStreamer(login)
+	if err != nil {
+		metrics.RecordError("database_error")
+		return nil, err
+	}
+
+	if cached != nil && s.isFresh(cached) {
+		return cached, nil
+	}
+
+	params := &helix.UsersParams{Logins: []string{login}}
+	if cached != nil {
+		params = &helix.UsersParams{IDs: []string{cached.BroadcasterID}}
+	}
+	users, err := s.getUsers(ctx, params)
+	if err != nil {
+		if cached != nil {
+			// Stale details beat skipping the check
+			logger.Warn("Failed to refresh streamer, using stored details", "error", err, "streamer", login)
+			return cached, nil
+		}
+		return nil, err
+	}
+
+	if len(users) == 0 {
+		if cached != nil {
+			// The broadcaster is banned or deleted; keep polling them, but
+			// only look them up again once the details are stale
+			logger.Warn("Streamer no longer exists on Twitch, using stored details", "streamer", login,
+				"broadcaster_id", cached.BroadcasterID)
+			if touched, err := s.touchStreamer(cached); err == nil {
+				return touched, nil
+			}
+			return cached, nil
+		}
+		return nil, ErrStreamerNotFound
+	}
+
+	streamer, err := s.saveUser(users[0])
+	if err != nil {
+		return nil, err
+	}
+	if streamer.Login != login {
+		logger.Warn("Streamer renamed on Twitch, update the configuration", "streamer", login, "login", streamer.Login)
+		return nil, fmt.Errorf("%w: %s is now %s", ErrStreamerRenamed, login, streamer.Login)
+	}
+	return streamer, nil
+}
+
+// refreshStreamers resolves the logins whose stored details are missing or
+// stale, 100 per request, so that the checks that follow need no lookup.
+// Stored streamers are refreshed by broadcaster ID to pick up renames.
+func (s *ClipService) refreshStreamers(ctx context.Context, logins []string) {
+	var missing, staleIDs []string
+	stale := make(map[string]*database.Streamer)
+	for _, login := range logins {
+		cached, err := s.db.GetStreamer(login)
+		if err != nil {
+			metrics.RecordError("database_error")
+			continue
+		}
+		switch {
+		case cached == nil:
+			missing = append(missing, login)
+		case !s.isFresh(cached):
+			stale[cached.BroadcasterID] = cached
+			staleIDs = append(staleIDs, cached.BroadcasterID)
+		}
+	}
+
+	for _, batch := range batches(missing, helixBatchSize) {
+		s.refreshBatch(ctx, &helix.UsersParams{Logins: batch}, nil)
+	}
+	for _, batch := range batches(staleIDs, helixBatchSize) {
+		s.refreshBatch(ctx, &helix.UsersParams{IDs: batch}, stale)
+	}
+}
+
+// refreshBatch looks up one batch of users and stores them. Stored streamers
+// that Twitch no longer returns keep their details, which count as fresh
+// again.
+func (s *ClipService) refreshBatch(ctx context.Context, params *helix.UsersParams, stored map[string]*database.Streamer) {
+	users, err := s.getUsers(ctx, params)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Error("Failed to refresh streamers", "error", err, "streamers", len(params.Logins)+len(params.IDs))
+		}
+		return
+	}
+
+	found := make(map[string]bool, len(users))
+	for _, user := range users {
+		found[user.ID] = true
+		streamer, err := s.saveUser(user)
+		if err != nil {
+			logger.Error("Failed to save streamer", "error", err, "streamer", user.Login)
+			continue
+		}
+		if cached, ok := stored[user.ID]; ok && cached.Login != streamer.Login {
+			logger.Warn("Streamer renamed on Twitch, update the configuration", "streamer", cached.Login, "login", streamer.Login)
+		}
+	}
+	for _, id := range params.IDs {
+		if cached := stored[id]; cached != nil && !found[id] {
+			if _, err := s.touchStreamer(cached); err != nil {
+				logger.Error("Failed to save streamer", "error", err, "streamer", cached.Login)
+			}
+		}
+	}
+}
+
+// isFresh reports whether stored streamer details are recent enough to use
+func (s *ClipService) isFresh(streamer *database.Streamer) bool {
+	ttl := time.Duration(s.cfg().Twitch.StreamerTTLSecs) * time.Second
+	if ttl <= 0 {
+		ttl = defaultStreamerTTL
+	}
+	return time.Since(streamer.RefreshedAt) < ttl
+}
+
+// getUsers looks up Twitch users by login or broadcaster ID
+func (s *ClipService) getUsers(ctx context.Context, params *helix.UsersParams) ([]helix.User, error) {
+	if err := s.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.twitch.GetUsers(params)
+	if err == nil && resp.StatusCode >= 300 {
+		err = fmt.Errorf("get users failed with status %d: %s", resp.StatusCode, resp.ErrorMessage)
+	}
+	if err != nil {
+		metrics.RecordError("twitch_api_error")
+		return nil, err
+	}
+
+	return resp.Data.Users, nil
+}
+
+// saveUser stores a Twitch user's details, following renames
+func (s *ClipService) saveUser(user helix.User) (*database.Streamer, error) {
+	streamer := &database.Streamer{
+		BroadcasterID:   user.ID,
+		Login:           user.Login,
+		DisplayName:     user.DisplayName,
+		ProfileImageURL: user.ProfileImageURL,
+		RefreshedAt:     time.Now(),
+	}
+
+	previousLogin, err := s.db.SaveStreamer(streamer)
+	if err != nil {
+		metrics.RecordError("database_error")
+		return nil, err
+	}
+	if previousLogin != "" {
+		logger.Info("Streamer renamed, moved their clips", "from", previousLogin, "to", streamer.Login, "broadcaster_id", streamer.BroadcasterID)
+	}
+
+	return streamer, nil
+}
+
+// touchStreamer marks stored streamer details as refreshed without changing
+// them, so that they are not looked up again until they are stale
+func (s *ClipService) touchStreamer(cached *database.Streamer) (*database.Streamer, error) {
+	touched := *cached
+	touched.RefreshedAt = time.Now()
+	if _, err := s.db.SaveStreamer(&touched); err != nil {
+		metrics.RecordError("database_error")
+		return nil, err
+	}
+	return &touched, nil
+}
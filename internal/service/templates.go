@@ -0,0 +1,76 @@
+package service
+
+import (
+	"reflect"
+
+	"twitchclipsearch/internal/config"
+	"twitchclipsearch/internal/discord/msgtemplate"
+)
+
+// parsedTemplate is a parsed message template, or why it did not parse
+type parsedTemplate struct {
+	tmpl *msgtemplate.Template
+	err  error
+}
+
+// destinationKey identifies a destination by its streamer and webhook
+type destinationKey struct {
+	login      string
+	webhookURL string
+}
+
+// messageTemplates are the message templates of a configuration, parsed once
+// when it is loaded rather than for every message
+type messageTemplates struct {
+	// global applies to streamers without a template of their own
+	global parsedTemplate
+	// streamers holds the templates of the streamers that have their own
+	streamers map[string]parsedTemplate
+	// destinations holds the template of every configured destination
+	destinations map[destinationKey]parsedTemplate
+}
+
+// newMessageTemplates parses the message templates of a configuration
+func newMessageTemplates(cfg *config.Config) *messageTemplates {
+	parse := func(spec msgtemplate.Spec) parsedTemplate {
+		tmpl, err := msgtemplate.Parse(spec)
+		return parsedTemplate{tmpl: tmpl, err: err}
+	}
+
+	d := cfg.Discord
+	templates := &messageTemplates{
+		global:       parse(d.MessageTemplate("", config.Destination{})),
+		streamers:    make(map[string]parsedTemplate, len(d.Templates)),
+		destinations: make(map[destinationKey]parsedTemplate),
+	}
+	for login := range d.Templates {
+		templates.streamers[login] = parse(d.MessageTemplate(login, config.Destination{}))
+	}
+	for login, destinations := range d.Streamers {
+		for _, destination := range destinations {
+			key := destinationKey{login: login, webhookURL: destination.WebhookURL}
+			// Notifications find their destination by webhook, the first wins
+			if _, ok := templates.destinations[key]; !ok {
+				templates.destinations[key] = parse(d.MessageTemplate(login, destination))
+			}
+		}
+	}
+	return templates
+}
+
+// lookup returns the template of one of a streamer's destinations. Only a
+// destination with a template that is not in the configuration, such as one
+// being previewed, is parsed on the spot.
+func (t *messageTemplates) lookup(cfg *config.Config, login string, destination config.Destination) (*msgtemplate.Template, error) {
+	parsed, ok := t.destinations[destinationKey{login: login, webhookURL: destination.WebhookURL}]
+	if !ok && !reflect.DeepEqual(destination.Template, msgtemplate.Spec{}) {
+		return msgtemplate.Parse(cfg.Discord.MessageTemplate(login, destination))
+	}
+	if !ok {
+		parsed, ok = t.streamers[login]
+	}
+	if !ok {
+		parsed = t.global
+	}
+	return parsed.tmpl, parsed.err
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"fmt"
 	"sync"
 	"sync/atomic"
 
@@ -67,7 +68,7 @@ func (p *WorkerPool) Start() {
 	p.shutdown = make(chan struct{})
 
 	// Update worker pool metrics
-	metrics.RecordGauge("worker_pool_size", float64(p.workers), "pool", "default")
+	metrics.RecordWorkerPoolSize("default", float64(p.workers))
 
 	for i := 0; i < p.workers; i++ {
 		p.wg.Add(1)
@@ -109,32 +110,55 @@ func (p *WorkerPool) worker() {
 	for {
 		select {
 		case <-p.shutdown:
+			p.drain()
 			return
 		case task, ok := <-p.tasks:
 			if !ok {
 				return
 			}
-			func() {
-				defer func() {
-					if r := recover(); r != nil {
-						if err, ok := r.(error); ok {
-							logger.Error("Worker panic recovered", "error", err)
-							metrics.RecordError("worker_panic")
-							p.errorHandler(err)
-						}
-					}
-				}()
-				// Update worker utilization metric
-				metrics.RecordWorkerUtilization("default", 1.0)
-				task()
-				metrics.RecordWorkerUtilization("default", 0.0)
-			}()
-			// Update queue size metric after task completion
-			metrics.RecordQueueSize("default", float64(len(p.tasks)))
+			p.run(task)
 		}
 	}
 }
 
+// drain runs the tasks still queued when the pool is stopped
+func (p *WorkerPool) drain() {
+	for {
+		select {
+		case task, ok := <-p.tasks:
+			if !ok {
+				return
+			}
+			p.run(task)
+		default:
+			return
+		}
+	}
+}
+
+func (p *WorkerPool) run(task Task) {
+	defer func() {
+		if r := recover(); r != nil {
+			err, ok := r.(error)
+			if !ok {
+				err = fmt.Errorf("panic: %v", r)
+			}
+			logger.Error("Worker panic recovered", "error", err)
+			metrics.RecordError("worker_panic")
+			p.errorHandler(err)
+		}
+	}()
+
+	// Update worker utilization metric
+	metrics.RecordWorkerUtilization("default", 1.0)
+	defer metrics.RecordWorkerUtilization("default", 0.0)
+
+	task()
+
+	// Update queue size metric after task completion
+	metrics.RecordQueueSize("default", float64(len(p.tasks)))
+}
+
 func (p *WorkerPool) Size() int {
 	return p.workers
 }
@@ -0,0 +1,178 @@
+package twitch
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"twitchclipsearch/internal/logger"
+	"twitchclipsearch/internal/metrics"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// defaultBucketSize is the app access token bucket Twitch grants per minute
+	defaultBucketSize = 800
+	// refillWindow is how long Twitch takes to refill an empty bucket
+	refillWindow = time.Minute
+	// reserveFraction of the bucket is kept back for bursts such as retries
+	reserveFraction = 0.1
+	// limiterBurst is how many requests may start at once
+	limiterBurst = 10
+	// maxRateLimitRetries bounds how often one request is retried after 429
+	maxRateLimitRetries = 3
+)
+
+// Doer sends HTTP requests. *http.Client, TokenManager and RateLimiter
+// implement it, and it matches helix.HTTPClient.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// RateLimiter paces Helix requests by the points bucket Twitch reports in the
+// Ratelimit-Limit, Ratelimit-Remaining and Ratelimit-Reset response headers.
+// Callers take a slot with Wait before each request; Do sends the request,
+// adjusts the rate from the response and retries after the reset on 429.
+type RateLimiter struct {
+	next    Doer
+	limiter *rate.Limiter
+	now     func() time.Time
+
+	mu          sync.Mutex
+	pausedUntil time.Time
+}
+
+// NewRateLimiter creates a limiter sending requests through next. Until the
+// first response arrives it assumes a full default bucket.
+func NewRateLimiter(next Doer) *RateLimiter {
+	return &RateLimiter{
+		next:    next,
+		limiter: rate.NewLimiter(refillRate(defaultBucketSize), limiterBurst),
+		now:     time.Now,
+	}
+}
+
+// refillRate is the request rate a bucket of the given size sustains forever
+func refillRate(limit int) rate.Limit {
+	return rate.Limit(float64(limit) / refillWindow.Seconds())
+}
+
+// Wait blocks until a request may be sent or ctx is done
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	pause := l.pausedUntil.Sub(l.now())
+	l.mu.Unlock()
+
+	if pause > 0 {
+		timer := time.NewTimer(pause)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	return l.limiter.Wait(ctx)
+}
+
+// Limit returns the current request rate in requests per second
+func (l *RateLimiter) Limit() float64 {
+	return float64(l.limiter.Limit())
+}
+
+// Do sends a request and adapts the rate to the response. Requests rejected
+// with 429 Too Many Requests are retried once the bucket has been refilled.
+func (l *RateLimiter) Do(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := l.next.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		l.Observe(resp)
+		if resp.StatusCode != http.StatusTooManyRequests || attempt == maxRateLimitRetries {
+			return resp, nil
+		}
+		// Requests whose body cannot be replayed are not retried
+		if req.Body != nil && req.GetBody == nil {
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		metrics.RecordRetryAttempt("twitch")
+		if err := l.Wait(req.Context()); err != nil {
+			return nil, err
+		}
+
+		retry := req.Clone(req.Context())
+		if req.GetBody != nil {
+			if retry.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		req = retry
+	}
+}
+
+// Observe updates the rate from the Ratelimit-* headers of a response. The
+// surplus above a small reserve is spread until the bucket resets on top of
+// the refill rate; below the reserve the rate drops towards zero, and an
+// empty bucket or a 429 pauses all requests until the reset.
+func (l *RateLimiter) Observe(resp *http.Response) {
+	now := l.now()
+	limit, limitErr := strconv.Atoi(resp.Header.Get("Ratelimit-Limit"))
+	remaining, remainingErr := strconv.Atoi(resp.Header.Get("Ratelimit-Remaining"))
+	resetUnix, resetErr := strconv.ParseInt(resp.Header.Get("Ratelimit-Reset"), 10, 64)
+
+	reset := now.Add(time.Second)
+	if resetErr == nil {
+		reset = time.Unix(resetUnix, 0)
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		metrics.RecordRateLimitHit("twitch")
+		metrics.RecordRateLimitRemaining("twitch", 0)
+		logger.Warn("Twitch rate limit exceeded, pausing requests", "until", reset)
+
+		l.pauseUntil(reset)
+		return
+	}
+
+	if limitErr != nil || remainingErr != nil || limit <= 0 {
+		return
+	}
+	metrics.RecordRateLimitRemaining("twitch", float64(remaining))
+
+	untilReset := reset.Sub(now)
+	if untilReset < time.Second {
+		untilReset = time.Second
+	}
+
+	reserve := int(float64(limit) * reserveFraction)
+	newRate := refillRate(limit)
+	switch {
+	case remaining == 0:
+		// Spent: nothing can be sent before the reset
+		l.pauseUntil(reset)
+	case remaining > reserve:
+		newRate += rate.Limit(float64(remaining-reserve) / untilReset.Seconds())
+	default:
+		newRate = newRate * rate.Limit(remaining) / rate.Limit(reserve+1)
+	}
+
+	l.limiter.SetLimitAt(now, newRate)
+}
+
+// pauseUntil holds back all requests until t
+func (l *RateLimiter) pauseUntil(t time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if t.After(l.pausedUntil) {
+		l.pausedUntil = t
+	}
+}
@@ -0,0 +1,102 @@
+package twitch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// bucketResponse returns a response carrying Twitch rate limit headers
+func bucketResponse(status, limit, remaining int, reset time.Time) *http.Response {
+	header := http.Header{}
+	header.Set("Ratelimit-Limit", strconv.Itoa(limit))
+	header.Set("Ratelimit-Remaining", strconv.Itoa(remaining))
+	header.Set("Ratelimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+	return &http.Response{StatusCode: status, Header: header}
+}
+
+func TestRateLimiterObserve(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := NewRateLimiter(http.DefaultClient)
+	l.now = func() time.Time { return now }
+	refill := float64(refillRate(800))
+
+	l.Observe(bucketResponse(http.StatusOK, 800, 720, now.Add(6*time.Second)))
+	if got := l.Limit(); got <= refill {
+		t.Errorf("Expected a full bucket to allow more than the refill rate %.2f/s, got %.2f/s", refill, got)
+	}
+
+	l.Observe(bucketResponse(http.StatusOK, 800, 40, now.Add(57*time.Second)))
+	if got := l.Limit(); got >= refill || got <= 0 {
+		t.Errorf("Expected a nearly empty bucket to slow below the refill rate %.2f/s, got %.2f/s", refill, got)
+	}
+
+	// Responses without headers leave the rate alone
+	before := l.Limit()
+	l.Observe(&http.Response{StatusCode: http.StatusOK, Header: http.Header{}})
+	if got := l.Limit(); got != before {
+		t.Errorf("Expected rate %.2f/s to be unchanged, got %.2f/s", before, got)
+	}
+
+	l.Observe(bucketResponse(http.StatusTooManyRequests, 800, 0, now.Add(30*time.Second)))
+	if !l.pausedUntil.Equal(now.Add(30 * time.Second)) {
+		t.Errorf("Expected requests to pause until the reset, paused until %v", l.pausedUntil)
+	}
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	l := NewRateLimiter(http.DefaultClient)
+	l.pauseUntil(time.Now().Add(100 * time.Millisecond))
+
+	start := time.Now()
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("Expected Wait to block while paused, returned after %v", elapsed)
+	}
+
+	l.pauseUntil(time.Now().Add(time.Hour))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); err == nil {
+		t.Error("Expected Wait to give up when the context ends")
+	}
+}
+
+func TestRateLimiterRetries429(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Ratelimit-Limit", "800")
+		// The bucket is already full again by the time the client retries
+		w.Header().Set("Ratelimit-Reset", strconv.FormatInt(time.Now().Unix(), 10))
+		if requests.Add(1) == 1 {
+			w.Header().Set("Ratelimit-Remaining", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Ratelimit-Remaining", "799")
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	l := NewRateLimiter(http.DefaultClient)
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/helix/clips", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := l.Do(req)
+	if err != nil {
+		t.Fatalf("Do failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || requests.Load() != 2 {
+		t.Errorf("Expected a successful retry, got status %d after %d requests", resp.StatusCode, requests.Load())
+	}
+}
@@ -0,0 +1,243 @@
+// Package twitch handles authentication and rate limiting for the Twitch Helix API
+package twitch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"twitchclipsearch/internal/logger"
+	"twitchclipsearch/internal/metrics"
+)
+
+const (
+	// DefaultTokenURL is the Twitch OAuth token endpoint
+	DefaultTokenURL = "https://id.twitch.tv/oauth2/token"
+	// refreshMargin is how long before expiry a token is renewed
+	refreshMargin = 5 * time.Minute
+	// retryDelay is how long Run waits after a failed renewal
+	retryDelay = 30 * time.Second
+)
+
+// TokenManager obtains app access tokens with the client credentials grant
+// and renews them before they expire. It implements helix.HTTPClient so that
+// every Helix request carries a valid token, renewing it and retrying once
+// when Twitch rejects it with 401 Unauthorized.
+type TokenManager struct {
+	clientID     string
+	clientSecret string
+	tokenURL     string
+	httpClient   *http.Client
+	now          func() time.Time
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// TokenOption configures a TokenManager
+type TokenOption func(*TokenManager)
+
+// WithTokenURL sets the OAuth token endpoint, e.g. a local stand-in for tests
+func WithTokenURL(tokenURL string) TokenOption {
+	return func(m *TokenManager) {
+		m.tokenURL = tokenURL
+	}
+}
+
+// WithHTTPClient sets the client used for token and API requests
+func WithHTTPClient(client *http.Client) TokenOption {
+	return func(m *TokenManager) {
+		m.httpClient = client
+	}
+}
+
+// NewTokenManager creates a token manager for the application credentials.
+// No token is requested until one is needed or Run is called.
+func NewTokenManager(clientID, clientSecret string, opts ...TokenOption) *TokenManager {
+	m := &TokenManager{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		tokenURL:     DefaultTokenURL,
+		httpClient:   &http.Client{Timeout: 30 * time.Second},
+		now:          time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// tokenResponse is the body of a successful token request
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+	TokenType   string `json:"token_type"`
+}
+
+// Token returns a valid app access token, requesting a new one if there is
+// none or the current one is about to expire
+func (m *TokenManager) Token(ctx context.Context) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.token != "" && m.now().Before(m.expiresAt.Add(-refreshMargin)) {
+		return m.token, nil
+	}
+
+	token, expiresAt, err := m.requestToken(ctx)
+	metrics.RecordTokenRefresh(err == nil)
+	if err != nil {
+		// An expired token is useless, but one inside the margin still works
+		if m.token != "" && m.now().Before(m.expiresAt) {
+			logger.Warn("Failed to renew Twitch app access token, using current one", "error", err, "expires_at", m.expiresAt)
+			return m.token, nil
+		}
+		m.token, m.expiresAt = "", time.Time{}
+		metrics.RecordTokenExpiry(time.Time{})
+		return "", err
+	}
+
+	m.token, m.expiresAt = token, expiresAt
+	metrics.RecordTokenExpiry(expiresAt)
+	logger.Info("Obtained Twitch app access token", "expires_at", expiresAt)
+
+	return token, nil
+}
+
+// ExpiresAt returns when the current token expires, zero if there is none
+func (m *TokenManager) ExpiresAt() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.expiresAt
+}
+
+// invalidate forgets token if it is still the current one, so the next call
+// to Token requests a new one
+func (m *TokenManager) invalidate(token string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.token == token {
+		m.token, m.expiresAt = "", time.Time{}
+		metrics.RecordTokenExpiry(time.Time{})
+	}
+}
+
+// requestToken performs the client credentials grant
+func (m *TokenManager) requestToken(ctx context.Context) (string, time.Time, error) {
+	form := url.Values{
+		"client_id":     {m.clientID},
+		"client_secret": {m.clientSecret},
+		"grant_type":    {"client_credentials"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	requestedAt := m.now()
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to request app access token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to read app access token: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("app access token request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var token tokenResponse
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to decode app access token: %w", err)
+	}
+	if token.AccessToken == "" || token.ExpiresIn <= 0 {
+		return "", time.Time{}, fmt.Errorf("app access token response is missing the token or its lifetime")
+	}
+
+	return token.AccessToken, requestedAt.Add(time.Duration(token.ExpiresIn) * time.Second), nil
+}
+
+// Run renews the token shortly before it expires until ctx is cancelled, so
+// requests rarely wait for a renewal
+func (m *TokenManager) Run(ctx context.Context) {
+	for {
+		wait := retryDelay
+		if _, err := m.Token(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Error("Failed to obtain Twitch app access token", "error", err)
+		} else if expiresAt := m.ExpiresAt(); !expiresAt.IsZero() {
+			wait = expiresAt.Add(-refreshMargin).Sub(m.now())
+		}
+		// A token inside the margin means its renewal just failed
+		if wait <= 0 {
+			wait = retryDelay
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// Do sends an API request with the current app access token. A 401 response
+// means the token was revoked or expired early, so it is renewed and the
+// request retried once.
+func (m *TokenManager) Do(req *http.Request) (*http.Response, error) {
+	token, err := m.Token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := m.send(req, token)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// Requests whose body cannot be replayed are not retried
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	logger.Warn("Twitch rejected the app access token, renewing it", "path", req.URL.Path)
+	m.invalidate(token)
+	token, err = m.Token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	return m.send(retry, token)
+}
+
+// send performs a request authorized with token
+func (m *TokenManager) send(req *http.Request, token string) (*http.Response, error) {
+	authorized := req.Clone(req.Context())
+	authorized.Header.Set("Authorization", "Bearer "+token)
+	return m.httpClient.Do(authorized)
+}
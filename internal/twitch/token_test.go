@@ -0,0 +1,149 @@
+package twitch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// oauthServer stands in for the Twitch OAuth and Helix endpoints. Each token
+// request issues a new token; only the latest one is accepted by the API.
+type oauthServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	issued   int
+	valid    string
+	failNext bool
+}
+
+func newOAuthServer(t *testing.T) *oauthServer {
+	s := &oauthServer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if r.FormValue("grant_type") != "client_credentials" || r.FormValue("client_id") != "id" || r.FormValue("client_secret") != "secret" {
+			http.Error(w, `{"status":400,"message":"invalid client"}`, http.StatusBadRequest)
+			return
+		}
+		if s.failNext {
+			s.failNext = false
+			http.Error(w, `{"status":503,"message":"unavailable"}`, http.StatusServiceUnavailable)
+			return
+		}
+
+		s.issued++
+		s.valid = fmt.Sprintf("token-%d", s.issued)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token": %q, "expires_in": 3600, "token_type": "bearer"}`, s.valid)
+	})
+	mux.HandleFunc("/helix/", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		valid := s.valid
+		s.mu.Unlock()
+
+		if r.Header.Get("Authorization") != "Bearer "+valid {
+			http.Error(w, `{"status":401,"message":"Invalid OAuth token"}`, http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "ok %s", body)
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// revoke invalidates the issued token, as Twitch may do at any time
+func (s *oauthServer) revoke() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.valid = ""
+}
+
+func TestTokenManager(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("caches until near expiry", func(t *testing.T) {
+		server := newOAuthServer(t)
+		m := NewTokenManager("id", "secret", WithTokenURL(server.URL+"/oauth2/token"))
+		now := time.Now()
+		m.now = func() time.Time { return now }
+
+		for i := 0; i < 3; i++ {
+			token, err := m.Token(ctx)
+			if err != nil || token != "token-1" {
+				t.Fatalf("Expected token-1, got %q (err: %v)", token, err)
+			}
+		}
+
+		now = now.Add(time.Hour - refreshMargin)
+		if token, err := m.Token(ctx); err != nil || token != "token-2" {
+			t.Errorf("Expected renewal to token-2 near expiry, got %q (err: %v)", token, err)
+		}
+	})
+
+	t.Run("keeps current token when renewal fails", func(t *testing.T) {
+		server := newOAuthServer(t)
+		m := NewTokenManager("id", "secret", WithTokenURL(server.URL+"/oauth2/token"))
+		now := time.Now()
+		m.now = func() time.Time { return now }
+
+		if _, err := m.Token(ctx); err != nil {
+			t.Fatalf("Token failed: %v", err)
+		}
+
+		server.mu.Lock()
+		server.failNext = true
+		server.mu.Unlock()
+		now = now.Add(time.Hour - time.Minute)
+		if token, err := m.Token(ctx); err != nil || token != "token-1" {
+			t.Errorf("Expected the still valid token-1, got %q (err: %v)", token, err)
+		}
+	})
+
+	t.Run("invalid credentials", func(t *testing.T) {
+		server := newOAuthServer(t)
+		m := NewTokenManager("id", "wrong", WithTokenURL(server.URL+"/oauth2/token"))
+		if _, err := m.Token(ctx); err == nil || !strings.Contains(err.Error(), "status 400") {
+			t.Errorf("Expected status 400 error, got %v", err)
+		}
+	})
+
+	t.Run("renews and retries on 401", func(t *testing.T) {
+		server := newOAuthServer(t)
+		m := NewTokenManager("id", "secret", WithTokenURL(server.URL+"/oauth2/token"))
+
+		if _, err := m.Token(ctx); err != nil {
+			t.Fatalf("Token failed: %v", err)
+		}
+		server.revoke()
+
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/helix/eventsub/subscriptions", strings.NewReader("payload"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := m.Do(req)
+		if err != nil {
+			t.Fatalf("Do failed: %v", err)
+		}
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK || string(body) != "ok payload" {
+			t.Errorf("Expected retried request to succeed with its body, got %d %q", resp.StatusCode, body)
+		}
+		if server.issued != 2 {
+			t.Errorf("Expected 2 tokens to be issued, got %d", server.issued)
+		}
+	})
+}